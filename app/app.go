@@ -7,8 +7,6 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	goruntime "runtime"
-	"sort"
 	"strings"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
@@ -56,11 +54,21 @@ func (a *App) startup(ctx context.Context) {
 		runtime.WindowShow(a.ctx)
 		Log("Browser exited callback: WindowShow() completed")
 	})
+	a.server.SetOnBrowserHidden(func() {
+		Log("Browser hidden, showing window")
+		runtime.WindowShow(a.ctx)
+	})
 	a.server.SetOnPlayerExit(func() {
 		Log("Player exited callback triggered, showing window")
 		runtime.WindowShow(a.ctx)
 		Log("Player exited callback: WindowShow() completed")
 	})
+	// Music plays without a window, so bring the launcher up to show what's
+	// playing; it is hidden behind the browser that started it otherwise
+	a.server.SetOnAudioStarted(func() {
+		Log("Audio playback started, showing window")
+		runtime.WindowShow(a.ctx)
+	})
 	// Set up shutdown callback
 	a.server.SetOnShutdown(func() {
 		Log("Shutdown requested via API")
@@ -68,6 +76,11 @@ func (a *App) startup(ctx context.Context) {
 	})
 }
 
+// shutdown is called when the app is about to exit
+func (a *App) shutdown(ctx context.Context) {
+	a.server.Close()
+}
+
 // Profile represents a user profile
 type Profile struct {
 	ID          string `json:"id"`
@@ -79,45 +92,7 @@ type Profile struct {
 
 // GetProfiles returns all user profiles
 func (a *App) GetProfiles() []Profile {
-	profilesDir := filepath.Join(a.server.dataDir, "profiles")
-	entries, err := os.ReadDir(profilesDir)
-	if err != nil {
-		Log("Failed to read profiles dir: %v", err)
-		return []Profile{}
-	}
-
-	var profiles []Profile
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
-
-		profileDir := filepath.Join(profilesDir, entry.Name())
-		profilePath := filepath.Join(profileDir, "profile.json")
-		data, err := os.ReadFile(profilePath)
-		if err != nil {
-			continue
-		}
-
-		var profile Profile
-		if err := json.Unmarshal(data, &profile); err != nil {
-			continue
-		}
-
-		// Convert relative photoPath to embed path (for use with embed= param)
-		if profile.PhotoPath != "" && !filepath.IsAbs(profile.PhotoPath) {
-			profile.PhotoPath = "images/profile-photos/" + profile.PhotoPath
-		}
-
-		profiles = append(profiles, profile)
-	}
-
-	// Sort by order
-	sort.Slice(profiles, func(i, j int) bool {
-		return profiles[i].Order < profiles[j].Order
-	})
-
-	return profiles
+	return a.server.GetProfiles()
 }
 
 // GetApps returns apps for a profile
@@ -127,12 +102,19 @@ func (a *App) GetApps(profileID string) []AppConfig {
 
 // SaveApps saves apps for a profile
 func (a *App) SaveApps(profileID string, apps []AppConfig) error {
-	appsPath := filepath.Join(a.server.dataDir, "profiles", profileID, "apps.json")
+	appsPath, err := profileFile(a.server.dataDir, profileID, "apps.json")
+	if err != nil {
+		return err
+	}
 	data, err := json.MarshalIndent(apps, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(appsPath, data, 0644)
+	if err := os.WriteFile(appsPath, data, 0644); err != nil {
+		return err
+	}
+	a.server.publishProfileEvent("apps.changed", profileID, eventSourceLauncher)
+	return nil
 }
 
 // GetBrowsers returns available browsers
@@ -145,7 +127,7 @@ func (a *App) LaunchApp(app AppConfig, profileID string, browserName string) err
 	if app.Type == 0 && app.URL != "" {
 		// Website - launch browser and hide window
 		runtime.WindowHide(a.ctx)
-		err := a.server.LaunchBrowser(browserName, app.URL, profileID, app.FocusAlert)
+		err := a.server.LaunchBrowser(browserName, profileID, app)
 		if err != nil {
 			runtime.WindowShow(a.ctx)
 		}
@@ -189,6 +171,12 @@ func (a *App) GetServerPort() int {
 	return a.server.GetPort()
 }
 
+// GetRemoteURL returns the link that opens the phone remote, or "" when the
+// remote is off
+func (a *App) GetRemoteURL() string {
+	return a.server.RemoteURL()
+}
+
 // GetLogoPath returns the logo embed path (for use with embed= param)
 func (a *App) GetLogoPath() string {
 	return "images/launchtube-logo/logo_wide.webp"
@@ -222,6 +210,9 @@ func (a *App) CreateProfile(displayName string, colorValue int) (Profile, error)
 		}
 		return -1
 	}, id)
+	if !validProfileID(id) {
+		return Profile{}, fmt.Errorf("the name needs at least one letter or digit")
+	}
 
 	profileDir := filepath.Join(a.server.dataDir, "profiles", id)
 	if err := os.MkdirAll(profileDir, 0755); err != nil {
@@ -252,6 +243,7 @@ func (a *App) CreateProfile(displayName string, colorValue int) (Profile, error)
 	os.WriteFile(appsPath, []byte("[]"), 0644)
 
 	Log("Created profile: %s (%s)", displayName, id)
+	a.server.publishProfileEvent("profiles.created", id, eventSourceLauncher)
 	return profile, nil
 }
 
@@ -266,8 +258,10 @@ func (a *App) UpdateProfile(id string, displayName string, colorValue int, photo
 		}
 	}
 
-	profileDir := filepath.Join(a.server.dataDir, "profiles", id)
-	profilePath := filepath.Join(profileDir, "profile.json")
+	profilePath, err := profileFile(a.server.dataDir, id, "profile.json")
+	if err != nil {
+		return err
+	}
 
 	data, err := os.ReadFile(profilePath)
 	if err != nil {
@@ -293,7 +287,11 @@ func (a *App) UpdateProfile(id string, displayName string, colorValue int, photo
 	}
 
 	Log("Updated profile: %s (order: %d)", id, order)
-	return os.WriteFile(profilePath, data, 0644)
+	if err := os.WriteFile(profilePath, data, 0644); err != nil {
+		return err
+	}
+	a.server.publishProfileEvent("profiles.updated", id, eventSourceLauncher)
+	return nil
 }
 
 // DeleteProfile deletes a profile
@@ -304,9 +302,16 @@ func (a *App) DeleteProfile(id string) error {
 		return fmt.Errorf("cannot delete the last profile")
 	}
 
-	profileDir := filepath.Join(a.server.dataDir, "profiles", id)
+	profileDir, err := profileFile(a.server.dataDir, id)
+	if err != nil {
+		return err
+	}
 	Log("Deleting profile: %s", id)
-	return os.RemoveAll(profileDir)
+	if err := os.RemoveAll(profileDir); err != nil {
+		return err
+	}
+	a.server.publishProfileEvent("profiles.deleted", id, eventSourceLauncher)
+	return nil
 }
 
 // GetProfilePhotos returns available profile photos (embed paths for use with embed= param)
@@ -367,16 +372,8 @@ func (a *App) GetProfilePhotos() []string {
 
 // GetMpvPaths returns available mpv installations
 func (a *App) GetMpvPaths() []string {
-	candidates := []string{"mpv"}
-	if goruntime.GOOS == "windows" {
-		candidates = append(candidates,
-			`C:\Program Files\mpv\mpv.exe`,
-			`C:\Program Files (x86)\mpv\mpv.exe`,
-		)
-	}
-
 	var found []string
-	for _, path := range candidates {
+	for _, path := range mpvCandidates() {
 		if _, err := exec.LookPath(path); err == nil {
 			found = append(found, path)
 		}
@@ -384,26 +381,85 @@ func (a *App) GetMpvPaths() []string {
 	return found
 }
 
-// GetSelectedMpv returns the currently selected mpv path
-func (a *App) GetSelectedMpv() string {
+// GetSelectedMpv returns the mpv path a profile uses
+func (a *App) GetSelectedMpv(profileID string) string {
+	if path := LoadPlayerSettings(a.server.dataDir, profileID).MpvPath; path != "" {
+		return path
+	}
 	return a.server.player.GetMpvPath()
 }
 
-// SetSelectedMpv sets the mpv path
-func (a *App) SetSelectedMpv(path string) {
-	a.server.player.SetMpvPath(path)
+// SetSelectedMpv sets the mpv path for a profile
+func (a *App) SetSelectedMpv(profileID, path string) error {
+	settings := LoadPlayerSettings(a.server.dataDir, profileID)
+	settings.MpvPath = path
+	return SavePlayerSettings(a.server.dataDir, profileID, settings)
 }
 
-// GetMpvOptions returns custom mpv options
-func (a *App) GetMpvOptions() string {
-	return a.server.player.GetMpvOptions()
+// GetMpvOptions returns a profile's custom mpv options
+func (a *App) GetMpvOptions(profileID string) string {
+	return LoadPlayerSettings(a.server.dataDir, profileID).MpvOptions
 }
 
-// SetMpvOptions sets custom mpv options
-func (a *App) SetMpvOptions(options string) {
-	a.server.player.SetMpvOptions(options)
+// SetMpvOptions sets a profile's custom mpv options
+func (a *App) SetMpvOptions(profileID, options string) error {
+	settings := LoadPlayerSettings(a.server.dataDir, profileID)
+	settings.MpvOptions = options
+	return SavePlayerSettings(a.server.dataDir, profileID, settings)
 }
 
+// GetPlayerSettings returns all of a profile's player settings
+func (a *App) GetPlayerSettings(profileID string) PlayerSettings {
+	return LoadPlayerSettings(a.server.dataDir, profileID)
+}
+
+// SetPlayerSettings replaces a profile's player settings
+func (a *App) SetPlayerSettings(profileID string, settings PlayerSettings) error {
+	return SavePlayerSettings(a.server.dataDir, profileID, settings)
+}
+
+// GetPlayerBackends returns the external players LaunchTube can drive
+func (a *App) GetPlayerBackends() []PlayerBackendInfo {
+	return DetectPlayerBackends()
+}
+
+// GetSelectedPlayerBackend returns the player backend chosen for a profile
+func (a *App) GetSelectedPlayerBackend(profileID string) string {
+	settings := LoadPlayerSettings(a.server.dataDir, profileID)
+	if settings.Backend == "" {
+		return "mpv"
+	}
+	return settings.Backend
+}
+
+// SetSelectedPlayerBackend sets the player backend for a profile
+func (a *App) SetSelectedPlayerBackend(profileID, backend string) error {
+	settings := LoadPlayerSettings(a.server.dataDir, profileID)
+	settings.Backend = backend
+	return SavePlayerSettings(a.server.dataDir, profileID, settings)
+}
+
+// GetPlayerCommand returns a profile's custom player command template
+func (a *App) GetPlayerCommand(profileID string) string {
+	return LoadPlayerSettings(a.server.dataDir, profileID).Command
+}
+
+// SetPlayerCommand sets a profile's custom player command template
+func (a *App) SetPlayerCommand(profileID, command string) error {
+	settings := LoadPlayerSettings(a.server.dataDir, profileID)
+	settings.Command = command
+	return SavePlayerSettings(a.server.dataDir, profileID, settings)
+}
+
+// GetBrowserSettings returns a profile's browser settings
+func (a *App) GetBrowserSettings(profileID string) BrowserSettings {
+	return LoadBrowserSettings(a.server.dataDir, profileID)
+}
+
+// SetBrowserSettings replaces a profile's browser settings
+func (a *App) SetBrowserSettings(profileID string, settings BrowserSettings) error {
+	return SaveBrowserSettings(a.server.dataDir, profileID, settings)
+}
 
 // GetServiceLibrary returns available streaming services
 func (a *App) GetServiceLibrary() []ServiceTemplate {
@@ -3,7 +3,6 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -12,48 +11,110 @@ import (
 	"strings"
 	"sync"
 	"time"
-
-	"github.com/gorilla/websocket"
 )
 
+// BrowserInfo is a browser from the registry that is installed here
 type BrowserInfo struct {
 	Name           string `json:"name"`
 	Executable     string `json:"executable"`
 	FullscreenFlag string `json:"fullscreenFlag"`
+	Dialect        string `json:"dialect"`
+	CDP            bool   `json:"cdp"`
+	spec           BrowserSpec
 }
 
-var knownBrowsers = []BrowserInfo{
-	{Name: "Chrome", Executable: "google-chrome", FullscreenFlag: "--start-fullscreen"},
-	{Name: "Chrome", Executable: "google-chrome-stable", FullscreenFlag: "--start-fullscreen"},
-	{Name: "Chrome", Executable: "chrome", FullscreenFlag: "--start-fullscreen"},
-	{Name: "Chrome", Executable: "chrome.exe", FullscreenFlag: "--start-fullscreen"},
-	{Name: "Chromium", Executable: "chromium", FullscreenFlag: "--start-fullscreen"},
-	{Name: "Chromium", Executable: "chromium-browser", FullscreenFlag: "--start-fullscreen"},
-	{Name: "Chromium", Executable: "chromium.exe", FullscreenFlag: "--start-fullscreen"},
-	{Name: "Brave", Executable: "brave", FullscreenFlag: "--start-fullscreen"},
-	{Name: "Brave", Executable: "brave-browser", FullscreenFlag: "--start-fullscreen"},
-	{Name: "Brave", Executable: "brave.exe", FullscreenFlag: "--start-fullscreen"},
+// Browser is a browser that apps are launched in. BrowserManager runs the
+// installed browser with the launchtube extension; CDPBrowser drives Chrome
+// over the DevTools protocol and injects the service scripts itself. Page
+// methods take a urlPattern selecting the tab whose URL contains it; an
+// empty pattern means the current tab.
+type Browser interface {
+	// Launch starts browserName on url. Implementations that only run one
+	// browser ignore browserName.
+	Launch(browserName, url, profileID string, opts *BrowserOptions) error
+	Close()
+	IsRunning() bool
+
+	// PID is the browser's process ID, or 0 when it isn't running
+	PID() int
+
+	// SetOnExit sets a function called when the browser exits on its own
+	SetOnExit(fn func())
+
+	Navigate(url string) error
+	Evaluate(urlPattern, script string) (interface{}, error)
+	CurrentURL() (string, error)
+
+	// Screenshot captures the current tab as a PNG
+	Screenshot() ([]byte, error)
+
+	// SendKeyToPage presses key, after focusing focusSelector if given
+	SendKeyToPage(urlPattern, key, focusSelector string) error
+	ClickElement(urlPattern, selector string) error
+	TypeText(urlPattern, text string) error
 }
 
 type BrowserManager struct {
 	mu             sync.Mutex
-	cmd            *exec.Cmd
-	pid            int
-	browser        *BrowserInfo
+	sessions       map[string]*browserSession // by profile ID
+	active         *browserSession            // the browser on screen, if any
 	overridesDir   string
 	assetDir       string
 	dataDir        string
 	onExit         func()
+	onHang         func(BrowserIncident)
+	watchdog       *pageWatchdog              // on the active session
+	cdp            *CDPClient
+}
+
+// browserSession is a browser process started for a profile. When the
+// profile keeps warm tabs it stays running in the background between apps,
+// with one tab per app.
+type browserSession struct {
+	profileID  string
+	cmd        *exec.Cmd
+	pid        int
+	browser    *BrowserInfo
+	key        string        // see sessionKey
+	port       int           // DevTools port, 0 until the browser reports it
+	cdp        *CDPClient    // see client
+	warmTabs   int           // tab limit, 0 when the browser closes with its app
+	tabs       []warmTab     // app tabs, least recently used first
+	notifyExit bool          // call onExit when it exits: it is, or was closed while, on screen
+	exited     chan struct{} // closed when the process exits
+}
+
+// warmTab is the tab an app was opened in
+type warmTab struct {
+	url      string
+	targetID string
+}
+
+// client returns the session's DevTools client, shared by everything that
+// talks to its browser. Call it with the BrowserManager locked.
+func (sess *browserSession) client() *CDPClient {
+	if sess.cdp == nil {
+		sess.cdp = NewCDPClient()
+	}
+	sess.cdp.SetPort(sess.port)
+	return sess.cdp
 }
 
 func NewBrowserManager(overridesDir, assetDir, dataDir string) *BrowserManager {
 	return &BrowserManager{
+		sessions:     make(map[string]*browserSession),
 		overridesDir: overridesDir,
 		assetDir:     assetDir,
 		dataDir:      dataDir,
+		cdp:          NewCDPClient(),
 	}
 }
 
+// CDP returns the DevTools client for the running browser
+func (bm *BrowserManager) CDP() *CDPClient {
+	return bm.cdp
+}
+
 func (bm *BrowserManager) SetOnExit(fn func()) {
 	bm.mu.Lock()
 	bm.onExit = fn
@@ -77,31 +138,57 @@ func (bm *BrowserManager) findExtension(name string) string {
 	return ""
 }
 
+// DetectBrowsers lists the registry's browsers that are installed, reading
+// the registry again so edits to browsers.json apply without a restart
 func (bm *BrowserManager) DetectBrowsers() []BrowserInfo {
 	var found []BrowserInfo
-	for _, browser := range knownBrowsers {
-		if _, err := exec.LookPath(browser.Executable); err == nil {
-			found = append(found, browser)
+	for _, spec := range loadBrowserRegistry(bm.dataDir, bm.overridesDir) {
+		if executable := spec.detect(); executable != "" {
+			found = append(found, BrowserInfo{
+				Name:           spec.Name,
+				Executable:     executable,
+				FullscreenFlag: spec.FullscreenFlag,
+				Dialect:        spec.Dialect,
+				CDP:            spec.CDP,
+				spec:           spec,
+			})
 		}
 	}
 	return found
 }
 
+// FindBrowser returns the installed browser with the given name or executable
 func (bm *BrowserManager) FindBrowser(name string) *BrowserInfo {
-	for _, browser := range knownBrowsers {
-		if browser.Name == name || browser.Executable == name {
-			if _, err := exec.LookPath(browser.Executable); err == nil {
-				return &browser
-			}
+	for _, browser := range bm.DetectBrowsers() {
+		if strings.EqualFold(browser.Name, name) || browser.Executable == name {
+			return &browser
 		}
 	}
 	return nil
 }
 
-func (bm *BrowserManager) Launch(browserName, url, profileID string) error {
-	bm.mu.Lock()
-	defer bm.mu.Unlock()
+// sessionKey sums up what the launch arguments depend on besides the URL.
+// Apps with the same key can share a warm browser.
+func sessionKey(browser *BrowserInfo, extensions map[string]string, opts *BrowserOptions) string {
+	parts := []string{browser.Name}
+	for _, name := range launchExtensions {
+		if _, ok := extensions[name]; ok {
+			parts = append(parts, name)
+		}
+	}
+	parts = append(parts, opts.chromiumOptionFlags()...)
+	parts = append(parts, opts.flags()...)
+	if policy := opts.policy(); len(policy) > 0 {
+		data, _ := json.Marshal(policy)
+		parts = append(parts, string(data))
+	}
+	return strings.Join(parts, "\x00")
+}
 
+// Launch starts the browser on url. opts may be nil for the defaults. When
+// the profile keeps warm tabs and its browser is still running, the app's
+// tab is brought back, or opened, instead.
+func (bm *BrowserManager) Launch(browserName, url, profileID string, opts *BrowserOptions) error {
 	// Find the browser
 	browser := bm.FindBrowser(browserName)
 	if browser == nil {
@@ -113,71 +200,74 @@ func (bm *BrowserManager) Launch(browserName, url, profileID string) error {
 		browser = &browsers[0]
 	}
 
-	// Don't use --start-fullscreen; let the script handle fullscreen on user gesture
-	args := []string{}
-
-	// Add user-data-dir for profile isolation
-	if profileID != "" {
-		profilePath := filepath.Join(bm.dataDir, "profiles", profileID, "chrome")
-		args = append(args, "--user-data-dir="+profilePath)
-
-		// Clear service worker cache if our extension has been updated
-		bm.clearStaleServiceWorkerCache(profileID)
-	}
-
 	// Load extensions
-	var extensions []string
-
-	// LaunchTube loader extension
-	if ext := bm.findExtension("launchtube"); ext != "" {
-		extensions = append(extensions, ext)
-		Log("Loading LaunchTube extension from: %s", ext)
+	extensions := make(map[string]string)
+	for _, name := range launchExtensions {
+		if !opts.loadsExtension(name) {
+			Log("Skipping %s extension for this app", name)
+			continue
+		}
+		if ext := bm.findExtension(name); ext != "" {
+			extensions[name] = ext
+			Log("Loading %s extension from: %s", name, ext)
+		}
 	}
+	key := sessionKey(browser, extensions, opts)
 
-	// uBlock Origin Lite
-	if ext := bm.findExtension("ublock-origin"); ext != "" {
-		extensions = append(extensions, ext)
-		Log("Loading uBlock Origin from: %s", ext)
+	// Tabs are switched over DevTools
+	warmTabs := LoadBrowserSettings(bm.dataDir, profileID).WarmTabs
+	if !browser.spec.CDP || profileID == "" {
+		warmTabs = 0
 	}
 
-	// Dark Reader
-	if ext := bm.findExtension("dark-reader"); ext != "" {
-		extensions = append(extensions, ext)
-		Log("Loading Dark Reader from: %s", ext)
-	}
+	bm.mu.Lock()
+	sess := bm.sessions[profileID]
+	onScreen := bm.active
+	bm.mu.Unlock()
 
-	if len(extensions) > 0 {
-		args = append(args, "--load-extension="+strings.Join(extensions, ","))
+	if sess != nil {
+		if warmTabs > 0 && sess.key == key {
+			err := bm.switchTo(sess, url, warmTabs)
+			if err == nil {
+				if onScreen != nil && onScreen != sess {
+					bm.putAway(onScreen)
+				}
+				return nil
+			}
+			Log("Warm browser: can't switch to %s (%v), restarting", url, err)
+		}
+		// The profile directory is locked while its browser runs
+		bm.stopSession(sess, true)
+	}
+	if onScreen != nil && onScreen != sess {
+		bm.putAway(onScreen)
 	}
 
-	// Chrome flags
-	args = append(args,
-		"--disable-infobars",
-		"--autoplay-policy=no-user-gesture-required",
-		"--hide-crash-restore-bubble",
-		"--disable-features=MediaRouter,GlobalMediaControls,LocalNetworkAccessChecks",
-		"--disable-device-discovery-notifications",
-		"--disable-notifications",
-		"--disable-sync",
-		"--no-first-run",
-		"--disable-default-apps",
-		"--force-dark-mode",
-		"--enable-features=AutomaticFullscreenContentSetting",
-		"--start-fullscreen",
-		"--remote-debugging-port=9222",
-	)
+	return bm.start(browser, url, profileID, extensions, opts, key, warmTabs)
+}
 
-	// Create policy file for automatic fullscreen permission
-	if profileID != "" {
-		policyDir := filepath.Join(bm.dataDir, "profiles", profileID, "chrome", "policies", "managed")
-		os.MkdirAll(policyDir, 0755)
-		policyFile := filepath.Join(policyDir, "launchtube.json")
-		policy := `{"AutomaticFullscreenAllowedForUrls": ["https://www.youtube.com", "https://youtube.com", "*"]}`
-		os.WriteFile(policyFile, []byte(policy), 0644)
+// start launches a new browser process for profileID
+func (bm *BrowserManager) start(browser *BrowserInfo, url, profileID string, extensions map[string]string, opts *BrowserOptions, key string, warmTabs int) error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	// DevTools port: Chromium picks a free one and writes it to
+	// DevToolsActivePort in the profile. Without a profile directory to
+	// look in, pick one ourselves.
+	devtoolsPort, portFile := 0, ""
+	if browser.spec.CDP {
+		if profilePath := browser.spec.profilePath(bm.dataDir, profileID); profilePath != "" {
+			portFile = filepath.Join(profilePath, "DevToolsActivePort")
+			os.Remove(portFile)
+		} else if port, err := freeLocalPort(); err == nil {
+			devtoolsPort = port
+		} else {
+			Log("Failed to allocate DevTools port: %v", err)
+		}
 	}
+	bm.cdp.SetPort(0)
 
-	// Add the URL
-	args = append(args, url)
+	args := bm.browserArgs(browser.spec, url, profileID, extensions, devtoolsPort, opts)
 
 	Log("Launching browser: %s %v", browser.Executable, args)
 
@@ -186,24 +276,50 @@ func (bm *BrowserManager) Launch(browserName, url, profileID string) error {
 		return err
 	}
 
-	bm.cmd = cmd
-	bm.pid = cmd.Process.Pid
-	bm.browser = browser
+	sess := &browserSession{
+		profileID:  profileID,
+		cmd:        cmd,
+		pid:        cmd.Process.Pid,
+		browser:    browser,
+		key:        key,
+		port:       devtoolsPort,
+		warmTabs:   warmTabs,
+		tabs:       []warmTab{{url: url}},
+		notifyExit: true,
+		exited:     make(chan struct{}),
+	}
+	bm.sessions[profileID] = sess
+	bm.active = sess
+	bm.watch(sess)
 
-	Log("Browser started with PID: %d", bm.pid)
+	Log("Browser started with PID: %d", sess.pid)
+
+	if portFile != "" {
+		go bm.waitForDevToolsPort(sess, portFile)
+	} else if devtoolsPort != 0 {
+		bm.cdp.SetPort(devtoolsPort)
+	}
 
 	// Watch for exit
 	go func() {
 		cmd.Wait()
+		close(sess.exited)
+
 		bm.mu.Lock()
 		Log("Browser process exited")
-		bm.cmd = nil
-		bm.pid = 0
-		bm.browser = nil
+		if bm.sessions[profileID] == sess {
+			delete(bm.sessions, profileID)
+		}
+		if bm.active == sess {
+			bm.active = nil
+			bm.cdp.SetPort(0)
+		}
+		bm.unwatch(sess)
+		notify := sess.notifyExit
 		onExit := bm.onExit
 		bm.mu.Unlock()
 
-		if onExit != nil {
+		if notify && onExit != nil {
 			onExit()
 		}
 	}()
@@ -211,44 +327,249 @@ func (bm *BrowserManager) Launch(browserName, url, profileID string) error {
 	return nil
 }
 
-func (bm *BrowserManager) Close() {
+// switchTo brings back a warm browser on the tab for url, opening one if
+// the app has none, and closes the least recently used tabs over the limit
+func (bm *BrowserManager) switchTo(sess *browserSession, url string, warmTabs int) error {
 	bm.mu.Lock()
-	defer bm.mu.Unlock()
+	c := sess.client()
+	fullscreen := sess.browser.FullscreenFlag != ""
+	bm.mu.Unlock()
 
-	if bm.cmd == nil || bm.cmd.Process == nil {
-		Log("No browser process to close")
+	targets, err := c.Targets()
+	if err != nil {
+		return err
+	}
+	open := make(map[string]bool)
+	for _, t := range targets {
+		if t.Type == "page" {
+			open[t.ID] = true
+		}
+	}
+
+	// Forget tabs that were closed in the browser
+	bm.mu.Lock()
+	var tabs []warmTab
+	for _, tab := range sess.tabs {
+		if open[tab.targetID] {
+			tabs = append(tabs, tab)
+		}
+	}
+	bm.mu.Unlock()
+
+	var current warmTab
+	for i, tab := range tabs {
+		if tab.url == url {
+			current = tab
+			tabs = append(tabs[:i], tabs[i+1:]...)
+			break
+		}
+	}
+	if current.targetID != "" {
+		if err := c.ActivateTarget(current.targetID); err != nil {
+			return err
+		}
+		Log("Warm browser: back to tab for %s", url)
+	} else {
+		target, err := c.NewTab(url)
+		if err != nil {
+			return err
+		}
+		current = warmTab{url: url, targetID: target.ID}
+		c.ActivateTarget(target.ID)
+		Log("Warm browser: opened tab for %s", url)
+	}
+	tabs = append(tabs, current)
+
+	for len(tabs) > warmTabs {
+		Log("Warm browser: closing least recently used tab %s", tabs[0].url)
+		c.CloseTarget(tabs[0].targetID)
+		tabs = tabs[1:]
+	}
+
+	state := "normal"
+	if fullscreen {
+		state = "fullscreen"
+	}
+	if err := c.SetWindowState(current.targetID, state); err != nil {
+		Log("Warm browser: can't restore window: %v", err)
+	}
+
+	bm.mu.Lock()
+	sess.tabs = tabs
+	sess.warmTabs = warmTabs
+	sess.notifyExit = true
+	bm.active = sess
+	bm.cdp.SetPort(sess.port)
+	bm.watch(sess)
+	bm.mu.Unlock()
+	return nil
+}
+
+// Hide takes the browser off screen without closing it, if its profile
+// keeps warm tabs. It reports whether it did; a browser that can't be kept
+// should be closed instead.
+func (bm *BrowserManager) Hide() bool {
+	bm.mu.Lock()
+	sess := bm.active
+	keep := sess != nil && sess.warmTabs > 0 && sess.port != 0
+	bm.mu.Unlock()
+
+	if !keep {
+		return false
+	}
+	bm.putAway(sess)
+	return true
+}
+
+// putAway minimizes a warm browser, or closes one that isn't kept
+func (bm *BrowserManager) putAway(sess *browserSession) {
+	bm.mu.Lock()
+	if bm.active == sess {
+		bm.active = nil
+		bm.cdp.SetPort(0)
+	}
+	bm.unwatch(sess)
+	keep := sess.warmTabs > 0 && sess.port != 0 && len(sess.tabs) > 0
+	var targetID string
+	if keep {
+		targetID = sess.tabs[len(sess.tabs)-1].targetID
+		sess.notifyExit = false
+	}
+	c := sess.client()
+	tabCount := len(sess.tabs)
+	bm.mu.Unlock()
+
+	if !keep {
+		bm.stopSession(sess, true)
 		return
 	}
+	if err := c.SetWindowState(targetID, "minimized"); err != nil {
+		Log("Warm browser: can't minimize: %v", err)
+	}
+	Log("Warm browser: kept %d tab(s) for profile %s in the background", tabCount, sess.profileID)
+}
+
+// stopSession ends a browser process. quiet skips the exit callback, and
+// waits for the process to go so that its profile can be used again.
+func (bm *BrowserManager) stopSession(sess *browserSession, quiet bool) {
+	bm.mu.Lock()
+	if quiet {
+		sess.notifyExit = false
+	}
+	if bm.active == sess {
+		bm.active = nil
+		bm.cdp.SetPort(0)
+	}
+	bm.unwatch(sess)
+	bm.mu.Unlock()
 
-	Log("Closing browser process PID: %d", bm.pid)
+	Log("Closing browser process PID: %d", sess.pid)
 
 	if runtime.GOOS == "windows" {
-		exec.Command("taskkill", "/F", "/PID", strconv.Itoa(bm.pid)).Run()
+		exec.Command("taskkill", "/F", "/PID", strconv.Itoa(sess.pid)).Run()
 	} else {
-		bm.cmd.Process.Signal(os.Interrupt)
+		sess.cmd.Process.Signal(os.Interrupt)
+	}
+
+	if quiet {
+		select {
+		case <-sess.exited:
+		case <-time.After(5 * time.Second):
+			Log("Browser PID %d didn't exit, killing it", sess.pid)
+			sess.cmd.Process.Kill()
+			<-sess.exited
+		}
+	}
+}
+
+// Close closes every browser, including warm ones in the background
+func (bm *BrowserManager) Close() {
+	bm.mu.Lock()
+	var sessions []*browserSession
+	for _, sess := range bm.sessions {
+		if sess != bm.active {
+			sess.notifyExit = false
+		}
+		sessions = append(sessions, sess)
 	}
+	bm.mu.Unlock()
 
-	bm.cmd = nil
-	bm.pid = 0
-	bm.browser = nil
+	if len(sessions) == 0 {
+		Log("No browser process to close")
+		return
+	}
+	for _, sess := range sessions {
+		bm.stopSession(sess, false)
+	}
+}
+
+// waitForDevToolsPort reads the port the browser chose once it has written
+// it, and points the CDP client at it if the session is on screen
+func (bm *BrowserManager) waitForDevToolsPort(sess *browserSession, portFile string) {
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		if port, err := readDevToolsActivePort(portFile); err == nil {
+			bm.mu.Lock()
+			sess.port = port
+			if bm.active == sess {
+				bm.cdp.SetPort(port)
+			}
+			warm := sess.warmTabs > 0
+			bm.mu.Unlock()
+			Log("Browser DevTools listening on port %d", port)
+
+			if warm {
+				bm.findFirstTab(sess)
+			}
+			return
+		}
+
+		select {
+		case <-sess.exited:
+			return
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+	Log("Browser never reported its DevTools port (%s)", portFile)
+}
+
+// findFirstTab records the tab a warm browser was started with
+func (bm *BrowserManager) findFirstTab(sess *browserSession) {
+	bm.mu.Lock()
+	c := sess.client()
+	bm.mu.Unlock()
+
+	target, err := c.FindPage("")
+	if err != nil {
+		Log("Warm browser: can't find the first tab: %v", err)
+		return
+	}
+	bm.mu.Lock()
+	if len(sess.tabs) > 0 && sess.tabs[0].targetID == "" {
+		sess.tabs[0].targetID = target.ID
+	}
+	bm.mu.Unlock()
 }
 
 func (bm *BrowserManager) IsRunning() bool {
 	bm.mu.Lock()
 	defer bm.mu.Unlock()
-	return bm.cmd != nil
+	return bm.active != nil
 }
 
-func (bm *BrowserManager) GetPID() int {
+func (bm *BrowserManager) PID() int {
 	bm.mu.Lock()
 	defer bm.mu.Unlock()
-	return bm.pid
+	if bm.active == nil {
+		return 0
+	}
+	return bm.active.pid
 }
 
-func (bm *BrowserManager) clearStaleServiceWorkerCache(profileID string) {
+func (bm *BrowserManager) clearStaleServiceWorkerCache(profilePath string) {
 	bgScript := filepath.Join(bm.assetDir, "extensions", "launchtube", "background.js")
-	mtimeFile := filepath.Join(bm.dataDir, "profiles", profileID, "sw_mtime")
-	swDir := filepath.Join(bm.dataDir, "profiles", profileID, "chrome", "Default", "Service Worker")
+	mtimeFile := filepath.Join(filepath.Dir(profilePath), filepath.Base(profilePath)+"_sw_mtime")
+	swDir := filepath.Join(profilePath, "Default", "Service Worker")
 
 	// Get background.js mtime
 	bgInfo, err := os.Stat(bgScript)
@@ -283,133 +604,157 @@ func (e *BrowserError) Error() string {
 	return e.Message
 }
 
-// findCDPTarget finds a browser tab matching urlPattern and returns its ID
-func (bm *BrowserManager) findCDPTarget(urlPattern string) (string, error) {
-	resp, err := http.Get("http://localhost:9222/json")
-	if err != nil {
-		return "", fmt.Errorf("failed to get CDP targets: %w", err)
+// SendFocusToPage clicks the page content of b once it has had time to load
+func SendFocusToPage(b Browser) error {
+	Log("SendFocusToPage: waiting 5 seconds for page to load...")
+	time.Sleep(5 * time.Second)
+
+	Log("SendFocusToPage: clicking page...")
+	if _, err := b.Evaluate("youtube.com", `document.body.click()`); err != nil {
+		Log("SendFocusToPage click failed: %v", err)
+		return err
 	}
-	defer resp.Body.Close()
 
-	var targets []struct {
-		ID   string `json:"id"`
-		Type string `json:"type"`
-		URL  string `json:"url"`
+	Log("SendFocusToPage succeeded")
+	return nil
+}
+
+// currentPage finds the tab on screen: the one the active session's last
+// app was opened in, or its page before that tab is known. Warm tabs in the
+// background are never returned, so input can't land on them. want, when
+// not nil, is the session the caller expects to be on screen.
+func (bm *BrowserManager) currentPage(want *browserSession) (*CDPClient, CDPTarget, error) {
+	bm.mu.Lock()
+	sess := bm.active
+	if sess == nil || sess.port == 0 || (want != nil && sess != want) {
+		bm.mu.Unlock()
+		return nil, CDPTarget{}, errCDPUnavailable
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&targets); err != nil {
-		return "", fmt.Errorf("failed to decode CDP targets: %w", err)
+	c := sess.client()
+	var id string
+	if len(sess.tabs) > 0 {
+		id = sess.tabs[len(sess.tabs)-1].targetID
 	}
+	bm.mu.Unlock()
 
+	targets, err := c.Targets()
+	if err != nil {
+		return nil, CDPTarget{}, err
+	}
 	for _, t := range targets {
-		Log("CDP target: type=%s id=%s url=%s", t.Type, t.ID, t.URL)
-		if t.Type == "page" && strings.Contains(t.URL, urlPattern) {
-			Log("CDP matched target id=%s url=%s", t.ID, t.URL)
-			return t.ID, nil
+		if t.Type == "page" && (id == "" || t.ID == id) {
+			return c, t, nil
 		}
 	}
-
-	return "", fmt.Errorf("no tab found matching %s", urlPattern)
+	return nil, CDPTarget{}, fmt.Errorf("the app's tab is gone")
 }
 
-// cdpEvaluate evaluates JavaScript in a specific target via CDP websocket
-func (bm *BrowserManager) cdpEvaluate(targetID, expression string) (interface{}, error) {
-	wsURL := fmt.Sprintf("ws://localhost:9222/devtools/page/%s", targetID)
-	Log("CDP connecting to: %s", wsURL)
+// pageMatching finds the tab on screen if it's on a URL containing
+// urlPattern
+func (bm *BrowserManager) pageMatching(urlPattern string) (*CDPClient, CDPTarget, error) {
+	c, target, err := bm.currentPage(nil)
+	if err != nil {
+		return nil, CDPTarget{}, err
+	}
+	if !strings.Contains(target.URL, urlPattern) {
+		return nil, CDPTarget{}, fmt.Errorf("no tab found matching %s", urlPattern)
+	}
+	return c, target, nil
+}
 
-	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+// Navigate loads url in the current tab via CDP
+func (bm *BrowserManager) Navigate(url string) error {
+	c, target, err := bm.currentPage(nil)
 	if err != nil {
-		return nil, fmt.Errorf("websocket dial failed: %w", err)
+		return err
 	}
-	defer conn.Close()
+	return c.Navigate(target, url)
+}
 
-	// Send Runtime.evaluate command
-	cmd := map[string]interface{}{
-		"id":     1,
-		"method": "Runtime.evaluate",
-		"params": map[string]interface{}{
-			"expression": expression,
-		},
+// CurrentURL returns the URL of the current tab
+func (bm *BrowserManager) CurrentURL() (string, error) {
+	_, target, err := bm.currentPage(nil)
+	if err != nil {
+		return "", err
 	}
+	return target.URL, nil
+}
 
-	if err := conn.WriteJSON(cmd); err != nil {
-		return nil, fmt.Errorf("write command failed: %w", err)
+// Screenshot captures the current tab via CDP
+func (bm *BrowserManager) Screenshot() ([]byte, error) {
+	c, target, err := bm.currentPage(nil)
+	if err != nil {
+		return nil, err
 	}
+	return c.Screenshot(target)
+}
 
-	// Read response
-	var response struct {
-		ID     int `json:"id"`
-		Result struct {
-			Result struct {
-				Value interface{} `json:"value"`
-			} `json:"result"`
-		} `json:"result"`
-		Error struct {
-			Message string `json:"message"`
-		} `json:"error"`
+// SendKeyToPage sends a key press to the current tab via CDP if it's on a
+// URL matching urlPattern. If focusSelector is provided, focuses that
+// element first
+func (bm *BrowserManager) SendKeyToPage(urlPattern, key, focusSelector string) error {
+	c, target, err := bm.pageMatching(urlPattern)
+	if err != nil {
+		Log("CDP SendKeyToPage: %v", err)
+		return err
 	}
 
-	if err := conn.ReadJSON(&response); err != nil {
-		return nil, fmt.Errorf("read response failed: %w", err)
+	if focusSelector != "" {
+		if err := c.Focus(target, focusSelector); err != nil {
+			Log("CDP SendKeyToPage focus failed: %v", err)
+			return err
+		}
 	}
 
-	if response.Error.Message != "" {
-		return nil, fmt.Errorf("CDP error: %s", response.Error.Message)
+	if err := c.PressKey(target, key); err != nil {
+		Log("CDP SendKeyToPage failed: %v", err)
+		return err
 	}
 
-	Log("CDP evaluate result: %v", response.Result.Result.Value)
-	return response.Result.Result.Value, nil
+	Log("CDP SendKeyToPage: sent %s to %s", key, target.URL)
+	return nil
 }
 
-// SendFocusToPage connects to the browser via CDP and focuses the page content
-func (bm *BrowserManager) SendFocusToPage() error {
-	Log("CDP SendFocusToPage: waiting 5 seconds for page to load...")
-	time.Sleep(5 * time.Second)
-
-	targetID, err := bm.findCDPTarget("youtube.com")
+// ClickElement clicks an element matching selector in the current tab via
+// CDP if it's on a URL matching urlPattern
+func (bm *BrowserManager) ClickElement(urlPattern, selector string) error {
+	c, target, err := bm.pageMatching(urlPattern)
 	if err != nil {
-		Log("CDP SendFocusToPage: %v", err)
+		Log("CDP ClickElement: %v", err)
 		return err
 	}
 
-	Log("CDP SendFocusToPage: clicking page...")
-	_, err = bm.cdpEvaluate(targetID, `document.body.click()`)
-	if err != nil {
-		Log("CDP SendFocusToPage click failed: %v", err)
+	if err := c.Click(target, selector); err != nil {
+		Log("CDP ClickElement failed: %v", err)
 		return err
 	}
 
-	Log("CDP SendFocusToPage succeeded")
-	return nil
-}
-
-// SendKeyToPage sends a key press to a tab matching urlPattern via CDP
-// If focusSelector is provided, focuses that element first
-func (bm *BrowserManager) SendKeyToPage(urlPattern, key, focusSelector string) error {
-	// TODO: Implement with raw websocket CDP - chromedp closes browser on context cancel
-	Log("CDP SendKeyToPage: not implemented (chromedp causes browser close)")
+	Log("CDP ClickElement: clicked %s on %s", selector, target.URL)
 	return nil
 }
 
-// ClickElement clicks an element matching selector in a tab matching urlPattern via CDP
-func (bm *BrowserManager) ClickElement(urlPattern, selector string) error {
-	// TODO: Implement with raw websocket CDP - chromedp closes browser on context cancel
-	Log("CDP ClickElement: not implemented (chromedp causes browser close)")
-	return nil
-}
-
-// EvalJS evaluates JavaScript in a tab matching urlPattern via CDP
-func (bm *BrowserManager) EvalJS(urlPattern, script string) error {
-	targetID, err := bm.findCDPTarget(urlPattern)
+// TypeText types text into the focused element of the current tab via CDP
+// if it's on a URL matching urlPattern
+func (bm *BrowserManager) TypeText(urlPattern, text string) error {
+	c, target, err := bm.pageMatching(urlPattern)
 	if err != nil {
-		Log("CDP EvalJS: %v", err)
+		Log("CDP TypeText: %v", err)
 		return err
 	}
 
-	_, err = bm.cdpEvaluate(targetID, script)
-	if err != nil {
-		Log("CDP EvalJS failed: %v", err)
+	if err := c.InsertText(target, text); err != nil {
+		Log("CDP TypeText failed: %v", err)
 		return err
 	}
-
 	return nil
 }
+
+// Evaluate evaluates JavaScript in the current tab via CDP if it's on a
+// URL matching urlPattern
+func (bm *BrowserManager) Evaluate(urlPattern, script string) (interface{}, error) {
+	c, target, err := bm.pageMatching(urlPattern)
+	if err != nil {
+		return nil, err
+	}
+	return c.Evaluate(target, script)
+}
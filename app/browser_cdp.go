@@ -11,6 +11,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/chromedp/cdproto/input"
 	"github.com/chromedp/cdproto/page"
 	cdpruntime "github.com/chromedp/cdproto/runtime"
 	"github.com/chromedp/chromedp"
@@ -39,6 +40,14 @@ func NewCDPBrowser(assetDir, dataDir string, serverPort int) *CDPBrowser {
 	}
 }
 
+// SetServerPort sets the API port the loader script points pages at. The
+// server only knows it once it is listening.
+func (b *CDPBrowser) SetServerPort(port int) {
+	b.mu.Lock()
+	b.serverPort = port
+	b.mu.Unlock()
+}
+
 func (b *CDPBrowser) SetGetScript(fn func(url, profileID string) string) {
 	b.mu.Lock()
 	b.getScript = fn
@@ -90,17 +99,18 @@ func (b *CDPBrowser) loaderScript() string {
 `, b.serverPort)
 }
 
-// Launch starts Chrome and connects via CDP
-func (b *CDPBrowser) Launch(url, profileID string) error {
+// Launch starts Chrome and connects via CDP. It always runs Chrome, so
+// browserName is ignored; extensions in opts aren't loaded either.
+func (b *CDPBrowser) Launch(browserName, url, profileID string, opts *BrowserOptions) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if b.cmd != nil {
+	if b.ctx != nil {
 		return fmt.Errorf("browser already running")
 	}
 
 	// Build Chrome options - minimal set, no automation markers
-	opts := []chromedp.ExecAllocatorOption{
+	allocOpts := []chromedp.ExecAllocatorOption{
 		chromedp.NoFirstRun,
 		chromedp.NoDefaultBrowserCheck,
 		chromedp.Flag("start-fullscreen", true),
@@ -111,30 +121,31 @@ func (b *CDPBrowser) Launch(url, profileID string) error {
 		// Workaround: open devtools so CDP detection looks like normal user with devtools
 		chromedp.Flag("auto-open-devtools-for-tabs", true),
 	}
+	allocOpts = append(allocOpts, chromedpFlags(opts.chromiumOptionFlags())...)
+	allocOpts = append(allocOpts, chromedpFlags(opts.flags())...)
 
 	// Load uBlock Origin if available
 	// TODO: MV3 extensions via --load-extension may need additional flags
 	// Disabled for now until we resolve the crash
 	// ublockPath := filepath.Join(b.assetDir, "extensions", "ublock-origin")
 	// if _, err := os.Stat(ublockPath); err == nil {
-	// 	opts = append(opts, chromedp.Flag("load-extension", ublockPath))
+	// 	allocOpts = append(allocOpts, chromedp.Flag("load-extension", ublockPath))
 	// 	Log("CDP: Loading uBlock Origin from %s", ublockPath)
 	// }
 
 	// Profile-specific user data dir
-	if profileID != "" {
-		userDataDir := filepath.Join(b.dataDir, "profiles", profileID, "chrome-cdp")
-		opts = append(opts, chromedp.UserDataDir(userDataDir))
+	if userDataDir, err := profileFile(b.dataDir, profileID, "chrome-cdp"); err == nil {
+		allocOpts = append(allocOpts, chromedp.UserDataDir(userDataDir))
 	}
 
 	// Find Chrome executable
 	chromePath := findChrome()
 	if chromePath != "" {
-		opts = append(opts, chromedp.ExecPath(chromePath))
+		allocOpts = append(allocOpts, chromedp.ExecPath(chromePath))
 	}
 
 	// Create allocator context
-	b.allocCtx, b.allocCancel = chromedp.NewExecAllocator(context.Background(), opts...)
+	b.allocCtx, b.allocCancel = chromedp.NewExecAllocator(context.Background(), allocOpts...)
 
 	// Create browser context
 	b.ctx, b.cancel = chromedp.NewContext(b.allocCtx)
@@ -233,19 +244,23 @@ func (b *CDPBrowser) Launch(url, profileID string) error {
 	}
 
 	// Watch for browser exit in background
-	go b.watchForExit()
+	go b.watchForExit(b.ctx)
 
 	return nil
 }
 
-func (b *CDPBrowser) watchForExit() {
+func (b *CDPBrowser) watchForExit(ctx context.Context) {
 	// Wait for context to be done (browser closed)
-	<-b.ctx.Done()
+	<-ctx.Done()
 
 	b.mu.Lock()
 	Log("CDP: Browser context done")
 	onExit := b.onExit
 	b.cmd = nil
+	if b.ctx == ctx {
+		// Closed from the browser rather than by Close
+		b.cleanup()
+	}
 	b.mu.Unlock()
 
 	if onExit != nil {
@@ -294,17 +309,151 @@ func (b *CDPBrowser) IsRunning() bool {
 	return b.ctx != nil
 }
 
-// ExecuteScript runs JavaScript in the current page
-func (b *CDPBrowser) ExecuteScript(script string) error {
+// PID returns the Chrome process ID, or 0 when it isn't running
+func (b *CDPBrowser) PID() int {
 	b.mu.Lock()
-	defer b.mu.Unlock()
+	ctx := b.ctx
+	b.mu.Unlock()
 
-	if b.ctx == nil {
-		return fmt.Errorf("browser not running")
+	if ctx == nil {
+		return 0
+	}
+	if c := chromedp.FromContext(ctx); c != nil && c.Browser != nil {
+		if proc := c.Browser.Process(); proc != nil {
+			return proc.Pid
+		}
+	}
+	return 0
+}
+
+// pageContext returns the context of the page, checking that its URL
+// contains urlPattern. CDPBrowser only drives the tab it opened.
+func (b *CDPBrowser) pageContext(urlPattern string) (context.Context, error) {
+	b.mu.Lock()
+	ctx := b.ctx
+	b.mu.Unlock()
+
+	if ctx == nil {
+		return nil, fmt.Errorf("browser not running")
+	}
+	if urlPattern != "" {
+		var url string
+		if err := chromedp.Run(ctx, chromedp.Location(&url)); err != nil {
+			return nil, err
+		}
+		if !strings.Contains(url, urlPattern) {
+			return nil, fmt.Errorf("no tab found matching %s", urlPattern)
+		}
+	}
+	return ctx, nil
+}
+
+// Evaluate runs JavaScript in the page and returns its value
+func (b *CDPBrowser) Evaluate(urlPattern, script string) (interface{}, error) {
+	ctx, err := b.pageContext(urlPattern)
+	if err != nil {
+		return nil, err
 	}
 
 	var result interface{}
-	return chromedp.Run(b.ctx, chromedp.Evaluate(script, &result))
+	err = chromedp.Run(ctx, chromedp.Evaluate(script, &result))
+	return result, err
+}
+
+// SendKeyToPage sends a trusted key press to the page, focusing
+// focusSelector first if given
+func (b *CDPBrowser) SendKeyToPage(urlPattern, key, focusSelector string) error {
+	def, ok := cdpKeyFor(key)
+	if !ok {
+		return fmt.Errorf("unknown key %q", key)
+	}
+	ctx, err := b.pageContext(urlPattern)
+	if err != nil {
+		return err
+	}
+
+	if focusSelector != "" {
+		var found bool
+		if err := chromedp.Run(ctx, chromedp.Evaluate(focusScript(focusSelector), &found)); err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("no element matches %s", focusSelector)
+		}
+	}
+
+	downType := input.KeyRawDown
+	if def.text != "" {
+		downType = input.KeyDown
+	}
+	return chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		err := input.DispatchKeyEvent(downType).
+			WithKey(key).
+			WithCode(def.code).
+			WithWindowsVirtualKeyCode(int64(def.keyCode)).
+			WithNativeVirtualKeyCode(int64(def.keyCode)).
+			WithText(def.text).
+			WithUnmodifiedText(def.text).
+			Do(ctx)
+		if err != nil {
+			return err
+		}
+		return input.DispatchKeyEvent(input.KeyUp).
+			WithKey(key).
+			WithCode(def.code).
+			WithWindowsVirtualKeyCode(int64(def.keyCode)).
+			WithNativeVirtualKeyCode(int64(def.keyCode)).
+			Do(ctx)
+	}))
+}
+
+// ClickElement clicks the middle of the first element matching selector
+// with real mouse events
+func (b *CDPBrowser) ClickElement(urlPattern, selector string) error {
+	ctx, err := b.pageContext(urlPattern)
+	if err != nil {
+		return err
+	}
+
+	var value interface{}
+	if err := chromedp.Run(ctx, chromedp.Evaluate(elementCenterScript(selector), &value)); err != nil {
+		return err
+	}
+	x, y, err := elementCenter(value, selector)
+	if err != nil {
+		return err
+	}
+
+	return chromedp.Run(ctx,
+		input.DispatchMouseEvent(input.MouseMoved, x, y),
+		input.DispatchMouseEvent(input.MousePressed, x, y).WithButton(input.Left).WithClickCount(1),
+		input.DispatchMouseEvent(input.MouseReleased, x, y).WithButton(input.Left).WithClickCount(1),
+	)
+}
+
+// TypeText types text into the focused element as if it came from an
+// input method
+func (b *CDPBrowser) TypeText(urlPattern, text string) error {
+	ctx, err := b.pageContext(urlPattern)
+	if err != nil {
+		return err
+	}
+	return chromedp.Run(ctx, input.InsertText(text))
+}
+
+// chromedpFlags converts browser arguments like --name=value to allocator
+// options
+func chromedpFlags(args []string) []chromedp.ExecAllocatorOption {
+	var opts []chromedp.ExecAllocatorOption
+	for _, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if hasValue {
+			opts = append(opts, chromedp.Flag(name, value))
+		} else {
+			opts = append(opts, chromedp.Flag(name, true))
+		}
+	}
+	return opts
 }
 
 // findChrome locates the Chrome executable
@@ -361,8 +510,8 @@ func (b *CDPBrowser) WaitForLoad(timeout time.Duration) error {
 	return chromedp.Run(timeoutCtx, chromedp.WaitReady("body"))
 }
 
-// GetCurrentURL returns the current page URL
-func (b *CDPBrowser) GetCurrentURL() (string, error) {
+// CurrentURL returns the current page URL
+func (b *CDPBrowser) CurrentURL() (string, error) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
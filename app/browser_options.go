@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BrowserOptions adjust the browser for one app. They come from the app's
+// config, which copies them from the service JSON when the app is added from
+// the library. A nil *BrowserOptions means the defaults: every bundled
+// extension, dark mode, normal scale and the browser's own user agent.
+type BrowserOptions struct {
+	// Extensions lists the optional bundled extensions to load, e.g.
+	// "ublock-origin" and "dark-reader". null loads all of them, [] none.
+	// The launchtube extension runs the service scripts and always loads.
+	Extensions []string `json:"extensions"`
+	Flags      []string `json:"flags,omitempty"`    // extra browser arguments
+	DarkMode   *bool    `json:"darkMode,omitempty"` // default on
+	UserAgent  string   `json:"userAgent,omitempty"`
+
+	// Scale is the display scale of the whole browser window, e.g. 1.25;
+	// 0 is 1. It applies to the browser's own UI as well as the page, like
+	// a HiDPI setting, which only the page shows in fullscreen.
+	Scale float64 `json:"scale,omitempty"`
+
+	// Mode picks how the browser is run: browserModeExtension or
+	// browserModeCDP. Empty uses the default, set by LAUNCHTUBE_USE_CDP.
+	Mode string `json:"mode,omitempty"`
+
+	// Kiosk keeps the browser on the app's URL and MatchURLs domains, plus
+	// KioskDomains (e.g. a sign-in site). See KioskPolicy.
+	Kiosk        bool     `json:"kiosk,omitempty"`
+	KioskDomains []string `json:"kioskDomains,omitempty"`
+
+	// Policy is Chrome managed policy for the app, merged over the
+	// defaults. See browserPolicy.
+	Policy map[string]interface{} `json:"policy,omitempty"`
+
+	// OnHang is what the watchdog does when the page crashes or stops
+	// responding: one of the hangAction constants. Empty reloads.
+	OnHang string `json:"onHang,omitempty"`
+}
+
+// Browser modes. Extension mode runs the chosen browser with the launchtube
+// extension. CDP mode drives Chrome over the DevTools protocol, which some
+// sites detect as automation.
+const (
+	browserModeExtension = "extension"
+	browserModeCDP       = "cdp"
+)
+
+// Watchdog actions for a hung or crashed page
+const (
+	hangActionReload   = "reload"   // reload the page, restarting the browser if that fails
+	hangActionRestart  = "restart"  // restart the browser on the app's URL
+	hangActionLauncher = "launcher" // close the browser and show the launcher
+	hangActionNone     = "none"     // only log it
+)
+
+// onHang returns the watchdog action for the app
+func (o *BrowserOptions) onHang() string {
+	if o == nil {
+		return hangActionReload
+	}
+	switch o.OnHang {
+	case hangActionRestart, hangActionLauncher, hangActionNone:
+		return o.OnHang
+	}
+	return hangActionReload
+}
+
+// mode returns the browser mode, or def when the options don't pick one
+func (o *BrowserOptions) mode(def string) string {
+	if o == nil || (o.Mode != browserModeExtension && o.Mode != browserModeCDP) {
+		return def
+	}
+	return o.Mode
+}
+
+// loadsExtension reports whether the bundled extension name is wanted
+func (o *BrowserOptions) loadsExtension(name string) bool {
+	if name == "launchtube" {
+		return true
+	}
+	if name == "dark-reader" && !o.darkMode() {
+		return false
+	}
+	if o == nil || o.Extensions == nil {
+		return true
+	}
+	for _, ext := range o.Extensions {
+		if ext == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *BrowserOptions) darkMode() bool {
+	return o == nil || o.DarkMode == nil || *o.DarkMode
+}
+
+func (o *BrowserOptions) scale() float64 {
+	if o == nil || o.Scale <= 0 {
+		return 1
+	}
+	return o.Scale
+}
+
+func (o *BrowserOptions) userAgent() string {
+	if o == nil {
+		return ""
+	}
+	return o.UserAgent
+}
+
+func (o *BrowserOptions) policy() map[string]interface{} {
+	if o == nil {
+		return nil
+	}
+	return o.Policy
+}
+
+func (o *BrowserOptions) flags() []string {
+	if o == nil {
+		return nil
+	}
+	return o.Flags
+}
+
+// chromiumOptionFlags are the Chromium arguments for the options
+func (o *BrowserOptions) chromiumOptionFlags() []string {
+	var args []string
+	if o.darkMode() {
+		args = append(args, "--force-dark-mode")
+	}
+	if scale := o.scale(); scale != 1 {
+		args = append(args, fmt.Sprintf("--force-device-scale-factor=%g", scale))
+	}
+	if ua := o.userAgent(); ua != "" {
+		args = append(args, "--user-agent="+ua)
+	}
+	return args
+}
+
+// firefoxOptionPrefs are the Firefox prefs for the options
+func (o *BrowserOptions) firefoxOptionPrefs() map[string]interface{} {
+	prefs := map[string]interface{}{
+		"layout.css.devPixelsPerPx": fmt.Sprintf("%g", o.scale()),
+	}
+	if o.darkMode() {
+		prefs["ui.systemUsesDarkTheme"] = 1
+		prefs["layout.css.prefers-color-scheme.content-override"] = 0
+	} else {
+		prefs["ui.systemUsesDarkTheme"] = 0
+		prefs["layout.css.prefers-color-scheme.content-override"] = 2
+	}
+	if ua := strings.TrimSpace(o.userAgent()); ua != "" {
+		prefs["general.useragent.override"] = ua
+	}
+	return prefs
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBrowserOptionsExtensions(t *testing.T) {
+	off := false
+	tests := []struct {
+		name string
+		opts *BrowserOptions
+		want []string
+	}{
+		{"defaults", nil, []string{"launchtube", "ublock-origin", "dark-reader"}},
+		{"null list", &BrowserOptions{}, []string{"launchtube", "ublock-origin", "dark-reader"}},
+		{"empty list", &BrowserOptions{Extensions: []string{}}, []string{"launchtube"}},
+		{"uBlock only", &BrowserOptions{Extensions: []string{"ublock-origin"}}, []string{"launchtube", "ublock-origin"}},
+		{"dark mode off", &BrowserOptions{DarkMode: &off}, []string{"launchtube", "ublock-origin"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, name := range launchExtensions {
+			if tt.opts.loadsExtension(name) {
+				got = append(got, name)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: loads %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBrowserOptionFlags(t *testing.T) {
+	off := false
+	tests := []struct {
+		opts *BrowserOptions
+		want []string
+	}{
+		{nil, []string{"--force-dark-mode"}},
+		{&BrowserOptions{DarkMode: &off}, nil},
+		{&BrowserOptions{DarkMode: &off, Scale: 1}, nil},
+		{&BrowserOptions{Scale: 1.25, UserAgent: "Tube/2"}, []string{"--force-dark-mode", "--force-device-scale-factor=1.25", "--user-agent=Tube/2"}},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.chromiumOptionFlags(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v: got %q, want %q", tt.opts, got, tt.want)
+		}
+	}
+
+	prefs := (&BrowserOptions{DarkMode: &off, Scale: 1.5, UserAgent: " Tube/2 "}).firefoxOptionPrefs()
+	want := map[string]interface{}{
+		"layout.css.devPixelsPerPx":                        "1.5",
+		"ui.systemUsesDarkTheme":                           0,
+		"layout.css.prefers-color-scheme.content-override": 2,
+		"general.useragent.override":                       "Tube/2",
+	}
+	if !reflect.DeepEqual(prefs, want) {
+		t.Errorf("firefox prefs %v, want %v", prefs, want)
+	}
+}
+
+func TestBrowserArgsFollowOptions(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestProfile(t, dataDir, "alice")
+	bm := NewBrowserManager("", t.TempDir(), dataDir)
+	chrome, _ := findSpec(loadBrowserRegistry("", ""), "Chrome")
+	off := false
+	opts := &BrowserOptions{DarkMode: &off, Scale: 2, Flags: []string{"--enable-unsafe-swiftshader"}}
+
+	args := bm.browserArgs(chrome, "https://example.com/", "alice", nil, 0, opts)
+	if !containsRun(args, []string{"--force-device-scale-factor=2"}) || containsRun(args, []string{"--force-dark-mode"}) {
+		t.Errorf("args %q", args)
+	}
+	// The app's own flags come last, so they win over ours
+	if !containsRun(args, []string{"--enable-unsafe-swiftshader", "https://example.com/"}) {
+		t.Errorf("flags not last: %q", args)
+	}
+
+	// Apps whose arguments differ can't share a browser
+	info := &BrowserInfo{Name: "Chrome"}
+	if sessionKey(info, nil, nil) == sessionKey(info, nil, opts) {
+		t.Error("same session key for different options")
+	}
+	if sessionKey(info, nil, nil) != sessionKey(info, nil, &BrowserOptions{}) {
+		t.Error("different session keys for the defaults")
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Chromium-dialect browsers get a managed policy file in their profile,
+// merged on every launch from three layers, later ones winning:
+//
+//  1. defaultBrowserPolicy
+//  2. the app's browser options ("policy" in its service JSON)
+//  3. the profile's own overrides in profiles/<id>/policy.json
+//
+// Policy names are Chrome's, e.g. a kid profile might set
+// {"ForceYouTubeRestrict": 2, "IncognitoModeAvailability": 1}.
+// Dictionary policies such as ExtensionSettings merge key by key, and null
+// removes a policy set by an earlier layer.
+
+// defaultBrowserPolicy is the first layer: video plays and goes fullscreen
+// on its own, and the browser doesn't prompt about passwords, translation
+// or downloads
+func defaultBrowserPolicy(dataDir, profileID, homepage string) map[string]interface{} {
+	policy := map[string]interface{}{
+		"AutomaticFullscreenAllowedForUrls": []interface{}{"https://www.youtube.com", "https://youtube.com", "*"},
+		"AutoplayAllowed":                   true,
+		"PasswordManagerEnabled":            false,
+		"TranslateEnabled":                  false,
+		"PromptForDownloadLocation":         false,
+		"DefaultBrowserSettingEnabled":      false,
+		"PromotionalTabsEnabled":            false,
+		"BackgroundModeEnabled":             false,
+	}
+	if downloads, err := profileFile(dataDir, profileID, "downloads"); err == nil {
+		policy["DownloadDirectory"] = downloads
+	}
+	if homepage != "" {
+		policy["HomepageLocation"] = homepage
+		policy["HomepageIsNewTabPage"] = false
+	}
+	return policy
+}
+
+// mergePolicy applies overlay to base
+func mergePolicy(base, overlay map[string]interface{}) {
+	for name, value := range overlay {
+		if value == nil {
+			delete(base, name)
+			continue
+		}
+		dict, isDict := value.(map[string]interface{})
+		existing, hadDict := base[name].(map[string]interface{})
+		if isDict && hadDict {
+			merged := make(map[string]interface{}, len(existing)+len(dict))
+			for k, v := range existing {
+				merged[k] = v
+			}
+			mergePolicy(merged, dict)
+			base[name] = merged
+			continue
+		}
+		base[name] = value
+	}
+}
+
+func profilePolicyPath(dataDir, profileID string) (string, error) {
+	return profileFile(dataDir, profileID, "policy.json")
+}
+
+// LoadProfilePolicy reads a profile's policy overrides
+func LoadProfilePolicy(dataDir, profileID string) map[string]interface{} {
+	policy := map[string]interface{}{}
+	path, err := profilePolicyPath(dataDir, profileID)
+	if err != nil {
+		return policy
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return policy
+	}
+	if err := json.Unmarshal(data, &policy); err != nil {
+		Log("Failed to parse browser policy for profile %s: %v", profileID, err)
+	}
+	return policy
+}
+
+// SaveProfilePolicy replaces a profile's policy overrides
+func SaveProfilePolicy(dataDir, profileID string, policy map[string]interface{}) error {
+	path, err := profilePolicyPath(dataDir, profileID)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// browserPolicy merges the policy layers for launching url
+func browserPolicy(dataDir, profileID, url string, opts *BrowserOptions) map[string]interface{} {
+	policy := defaultBrowserPolicy(dataDir, profileID, url)
+	mergePolicy(policy, opts.policy())
+	mergePolicy(policy, LoadProfilePolicy(dataDir, profileID))
+	return policy
+}
+
+// writeBrowserPolicy writes policy where a Chromium profile reads its
+// managed policy
+func writeBrowserPolicy(profilePath string, policy map[string]interface{}) error {
+	data, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(profilePath, "policies", "managed", "launchtube.json"), data)
+}
+
+// handleBrowserPolicy shows the merged policy of a profile, for the app
+// named by ?app= if given. PUT replaces the profile's overrides with the
+// JSON object in the body; since policy can install extensions, only local
+// tools may do that, not web pages.
+func (s *Server) handleBrowserPolicy(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if s.crossOrigin(r) {
+		http.Error(w, `{"error":"Forbidden"}`, http.StatusForbidden)
+		return
+	}
+
+	profileID := r.URL.Query().Get("profile")
+	if profileID == "" {
+		http.Error(w, `{"error":"profile is required"}`, http.StatusBadRequest)
+		return
+	}
+	if !knownProfile(s.dataDir, profileID) {
+		http.Error(w, `{"error":"Unknown profile"}`, http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		var overrides map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&overrides); err != nil || overrides == nil {
+			http.Error(w, `{"error":"Body must be a JSON object"}`, http.StatusBadRequest)
+			return
+		}
+		if err := SaveProfilePolicy(s.dataDir, profileID, overrides); err != nil {
+			errJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
+			http.Error(w, string(errJSON), http.StatusInternalServerError)
+			return
+		}
+		Log("Browser policy overrides saved for profile %s", profileID)
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var url string
+	var opts *BrowserOptions
+	if name := r.URL.Query().Get("app"); name != "" {
+		found := false
+		for _, app := range s.GetAppsForProfile(profileID) {
+			if app.Name == name {
+				url, opts, found = app.URL, app.Browser, true
+				break
+			}
+		}
+		if !found {
+			http.Error(w, `{"error":"No such app"}`, http.StatusNotFound)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"policy":    browserPolicy(s.dataDir, profileID, url, opts),
+		"overrides": LoadProfilePolicy(s.dataDir, profileID),
+	})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergePolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		base, overlay map[string]interface{}
+		want          map[string]interface{}
+	}{
+		{
+			name:    "overlay wins",
+			base:    map[string]interface{}{"AutoplayAllowed": true, "TranslateEnabled": false},
+			overlay: map[string]interface{}{"AutoplayAllowed": false},
+			want:    map[string]interface{}{"AutoplayAllowed": false, "TranslateEnabled": false},
+		},
+		{
+			name:    "null deletes",
+			base:    map[string]interface{}{"HomepageLocation": "https://example.com", "TranslateEnabled": false},
+			overlay: map[string]interface{}{"HomepageLocation": nil},
+			want:    map[string]interface{}{"TranslateEnabled": false},
+		},
+		{
+			name: "dictionaries merge key by key",
+			base: map[string]interface{}{"ExtensionSettings": map[string]interface{}{
+				"a": map[string]interface{}{"installation_mode": "allowed"},
+				"b": map[string]interface{}{"installation_mode": "blocked"},
+			}},
+			overlay: map[string]interface{}{"ExtensionSettings": map[string]interface{}{
+				"b": nil,
+				"c": map[string]interface{}{"installation_mode": "blocked"},
+			}},
+			want: map[string]interface{}{"ExtensionSettings": map[string]interface{}{
+				"a": map[string]interface{}{"installation_mode": "allowed"},
+				"c": map[string]interface{}{"installation_mode": "blocked"},
+			}},
+		},
+		{
+			name:    "lists are replaced",
+			base:    map[string]interface{}{"URLBlocklist": []interface{}{"a.com"}},
+			overlay: map[string]interface{}{"URLBlocklist": []interface{}{"b.com"}},
+			want:    map[string]interface{}{"URLBlocklist": []interface{}{"b.com"}},
+		},
+	}
+	for _, tt := range tests {
+		mergePolicy(tt.base, tt.overlay)
+		if !reflect.DeepEqual(tt.base, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.base, tt.want)
+		}
+	}
+}
+
+func TestHandleBrowserPolicy(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestProfile(t, dataDir, "alice")
+	s := &Server{dataDir: dataDir, port: 8765}
+
+	tests := []struct {
+		name, method, target, origin string
+		want                         int
+	}{
+		{"local GET", "GET", "/api/1/browser/policy?profile=alice", "", http.StatusOK},
+		{"local PUT", "PUT", "/api/1/browser/policy?profile=alice", "", http.StatusOK},
+		{"same origin PUT", "PUT", "/api/1/browser/policy?profile=alice", "http://127.0.0.1:8765", http.StatusOK},
+		{"web page PUT", "PUT", "/api/1/browser/policy?profile=alice", "https://evil.example", http.StatusForbidden},
+		{"traversal", "PUT", "/api/1/browser/policy?profile=../..", "", http.StatusNotFound},
+		{"unknown profile", "GET", "/api/1/browser/policy?profile=bob", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(`{"TranslateEnabled":true}`))
+		r.Host = "127.0.0.1:8765"
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		w := httptest.NewRecorder()
+		s.handleBrowserPolicy(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d (%s)", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+
+	if got := LoadProfilePolicy(dataDir, "alice")["TranslateEnabled"]; got != true {
+		t.Errorf("saved override = %v, want true", got)
+	}
+}
+
+func TestCrossOrigin(t *testing.T) {
+	s := &Server{port: 8765, remoteHost: "192.168.1.20", remotePort: 8775}
+	tests := []struct {
+		name, host, origin, site string
+		want                     bool
+	}{
+		{"curl", "127.0.0.1:8765", "", "", false},
+		{"curl to localhost", "LOCALHOST:8765", "", "", false},
+		{"launcher page", "127.0.0.1:8765", "http://127.0.0.1:8765", "same-origin", false},
+		{"typed into the address bar", "localhost:8765", "", "none", false},
+		{"phone remote", "192.168.1.20:8775", "http://192.168.1.20:8775", "same-origin", false},
+		{"web page", "127.0.0.1:8765", "https://evil.example", "cross-site", true},
+		{"web page without Origin", "127.0.0.1:8765", "", "cross-site", true},
+		{"DNS rebinding", "evil.example:8765", "http://evil.example:8765", "same-origin", true},
+		{"DNS rebinding from curl-like fetch", "evil.example:8765", "", "", true},
+		{"another port", "127.0.0.1:9000", "", "", true},
+		{"remote address on the API port", "192.168.1.20:8765", "", "", true},
+		{"no port", "127.0.0.1", "", "", true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("PUT", "/api/1/browser/policy", nil)
+		r.Host = tt.host
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if tt.site != "" {
+			r.Header.Set("Sec-Fetch-Site", tt.site)
+		}
+		if got := s.crossOrigin(r); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"archive/zip"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Browser flag dialects
+const (
+	dialectChromium = "chromium"
+	dialectFirefox  = "firefox"
+)
+
+// How a browser loads our extensions
+const (
+	extensionsLoadFlag   = "load-extension"    // Chromium --load-extension
+	extensionsProfileDir = "profile-directory" // packed into <profile>/extensions
+	extensionsNone       = "none"
+)
+
+// How a browser keeps each LaunchTube profile separate
+const (
+	profilesUserDataDir = "user-data-dir" // Chromium --user-data-dir
+	profilesProfile     = "profile"       // Firefox -profile
+	profilesNone        = "none"
+)
+
+//go:embed browsers.json
+var defaultBrowserRegistry []byte
+
+// BrowserSpec is a browser registry entry. The built-in registry is
+// browsers.json; a browsers.json in the data or overrides directory adds
+// entries or replaces built-in ones with the same name.
+type BrowserSpec struct {
+	Name           string   `json:"name"`
+	Executables    []string `json:"executables"`              // tried in order, on PATH or absolute
+	Dialect        string   `json:"dialect"`                  // "chromium" or "firefox"
+	FullscreenFlag string   `json:"fullscreenFlag,omitempty"` // e.g. --start-fullscreen, --kiosk
+	Args           []string `json:"args,omitempty"`           // extra arguments, before the URL
+	Extensions     string   `json:"extensions,omitempty"`     // load-extension, profile-directory or none
+	Profiles       string   `json:"profiles,omitempty"`       // user-data-dir, profile or none
+	ProfileDir     string   `json:"profileDir,omitempty"`     // directory under profiles/<id>/
+	CDP            bool     `json:"cdp"`                      // supports --remote-debugging-port
+}
+
+// launchExtensions are the bundled extensions loaded into every browser
+var launchExtensions = []string{"launchtube", "ublock-origin", "dark-reader"}
+
+// loadBrowserRegistry returns the built-in browsers merged with the user's
+// browsers.json files, data directory first, then overrides
+func loadBrowserRegistry(dataDir, overridesDir string) []BrowserSpec {
+	var specs []BrowserSpec
+	if err := json.Unmarshal(defaultBrowserRegistry, &specs); err != nil {
+		Log("Failed to parse built-in browser registry: %v", err)
+	}
+
+	for _, dir := range []string{dataDir, overridesDir} {
+		if dir == "" {
+			continue
+		}
+		path := filepath.Join(dir, "browsers.json")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var user []BrowserSpec
+		if err := json.Unmarshal(data, &user); err != nil {
+			Log("Failed to parse %s: %v", path, err)
+			continue
+		}
+		specs = mergeBrowserSpecs(specs, user)
+	}
+	return specs
+}
+
+func mergeBrowserSpecs(specs, user []BrowserSpec) []BrowserSpec {
+	for _, u := range user {
+		if u.Name == "" || len(u.Executables) == 0 {
+			continue
+		}
+		replaced := false
+		for i := range specs {
+			if strings.EqualFold(specs[i].Name, u.Name) {
+				specs[i] = u
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			specs = append(specs, u)
+		}
+	}
+	return specs
+}
+
+// detect returns the first installed executable of the spec
+func (spec BrowserSpec) detect() string {
+	return findExecutable(spec.Executables)
+}
+
+// profilePath is the browser's profile directory for a LaunchTube profile,
+// or "" when the browser isn't given one or the profile doesn't exist
+func (spec BrowserSpec) profilePath(dataDir, profileID string) string {
+	if profileID == "" || spec.Profiles == profilesNone {
+		return ""
+	}
+	dir := spec.ProfileDir
+	if dir == "" {
+		dir = strings.ToLower(spec.Name)
+	}
+	path, err := profileFile(dataDir, profileID, dir)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// chromiumFlags are passed to every Chromium-dialect browser
+var chromiumFlags = []string{
+	"--disable-infobars",
+	"--autoplay-policy=no-user-gesture-required",
+	"--hide-crash-restore-bubble",
+	"--disable-features=MediaRouter,GlobalMediaControls,LocalNetworkAccessChecks",
+	"--disable-device-discovery-notifications",
+	"--disable-notifications",
+	"--disable-sync",
+	"--no-first-run",
+	"--disable-default-apps",
+	"--enable-features=AutomaticFullscreenContentSetting",
+}
+
+// firefoxPrefs go into user.js of LaunchTube's Firefox profiles. Unsigned
+// extensions only install on builds that honor
+// xpinstall.signatures.required (ESR, Developer Edition, Nightly).
+var firefoxPrefs = map[string]interface{}{
+	"browser.shell.checkDefaultBrowser":                false,
+	"browser.aboutwelcome.enabled":                     false,
+	"browser.startup.homepage_override.mstone":         "ignore",
+	"browser.sessionstore.resume_from_crash":           false,
+	"datareporting.policy.dataSubmissionEnabled":       false,
+	"toolkit.telemetry.reportingpolicy.firstRun":       false,
+	"media.autoplay.default":                           0,
+	"media.autoplay.blocking_policy":                   0,
+	"full-screen-api.warning.timeout":                  0,
+	"full-screen-api.allow-trusted-requests-only":      false,
+	"extensions.autoDisableScopes":                     0,
+	"extensions.enabledScopes":                         15,
+	"xpinstall.signatures.required":                    false,
+	"permissions.default.desktop-notification":         2,
+	"dom.disable_open_during_load":                     true,
+	"browser.tabs.warnOnClose":                         false,
+	"browser.warnOnQuit":                               false,
+	"signon.rememberSignons":                           true,
+	"media.eme.enabled":                                true,
+	"media.gmp-widevinecdm.enabled":                    true,
+	"media.gmp-widevinecdm.visible":                    true,
+	"browser.translations.automaticallyPopup":          false,
+	"browser.newtabpage.activity-stream.showSponsored": false,
+}
+
+// writeFirefoxPrefs writes user.js, which Firefox applies on every start
+func writeFirefoxPrefs(profilePath string, opts *BrowserOptions) error {
+	prefs := make(map[string]interface{})
+	for name, value := range firefoxPrefs {
+		prefs[name] = value
+	}
+	for name, value := range opts.firefoxOptionPrefs() {
+		prefs[name] = value
+	}
+
+	// Firefox copies user.js into prefs.js, so an override this app doesn't
+	// want has to be taken out of there too
+	if _, ok := prefs["general.useragent.override"]; !ok {
+		removeFirefoxPref(profilePath, "general.useragent.override")
+	}
+
+	var b strings.Builder
+	b.WriteString("// Written by LaunchTube on every launch\n")
+	for name, value := range prefs {
+		encoded, _ := json.Marshal(value)
+		fmt.Fprintf(&b, "user_pref(%q, %s);\n", name, encoded)
+	}
+	return os.WriteFile(filepath.Join(profilePath, "user.js"), []byte(b.String()), 0644)
+}
+
+// removeFirefoxPref deletes a saved pref from the profile's prefs.js
+func removeFirefoxPref(profilePath, name string) {
+	path := filepath.Join(profilePath, "prefs.js")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	prefix := fmt.Sprintf("user_pref(%q,", name)
+	lines := strings.Split(string(data), "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if !strings.HasPrefix(line, prefix) {
+			kept = append(kept, line)
+		}
+	}
+	if len(kept) != len(lines) {
+		os.WriteFile(path, []byte(strings.Join(kept, "\n")), 0644)
+	}
+}
+
+// installFirefoxExtension packs an unpacked extension directory into
+// <profile>/extensions/<id>.xpi. The manifest gets a gecko ID if it has
+// none, and a service worker background becomes a background script, which
+// is what Firefox runs for Manifest V3.
+func installFirefoxExtension(profilePath, name, extDir string) error {
+	manifestData, err := os.ReadFile(filepath.Join(extDir, "manifest.json"))
+	if err != nil {
+		return err
+	}
+	var manifest map[string]interface{}
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return fmt.Errorf("bad manifest: %w", err)
+	}
+
+	id := firefoxExtensionID(manifest, name)
+	if bg, ok := manifest["background"].(map[string]interface{}); ok {
+		if sw, ok := bg["service_worker"].(string); ok && bg["scripts"] == nil {
+			bg["scripts"] = []string{sw}
+			delete(bg, "service_worker")
+		}
+	}
+	manifestData, err = json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	extensionsDir := filepath.Join(profilePath, "extensions")
+	if err := os.MkdirAll(extensionsDir, 0755); err != nil {
+		return err
+	}
+	xpiPath := filepath.Join(extensionsDir, id+".xpi")
+
+	// Repack only when the source changed since the last install
+	if xpiInfo, err := os.Stat(xpiPath); err == nil && !dirModifiedSince(extDir, xpiInfo.ModTime().Unix()) {
+		return nil
+	}
+
+	tmp := xpiPath + ".tmp"
+	if err := packExtension(tmp, extDir, manifestData); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	Log("Installed %s into Firefox profile as %s", name, id)
+	return os.Rename(tmp, xpiPath)
+}
+
+// removeFirefoxExtension uninstalls an extension installFirefoxExtension put
+// into the profile, for apps that don't want it
+func removeFirefoxExtension(profilePath, name, extDir string) {
+	manifestData, err := os.ReadFile(filepath.Join(extDir, "manifest.json"))
+	if err != nil {
+		return
+	}
+	var manifest map[string]interface{}
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return
+	}
+	id := firefoxExtensionID(manifest, name)
+	os.Remove(filepath.Join(profilePath, "extensions", id+".xpi"))
+}
+
+func firefoxExtensionID(manifest map[string]interface{}, name string) string {
+	for _, key := range []string{"browser_specific_settings", "applications"} {
+		if settings, ok := manifest[key].(map[string]interface{}); ok {
+			if gecko, ok := settings["gecko"].(map[string]interface{}); ok {
+				if id, ok := gecko["id"].(string); ok && id != "" {
+					return id
+				}
+			}
+		}
+	}
+
+	id := name + "@launchtube"
+	manifest["browser_specific_settings"] = map[string]interface{}{
+		"gecko": map[string]interface{}{"id": id},
+	}
+	return id
+}
+
+func dirModifiedSince(dir string, since int64) bool {
+	modified := false
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || modified {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().Unix() > since {
+			modified = true
+		}
+		return nil
+	})
+	return modified
+}
+
+// packExtension zips extDir into path, with manifest.json replaced
+func packExtension(path, extDir string, manifest []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	err = filepath.WalkDir(extDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(extDir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		w, err := zw.Create(rel)
+		if err != nil {
+			return err
+		}
+		if rel == "manifest.json" {
+			_, err = w.Write(manifest)
+			return err
+		}
+		src, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(w, src)
+		return err
+	})
+	if err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// browserArgs builds the command line for spec, preparing the profile
+// directory as its dialect needs. extensions maps the extensions to load to
+// their directories. devtoolsPort is used when spec supports CDP; 0 lets the
+// browser pick one and report it in DevToolsActivePort.
+func (bm *BrowserManager) browserArgs(spec BrowserSpec, url, profileID string, extensions map[string]string, devtoolsPort int, opts *BrowserOptions) []string {
+	var args []string
+
+	profilePath := spec.profilePath(bm.dataDir, profileID)
+	if profilePath != "" {
+		os.MkdirAll(profilePath, 0755)
+	}
+
+	switch spec.Dialect {
+	case dialectFirefox:
+		if profilePath != "" {
+			args = append(args, "-profile", profilePath, "-no-remote")
+			if err := writeFirefoxPrefs(profilePath, opts); err != nil {
+				Log("Failed to write Firefox prefs: %v", err)
+			}
+		}
+		if spec.Extensions == extensionsProfileDir && profilePath != "" {
+			for _, name := range launchExtensions {
+				if dir, ok := extensions[name]; ok {
+					if err := installFirefoxExtension(profilePath, name, dir); err != nil {
+						Log("Failed to install %s into Firefox profile: %v", name, err)
+					}
+				} else if dir := bm.findExtension(name); dir != "" {
+					removeFirefoxExtension(profilePath, name, dir)
+				}
+			}
+		}
+
+	default:
+		if profilePath != "" && spec.Profiles != profilesProfile {
+			args = append(args, "--user-data-dir="+profilePath)
+
+			// Clear service worker cache if our extension has been updated
+			bm.clearStaleServiceWorkerCache(profilePath)
+
+			// Managed policy: the defaults, the app's and the profile's
+			if err := writeBrowserPolicy(profilePath, browserPolicy(bm.dataDir, profileID, url, opts)); err != nil {
+				Log("Failed to write browser policy: %v", err)
+			}
+		}
+		if spec.Extensions != extensionsNone {
+			var dirs []string
+			for _, name := range launchExtensions {
+				if dir, ok := extensions[name]; ok {
+					dirs = append(dirs, dir)
+				}
+			}
+			if len(dirs) > 0 {
+				args = append(args, "--load-extension="+strings.Join(dirs, ","))
+			}
+		}
+		args = append(args, chromiumFlags...)
+		args = append(args, opts.chromiumOptionFlags()...)
+		if spec.CDP {
+			args = append(args, fmt.Sprintf("--remote-debugging-port=%d", devtoolsPort))
+		}
+	}
+
+	if spec.FullscreenFlag != "" {
+		args = append(args, spec.FullscreenFlag)
+	}
+	args = append(args, spec.Args...)
+	args = append(args, opts.flags()...)
+	return append(args, url)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func findSpec(specs []BrowserSpec, name string) (BrowserSpec, bool) {
+	for _, spec := range specs {
+		if spec.Name == name {
+			return spec, true
+		}
+	}
+	return BrowserSpec{}, false
+}
+
+func TestLoadBrowserRegistry(t *testing.T) {
+	dataDir, overridesDir := t.TempDir(), t.TempDir()
+	builtin := loadBrowserRegistry("", "")
+	if _, ok := findSpec(builtin, "Firefox"); !ok || len(builtin) == 0 {
+		t.Fatalf("built-in registry %+v", builtin)
+	}
+
+	os.WriteFile(filepath.Join(dataDir, "browsers.json"), []byte(`[
+		{"name": "chrome", "executables": ["/opt/chrome/chrome"], "dialect": "chromium", "cdp": true},
+		{"name": "Thorium", "executables": ["thorium"], "dialect": "chromium"},
+		{"name": "Nothing to run"}
+	]`), 0644)
+	os.WriteFile(filepath.Join(overridesDir, "browsers.json"), []byte(`[
+		{"name": "Thorium", "executables": ["/usr/local/bin/thorium"], "dialect": "chromium"}
+	]`), 0644)
+	specs := loadBrowserRegistry(dataDir, overridesDir)
+
+	// Names match case-insensitively and the user's entry replaces the
+	// built-in one in place
+	if len(specs) != len(builtin)+1 || specs[0].Name != "chrome" || specs[0].Executables[0] != "/opt/chrome/chrome" {
+		t.Errorf("chrome not replaced: %+v", specs)
+	}
+	if _, ok := findSpec(specs, "Nothing to run"); ok {
+		t.Error("an entry without executables was added")
+	}
+	// The overrides directory wins over the data directory
+	if thorium := specs[len(specs)-1]; thorium.Name != "Thorium" || thorium.Executables[0] != "/usr/local/bin/thorium" {
+		t.Errorf("last entry %+v", thorium)
+	}
+
+	// A broken file is skipped
+	os.WriteFile(filepath.Join(dataDir, "browsers.json"), []byte(`[{`), 0644)
+	if specs := loadBrowserRegistry(dataDir, ""); len(specs) != len(builtin) {
+		t.Errorf("broken browsers.json changed the registry: %+v", specs)
+	}
+}
+
+func TestBrowserProfilePath(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestProfile(t, dataDir, "alice")
+	tests := []struct {
+		spec      BrowserSpec
+		profileID string
+		want      string
+	}{
+		{BrowserSpec{Name: "Chrome", ProfileDir: "chrome"}, "alice", filepath.Join(dataDir, "profiles", "alice", "chrome")},
+		{BrowserSpec{Name: "Thorium"}, "alice", filepath.Join(dataDir, "profiles", "alice", "thorium")},
+		{BrowserSpec{Name: "Chrome", Profiles: profilesNone}, "alice", ""},
+		{BrowserSpec{Name: "Chrome"}, "", ""},
+		{BrowserSpec{Name: "Chrome"}, "bob", ""},
+		{BrowserSpec{Name: "Chrome"}, "../alice", ""},
+	}
+	for _, tt := range tests {
+		if got := tt.spec.profilePath(dataDir, tt.profileID); got != tt.want {
+			t.Errorf("%s for %q: got %q, want %q", tt.spec.Name, tt.profileID, got, tt.want)
+		}
+	}
+}
+
+func TestWriteFirefoxPrefs(t *testing.T) {
+	profile := t.TempDir()
+	prefsJS := filepath.Join(profile, "prefs.js")
+	os.WriteFile(prefsJS, []byte("user_pref(\"general.useragent.override\", \"Old/1\");\nuser_pref(\"browser.startup.page\", 3);\n"), 0644)
+
+	if err := writeFirefoxPrefs(profile, nil); err != nil {
+		t.Fatal(err)
+	}
+	userJS, _ := os.ReadFile(filepath.Join(profile, "user.js"))
+	for _, want := range []string{
+		`user_pref("xpinstall.signatures.required", false);`,
+		`user_pref("media.autoplay.default", 0);`,
+	} {
+		if !strings.Contains(string(userJS), want) {
+			t.Errorf("user.js lacks %s", want)
+		}
+	}
+	// The override the app doesn't want any more is gone; other prefs stay
+	if prefs, _ := os.ReadFile(prefsJS); string(prefs) != "user_pref(\"browser.startup.page\", 3);\n" {
+		t.Errorf("prefs.js is %q", prefs)
+	}
+
+	if err := writeFirefoxPrefs(profile, &BrowserOptions{UserAgent: "Tube/2"}); err != nil {
+		t.Fatal(err)
+	}
+	userJS, _ = os.ReadFile(filepath.Join(profile, "user.js"))
+	if !strings.Contains(string(userJS), `user_pref("general.useragent.override", "Tube/2");`) {
+		t.Errorf("user.js lacks the user agent:\n%s", userJS)
+	}
+}
+
+func TestBrowserArgs(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestProfile(t, dataDir, "alice")
+	bm := NewBrowserManager("", t.TempDir(), dataDir)
+	specs := loadBrowserRegistry("", "")
+	extensions := map[string]string{"launchtube": "/ext/launchtube", "dark-reader": "/ext/dark-reader"}
+
+	chrome, _ := findSpec(specs, "Chrome")
+	args := bm.browserArgs(chrome, "https://example.com/", "alice", extensions, 9333, nil)
+	profile := filepath.Join(dataDir, "profiles", "alice", "chrome")
+	for _, want := range []string{
+		"--user-data-dir=" + profile,
+		"--load-extension=/ext/launchtube,/ext/dark-reader",
+		"--remote-debugging-port=9333",
+		"--start-fullscreen",
+	} {
+		if !containsRun(args, []string{want}) {
+			t.Errorf("chrome args %q lack %q", args, want)
+		}
+	}
+	if args[len(args)-1] != "https://example.com/" {
+		t.Errorf("chrome args don't end with the URL: %q", args)
+	}
+
+	// Firefox gets its own profile, prefs and packed extensions
+	extDir := t.TempDir()
+	os.WriteFile(filepath.Join(extDir, "manifest.json"), []byte(`{"manifest_version": 3, "background": {"service_worker": "bg.js"}}`), 0644)
+	firefox, _ := findSpec(specs, "Firefox")
+	args = bm.browserArgs(firefox, "https://example.com/", "alice", map[string]string{"launchtube": extDir}, 0, nil)
+	profile = filepath.Join(dataDir, "profiles", "alice", "firefox")
+	want := []string{"-profile", profile, "-no-remote", "--kiosk", "https://example.com/"}
+	if !containsRun(args, want) {
+		t.Errorf("firefox args %q, want %q", args, want)
+	}
+	if _, err := os.Stat(filepath.Join(profile, "user.js")); err != nil {
+		t.Errorf("no user.js: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(profile, "extensions", "launchtube@launchtube.xpi")); err != nil {
+		t.Errorf("extension not installed: %v", err)
+	}
+}
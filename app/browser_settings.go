@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// BrowserSettings are a profile's browser preferences, stored in
+// profiles/<id>/browser.json
+type BrowserSettings struct {
+	// WarmTabs keeps the profile's browser running in the background with
+	// up to this many app tabs, so going back to an app switches tabs
+	// instead of starting the browser again. 0 closes the browser with the
+	// app. Needs a browser with DevTools (Chromium based).
+	WarmTabs int `json:"warmTabs,omitempty"`
+}
+
+func browserSettingsPath(dataDir, profileID string) (string, error) {
+	return profileFile(dataDir, profileID, "browser.json")
+}
+
+// LoadBrowserSettings reads a profile's browser settings, falling back to
+// defaults when the profile has none
+func LoadBrowserSettings(dataDir, profileID string) BrowserSettings {
+	var settings BrowserSettings
+	if profileID == "" {
+		return settings
+	}
+
+	path, err := browserSettingsPath(dataDir, profileID)
+	if err != nil {
+		return settings
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return settings
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		Log("Failed to parse browser settings for profile %s: %v", profileID, err)
+	}
+	return settings
+}
+
+// SaveBrowserSettings writes a profile's browser settings
+func SaveBrowserSettings(dataDir, profileID string, settings BrowserSettings) error {
+	if profileID == "" {
+		return fmt.Errorf("no profile selected")
+	}
+
+	path, err := browserSettingsPath(dataDir, profileID)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// serverPort returns the port a test server listens on
+func serverPort(srv *httptest.Server) int {
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+func TestCurrentPageSkipsWarmTabs(t *testing.T) {
+	devtools := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]CDPTarget{
+			{ID: "warm", Type: "page", URL: "https://www.youtube.com/"},
+			{ID: "worker", Type: "service_worker", URL: "https://tv.example/sw.js"},
+			{ID: "shown", Type: "page", URL: "https://tv.example/home"},
+		})
+	}))
+	defer devtools.Close()
+	port := serverPort(devtools)
+
+	bm := NewBrowserManager("", "", t.TempDir())
+	if _, err := bm.CurrentURL(); err != errCDPUnavailable {
+		t.Errorf("no browser: got %v, want errCDPUnavailable", err)
+	}
+
+	bm.active = &browserSession{port: port, tabs: []warmTab{
+		{url: "https://www.youtube.com/", targetID: "warm"},
+		{url: "https://tv.example/", targetID: "shown"},
+	}}
+	if url, err := bm.CurrentURL(); err != nil || url != "https://tv.example/home" {
+		t.Errorf("CurrentURL() = %q, %v, want the app's tab", url, err)
+	}
+	if _, err := bm.Evaluate("youtube.com", "1"); err == nil {
+		t.Error("Evaluate reached the warm youtube.com tab")
+	}
+
+	bm.active.tabs = []warmTab{{url: "https://tv.example/"}}
+	if url, _ := bm.CurrentURL(); url != "https://www.youtube.com/" {
+		t.Errorf("before the tab is known, CurrentURL() = %q, want the first page", url)
+	}
+}
+
+func TestReloadPageUsesIncidentSession(t *testing.T) {
+	reloaded := make(chan string, 1)
+	upgrader := websocket.Upgrader{}
+	devtools := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var req struct {
+			ID     int64  `json:"id"`
+			Method string `json:"method"`
+		}
+		if conn.ReadJSON(&req) == nil {
+			reloaded <- r.URL.Path + " " + req.Method
+			conn.WriteJSON(map[string]interface{}{"id": req.ID, "result": map[string]interface{}{}})
+		}
+	}))
+	defer devtools.Close()
+
+	// The browser on screen has moved on; the reload still goes to the
+	// session the incident happened in
+	bm := NewBrowserManager("", "", t.TempDir())
+	c := NewCDPClient()
+	c.SetPort(serverPort(devtools))
+	if err := bm.ReloadPage(BrowserIncident{TargetID: "tab1", client: c}); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-reloaded; got != "/devtools/page/tab1 Page.reload" {
+		t.Errorf("reloaded %q", got)
+	}
+
+	if err := bm.ReloadPage(BrowserIncident{TargetID: "tab1"}); err != errCDPUnavailable {
+		t.Errorf("no client: got %v, want errCDPUnavailable", err)
+	}
+}
+
+var (
+	_ Browser = (*BrowserManager)(nil)
+	_ Browser = (*CDPBrowser)(nil)
+)
+
+// fakeBrowser is a running Browser that only records being closed
+type fakeBrowser struct {
+	closed bool
+}
+
+func (f *fakeBrowser) Launch(string, string, string, *BrowserOptions) error { return nil }
+func (f *fakeBrowser) Close()                                               { f.closed = true }
+func (f *fakeBrowser) IsRunning() bool                                      { return !f.closed }
+func (f *fakeBrowser) PID() int                                             { return 0 }
+func (f *fakeBrowser) SetOnExit(func())                                     {}
+func (f *fakeBrowser) Navigate(string) error                                { return nil }
+func (f *fakeBrowser) Evaluate(string, string) (interface{}, error)         { return nil, nil }
+func (f *fakeBrowser) CurrentURL() (string, error)                          { return "", nil }
+func (f *fakeBrowser) Screenshot() ([]byte, error)                          { return nil, nil }
+func (f *fakeBrowser) SendKeyToPage(string, string, string) error           { return nil }
+func (f *fakeBrowser) ClickElement(string, string) error                    { return nil }
+func (f *fakeBrowser) TypeText(string, string) error                        { return nil }
+
+func TestBrowserOptionsMode(t *testing.T) {
+	tests := []struct {
+		opts *BrowserOptions
+		def  string
+		want string
+	}{
+		{nil, browserModeExtension, browserModeExtension},
+		{nil, browserModeCDP, browserModeCDP},
+		{&BrowserOptions{}, browserModeCDP, browserModeCDP},
+		{&BrowserOptions{Mode: browserModeCDP}, browserModeExtension, browserModeCDP},
+		{&BrowserOptions{Mode: browserModeExtension}, browserModeCDP, browserModeExtension},
+		{&BrowserOptions{Mode: "chromedp"}, browserModeExtension, browserModeExtension},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.mode(tt.def); got != tt.want {
+			t.Errorf("%+v with default %s: got %s, want %s", tt.opts, tt.def, got, tt.want)
+		}
+	}
+}
+
+func TestLaunchBrowserReplacesOtherMode(t *testing.T) {
+	// No browser on PATH, so the launch itself fails after the switch
+	t.Setenv("PATH", t.TempDir())
+	dataDir := t.TempDir()
+	previous := &fakeBrowser{}
+	s := &Server{
+		browserMgr:  NewBrowserManager("", t.TempDir(), dataDir),
+		cdpBrowser:  NewCDPBrowser(t.TempDir(), dataDir, 0),
+		browserMode: browserModeCDP,
+		browser:     previous,
+	}
+
+	app := AppConfig{URL: "https://example.com/", Browser: &BrowserOptions{Mode: browserModeExtension}}
+	if err := s.LaunchBrowser("Chrome", "alice", app); err == nil {
+		t.Fatal("launched without a browser")
+	}
+	if s.ActiveBrowser() != Browser(s.browserMgr) {
+		t.Errorf("active browser %T, want the extension-mode BrowserManager", s.ActiveBrowser())
+	}
+	if !previous.closed {
+		t.Error("the other mode's browser was left running")
+	}
+
+	w := httptest.NewRecorder()
+	s.handleBrowserStatus(w, httptest.NewRequest("GET", "/api/1/browser/status", nil))
+	var status map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &status)
+	if status["mode"] != browserModeExtension || status["running"] != false {
+		t.Errorf("status %v", status)
+	}
+}
+
+func TestBrowserSessionSharesClient(t *testing.T) {
+	sess := &browserSession{}
+	c := sess.client()
+	if c.Available() {
+		t.Error("client available before the browser reported its port")
+	}
+	sess.port = 9333
+	if sess.client() != c || c.Port() != 9333 {
+		t.Errorf("client %p port %d, want %p on 9333", sess.client(), c.Port(), c)
+	}
+}
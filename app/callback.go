@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Player callbacks (onComplete, onProgress) are HTTP requests described by
+// the page script that started playback:
+//
+//	{
+//	  "url": "https://host/Sessions/Playing/Progress?item=${itemId}",
+//	  "method": "POST",
+//	  "headers": {"Authorization": "..."},
+//	  "bodyTemplate": {"PositionTicks": "${positionTicks}", "IsPaused": "${isPaused}"}
+//	}
+//
+// ${name} is replaced in the url, header values and anywhere in the body,
+// always as text: "${positionTicks}" is sent as a JSON string, as it always
+// has been. For the variable's own type, so numbers and booleans stay JSON
+// numbers and booleans, put an object with a single "$var" key in the body:
+//
+//	"bodyTemplate": {"positionMs": {"$var": "positionMs"}, "paused": {"$var": "isPaused"}}
+
+var callbackVarPattern = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// CallbackVars are the values a callback template can reference
+type CallbackVars map[string]interface{}
+
+// CallbackError records the most recent callback that failed
+type CallbackError struct {
+	Event      string    `json:"event"`
+	URL        string    `json:"url"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error"`
+	Time       time.Time `json:"time"`
+}
+
+// newCallbackVars builds the template variables for a player event
+func newCallbackVars(event, state string, position, duration float64, paused bool) CallbackVars {
+	now := time.Now()
+	percent := 0.0
+	if duration > 0 {
+		percent = position / duration * 100
+	}
+
+	return CallbackVars{
+		"event":           event,
+		"state":           state,
+		"position":        position,
+		"positionSeconds": int64(position),
+		"positionMs":      int64(position * 1000),
+		"positionTicks":   int64(position * 10000000),
+		"duration":        duration,
+		"durationSeconds": int64(duration),
+		"durationMs":      int64(duration * 1000),
+		"durationTicks":   int64(duration * 10000000),
+		"percent":         percent,
+		"isPaused":        paused,
+		"timestamp":       now.Unix(),
+		"timestampMs":     now.UnixMilli(),
+		"timestampIso":    now.UTC().Format(time.RFC3339),
+	}
+}
+
+// renderTemplateValue substitutes variables throughout a JSON value
+func renderTemplateValue(v interface{}, vars CallbackVars) interface{} {
+	switch t := v.(type) {
+	case string:
+		return interpolateTemplate(t, vars, nil)
+	case map[string]interface{}:
+		if name, ok := t["$var"].(string); ok && len(t) == 1 {
+			if val, ok := vars[name]; ok {
+				return val
+			}
+			return t
+		}
+		out := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			out[k] = renderTemplateValue(val, vars)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, val := range t {
+			out[i] = renderTemplateValue(val, vars)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// interpolateTemplate replaces each ${name} in s with its value as text.
+// Unknown variables are left as they are.
+func interpolateTemplate(s string, vars CallbackVars, escape func(string) string) string {
+	return callbackVarPattern.ReplaceAllStringFunc(s, func(match string) string {
+		val, ok := vars[match[2:len(match)-1]]
+		if !ok {
+			return match
+		}
+		text := formatCallbackVar(val)
+		if escape != nil {
+			text = escape(text)
+		}
+		return text
+	})
+}
+
+func formatCallbackVar(v interface{}) string {
+	switch t := v.(type) {
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+// sendCallback renders a callback with vars and sends it. A transport error
+// or a non-2xx response is returned as a failure.
+func sendCallback(callback map[string]interface{}, vars CallbackVars) (int, error) {
+	rawURL, _ := callback["url"].(string)
+	method, _ := callback["method"].(string)
+	headers, _ := callback["headers"].(map[string]interface{})
+
+	if rawURL == "" || method == "" {
+		return 0, nil
+	}
+
+	targetURL := interpolateTemplate(rawURL, vars, url.QueryEscape)
+
+	var body interface{} = map[string]interface{}{}
+	if bodyTemplate, ok := callback["bodyTemplate"]; ok && bodyTemplate != nil {
+		body = renderTemplateValue(bodyTemplate, vars)
+	}
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(method, targetURL, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		if s, ok := v.(string); ok {
+			req.Header.Set(k, interpolateTemplate(s, vars, nil))
+		}
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("%s %s: %s", method, targetURL, resp.Status)
+	}
+	return resp.StatusCode, nil
+}
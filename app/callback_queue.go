@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	callbackRetryMin   = 5 * time.Second
+	callbackRetryMax   = 10 * time.Minute
+	callbackMaxAge     = 24 * time.Hour
+	callbackRecentSize = 20
+)
+
+// QueuedCallback is a rendered callback waiting to be delivered
+type QueuedCallback struct {
+	ID          string                 `json:"id"`
+	Event       string                 `json:"event"`
+	Key         string                 `json:"key"`
+	Callback    map[string]interface{} `json:"callback"`
+	Vars        CallbackVars           `json:"vars"`
+	Created     time.Time              `json:"created"`
+	Attempts    int                    `json:"attempts"`
+	NextAttempt time.Time              `json:"nextAttempt"`
+	LastStatus  int                    `json:"lastStatus,omitempty"`
+	LastError   string                 `json:"lastError,omitempty"`
+	Outcome     string                 `json:"outcome,omitempty"` // delivered or dropped
+}
+
+// CallbackQueue delivers player callbacks in order, retrying with backoff
+// until the receiving server answers. The queue is kept in callbacks.json so
+// a "stopped at" report survives a launcher restart. Only the newest
+// progress callback per item is kept, since older ones are obsolete.
+type CallbackQueue struct {
+	mu        sync.Mutex
+	path      string
+	pending   []*QueuedCallback
+	recent    []QueuedCallback // delivered or dropped, newest first
+	lastError *CallbackError
+	nextID    int64
+	wake      chan struct{}
+	saveReq   chan struct{} // see scheduleSave
+	closing   chan struct{} // closed by Close
+	closeOnce sync.Once
+	workers   sync.WaitGroup
+}
+
+func NewCallbackQueue(dataDir string) *CallbackQueue {
+	q := &CallbackQueue{
+		path:    filepath.Join(dataDir, "callbacks.json"),
+		wake:    make(chan struct{}, 1),
+		saveReq: make(chan struct{}, 1),
+		closing: make(chan struct{}),
+	}
+	q.load()
+	q.workers.Add(2)
+	go q.run()
+	go q.saver()
+	return q
+}
+
+// Close stops delivering callbacks, waiting for a delivery in progress,
+// and saves what is still pending for the next start
+func (q *CallbackQueue) Close() {
+	q.closeOnce.Do(func() {
+		close(q.closing)
+		q.workers.Wait()
+		q.save()
+	})
+}
+
+func (q *CallbackQueue) load() {
+	data, err := os.ReadFile(q.path)
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(data, &q.pending); err != nil {
+		// Keep the file for a look by hand rather than losing the callbacks
+		aside := fmt.Sprintf("%s.corrupt-%d", q.path, time.Now().Unix())
+		if renameErr := os.Rename(q.path, aside); renameErr != nil {
+			Log("CallbackQueue: failed to parse %s: %v (and can't move it aside: %v)", q.path, err, renameErr)
+		} else {
+			Log("CallbackQueue: failed to parse %s: %v, moved it to %s", q.path, err, aside)
+		}
+		q.pending = nil
+		return
+	}
+	if len(q.pending) > 0 {
+		Log("CallbackQueue: loaded %d pending callbacks", len(q.pending))
+	}
+}
+
+// scheduleSave has the saver write the pending callbacks to disk. It
+// doesn't wait for the disk, so it is fine to call with q.mu held, and
+// with the player's lock held by Enqueue's callers.
+func (q *CallbackQueue) scheduleSave() {
+	select {
+	case q.saveReq <- struct{}{}:
+	default:
+	}
+}
+
+// saver writes callbacks.json after each change, off every lock. Changes
+// made while a write is in progress are written together by the next one.
+func (q *CallbackQueue) saver() {
+	defer q.workers.Done()
+	for {
+		select {
+		case <-q.closing:
+			return
+		case <-q.saveReq:
+			q.save()
+		}
+	}
+}
+
+// save writes the pending callbacks to callbacks.json
+func (q *CallbackQueue) save() {
+	q.mu.Lock()
+	data, err := json.MarshalIndent(q.pending, "", "  ")
+	q.mu.Unlock()
+	if err != nil {
+		return
+	}
+	if err := writeFileAtomic(q.path, data); err != nil {
+		Log("CallbackQueue: failed to save %s: %v", q.path, err)
+	}
+}
+
+// Enqueue schedules a callback for delivery. key identifies the item the
+// callback is about; a progress callback replaces any undelivered progress
+// callback for the same item.
+func (q *CallbackQueue) Enqueue(event, key string, callback map[string]interface{}, vars CallbackVars) {
+	if callback == nil {
+		return
+	}
+	if u, _ := callback["url"].(string); u == "" {
+		return
+	}
+
+	q.mu.Lock()
+	if event == "progress" {
+		kept := q.pending[:0]
+		for _, c := range q.pending {
+			if c.Event == "progress" && c.Key == key {
+				continue
+			}
+			kept = append(kept, c)
+		}
+		q.pending = kept
+	}
+
+	q.nextID++
+	now := time.Now()
+	q.pending = append(q.pending, &QueuedCallback{
+		ID:          fmt.Sprintf("%d-%d", now.UnixNano(), q.nextID),
+		Event:       event,
+		Key:         key,
+		Callback:    callback,
+		Vars:        vars,
+		Created:     now,
+		NextAttempt: now,
+	})
+	q.scheduleSave()
+	q.mu.Unlock()
+
+	q.notify()
+}
+
+func (q *CallbackQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers due callbacks, one at a time, until the queue is closed
+func (q *CallbackQueue) run() {
+	defer q.workers.Done()
+	for {
+		select {
+		case <-q.closing:
+			return
+		default:
+		}
+
+		c, wait := q.next()
+		if c == nil {
+			timer := time.NewTimer(wait)
+			select {
+			case <-q.closing:
+			case <-q.wake:
+			case <-timer.C:
+			}
+			timer.Stop()
+			continue
+		}
+
+		status, err := sendCallback(c.Callback, c.Vars)
+		q.finish(c, status, err)
+	}
+}
+
+// next returns the first callback that is due, or how long to wait for one.
+// A callback waits while an earlier one for the same item is undelivered, so
+// a server never sees "stopped" before the progress that preceded it.
+func (q *CallbackQueue) next() (*QueuedCallback, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	wait := time.Hour
+	blocked := make(map[string]bool)
+	for _, c := range q.pending {
+		if blocked[c.Key] {
+			continue
+		}
+		blocked[c.Key] = true
+		if !c.NextAttempt.After(now) {
+			return c, 0
+		}
+		if d := c.NextAttempt.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	return nil, wait
+}
+
+// finish records the outcome of a delivery attempt
+func (q *CallbackQueue) finish(c *QueuedCallback, status int, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	c.Attempts++
+	c.LastStatus = status
+	if err == nil {
+		c.LastError = ""
+		q.remove(c, "delivered")
+		return
+	}
+
+	c.LastError = err.Error()
+	q.lastError = &CallbackError{
+		Event:      c.Event,
+		URL:        fmt.Sprint(c.Callback["url"]),
+		StatusCode: status,
+		Error:      c.LastError,
+		Time:       time.Now(),
+	}
+
+	// A 4xx other than timeout/rate limiting won't get better by retrying
+	permanent := status >= 400 && status < 500 && status != 408 && status != 429
+	if permanent || time.Since(c.Created) > callbackMaxAge {
+		Log("CallbackQueue: dropping %s callback after %d attempts: %v", c.Event, c.Attempts, err)
+		q.remove(c, "dropped")
+		return
+	}
+
+	backoff := callbackBackoff(c.Attempts)
+	c.NextAttempt = time.Now().Add(backoff)
+	Log("CallbackQueue: %s callback failed (attempt %d), retrying in %v: %v", c.Event, c.Attempts, backoff, err)
+	q.scheduleSave()
+}
+
+// callbackBackoff is how long to wait before the next attempt after
+// attempts failed ones: doubling from callbackRetryMin up to
+// callbackRetryMax
+func callbackBackoff(attempts int) time.Duration {
+	backoff := callbackRetryMin
+	for i := 1; i < attempts && backoff < callbackRetryMax; i++ {
+		backoff *= 2
+	}
+	if backoff > callbackRetryMax {
+		backoff = callbackRetryMax
+	}
+	return backoff
+}
+
+// remove takes c off the queue and keeps it in the recent list. Must be
+// called with q.mu held.
+func (q *CallbackQueue) remove(c *QueuedCallback, outcome string) {
+	for i, p := range q.pending {
+		if p == c {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			break
+		}
+	}
+	q.scheduleSave()
+
+	done := *c
+	done.Outcome = outcome
+	q.recent = append([]QueuedCallback{done}, q.recent...)
+	if len(q.recent) > callbackRecentSize {
+		q.recent = q.recent[:callbackRecentSize]
+	}
+}
+
+// LastError returns the most recent delivery failure, if any
+func (q *CallbackQueue) LastError() *CallbackError {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.lastError
+}
+
+// Status describes the queue for diagnostics
+func (q *CallbackQueue) Status() map[string]interface{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending := make([]QueuedCallback, 0, len(q.pending))
+	for _, c := range q.pending {
+		pending = append(pending, *c)
+	}
+	recent := append([]QueuedCallback{}, q.recent...)
+
+	return map[string]interface{}{
+		"pending":   pending,
+		"recent":    recent,
+		"lastError": q.lastError,
+	}
+}
+
+// Clear drops every pending callback
+func (q *CallbackQueue) Clear() {
+	q.mu.Lock()
+	q.pending = nil
+	q.scheduleSave()
+	q.mu.Unlock()
+}
+
+// Retry makes every pending callback due now
+func (q *CallbackQueue) Retry() {
+	q.mu.Lock()
+	now := time.Now()
+	for _, c := range q.pending {
+		c.NextAttempt = now
+	}
+	q.scheduleSave()
+	q.mu.Unlock()
+
+	q.notify()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCallbackBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 5 * time.Second},
+		{1, 5 * time.Second},
+		{2, 10 * time.Second},
+		{3, 20 * time.Second},
+		{7, 320 * time.Second},
+		{8, callbackRetryMax},
+		{40, callbackRetryMax},
+		{200, callbackRetryMax},
+	}
+	for _, tt := range tests {
+		if got := callbackBackoff(tt.attempts); got != tt.want {
+			t.Errorf("callbackBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestCallbackQueueKeepsCorruptFile(t *testing.T) {
+	dataDir := t.TempDir()
+	path := filepath.Join(dataDir, "callbacks.json")
+	os.WriteFile(path, []byte(`[{"id":"1","event":"complete"`), 0644)
+
+	q := &CallbackQueue{path: path}
+	q.load()
+	if len(q.pending) != 0 {
+		t.Errorf("loaded %d callbacks from a torn file", len(q.pending))
+	}
+
+	matches, _ := filepath.Glob(path + ".corrupt-*")
+	if len(matches) != 1 {
+		t.Fatalf("corrupt file not kept aside: %v", matches)
+	}
+	data, _ := os.ReadFile(matches[0])
+	if !strings.Contains(string(data), `"complete"`) {
+		t.Errorf("kept file lost its contents: %q", data)
+	}
+}
+
+func TestCallbackQueueSavesInBackground(t *testing.T) {
+	dataDir := t.TempDir()
+	q := NewCallbackQueue(dataDir)
+	defer q.Close()
+	// Nothing listens there, so the callback stays pending
+	q.Enqueue("complete", "item", map[string]interface{}{"url": "http://127.0.0.1:1/cb", "method": "POST"}, CallbackVars{})
+
+	path := filepath.Join(dataDir, "callbacks.json")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, err := os.ReadFile(path)
+		if err == nil && strings.Contains(string(data), `"complete"`) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("callback never saved: %q, %v", data, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	reloaded := &CallbackQueue{path: path}
+	reloaded.load()
+	if len(reloaded.pending) != 1 || reloaded.pending[0].Event != "complete" {
+		t.Errorf("reloaded %+v", reloaded.pending)
+	}
+}
+
+func TestCallbackQueueKeepsLatestProgress(t *testing.T) {
+	// No workers, so nothing is delivered while the queue is inspected
+	q := &CallbackQueue{path: filepath.Join(t.TempDir(), "callbacks.json"), saveReq: make(chan struct{}, 1)}
+	callback := map[string]interface{}{"url": "http://127.0.0.1:1/cb", "method": "POST"}
+	enqueue := func(event, key string, position float64) {
+		q.Enqueue(event, key, callback, CallbackVars{"position": position})
+	}
+
+	enqueue("progress", "a", 10)
+	enqueue("progress", "b", 15)
+	enqueue("progress", "a", 20)
+	enqueue("complete", "a", 25)
+	enqueue("progress", "a", 30) // the next play of a
+	enqueue("complete", "b", 40)
+
+	var got []string
+	for _, c := range q.pending {
+		got = append(got, fmt.Sprintf("%s %s %v", c.Event, c.Key, c.Vars["position"]))
+	}
+	want := []string{"progress b 15", "complete a 25", "progress a 30", "complete b 40"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pending %q, want %q", got, want)
+	}
+}
+
+func TestCallbackQueueDeliversAndCloses(t *testing.T) {
+	received := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.URL.Query().Get("event")
+	}))
+	defer srv.Close()
+
+	dataDir := t.TempDir()
+	q := NewCallbackQueue(dataDir)
+	q.Enqueue("progress", "a", map[string]interface{}{"url": srv.URL + "/?event=${event}", "method": "POST"}, CallbackVars{"event": "progress"})
+	q.Enqueue("complete", "a", map[string]interface{}{"url": srv.URL + "/?event=${event}", "method": "POST"}, CallbackVars{"event": "complete"})
+	for _, want := range []string{"progress", "complete"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Errorf("delivered %s, want %s", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s never delivered", want)
+		}
+	}
+
+	// What is still pending at Close is saved, and nothing is sent after
+	q.Enqueue("complete", "b", map[string]interface{}{"url": "http://127.0.0.1:1/cb", "method": "POST"}, CallbackVars{})
+	q.Close()
+	q.Close()
+	reloaded := &CallbackQueue{path: filepath.Join(dataDir, "callbacks.json")}
+	reloaded.load()
+	if len(reloaded.pending) != 1 || reloaded.pending[0].Key != "b" {
+		t.Errorf("saved at Close: %+v", reloaded.pending)
+	}
+	q.Enqueue("complete", "c", map[string]interface{}{"url": srv.URL + "/?event=late", "method": "POST"}, CallbackVars{})
+	select {
+	case got := <-received:
+		t.Errorf("delivered %s after Close", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
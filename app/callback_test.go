@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRenderTemplateValue(t *testing.T) {
+	vars := CallbackVars{
+		"position":      12.5,
+		"positionTicks": int64(125000000),
+		"isPaused":      true,
+		"event":         "progress",
+	}
+	tests := []struct {
+		name string
+		in   interface{}
+		want interface{}
+	}{
+		{"whole string stays a string", "${positionTicks}", "125000000"},
+		{"bool as text", "${isPaused}", "true"},
+		{"embedded", "at ${position}s", "at 12.5s"},
+		{"two variables", "${event}/${isPaused}", "progress/true"},
+		{"unknown variable", "${nope}", "${nope}"},
+		{"plain text", "hello", "hello"},
+		{"typed number", map[string]interface{}{"$var": "positionTicks"}, int64(125000000)},
+		{"typed bool", map[string]interface{}{"$var": "isPaused"}, true},
+		{"typed unknown", map[string]interface{}{"$var": "nope"}, map[string]interface{}{"$var": "nope"}},
+		{"not a $var object", map[string]interface{}{"$var": "event", "x": 1.0}, map[string]interface{}{"$var": "event", "x": 1.0}},
+		{"number", 3.0, 3.0},
+		{"nil", nil, nil},
+		{
+			"nested",
+			map[string]interface{}{
+				"PositionTicks": map[string]interface{}{"$var": "positionTicks"},
+				"Items":         []interface{}{"${event}", false},
+			},
+			map[string]interface{}{
+				"PositionTicks": int64(125000000),
+				"Items":         []interface{}{"progress", false},
+			},
+		},
+	}
+	for _, tt := range tests {
+		if got := renderTemplateValue(tt.in, vars); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// The body jellyfin.js and emby.js send as onProgress is the same JSON it
+// was before the template engine, strings included
+func TestSendCallbackServiceTemplate(t *testing.T) {
+	var got map[string]interface{}
+	var gotURL string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotURL = r.URL.String()
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &got)
+	}))
+	defer srv.Close()
+
+	callback := map[string]interface{}{
+		"url":    srv.URL + "/Sessions/Playing/Progress?item=${itemId}",
+		"method": "POST",
+		"bodyTemplate": map[string]interface{}{
+			"ItemId":        "abc",
+			"PositionTicks": "${positionTicks}",
+			"IsPaused":      "${isPaused}",
+		},
+	}
+	vars := newCallbackVars("progress", "paused", 12.5, 600, true)
+	vars["itemId"] = "a b"
+	if _, err := sendCallback(callback, vars); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{"ItemId": "abc", "PositionTicks": "125000000", "IsPaused": "true"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("body %v, want %v", got, want)
+	}
+	if gotURL != "/Sessions/Playing/Progress?item=a+b" {
+		t.Errorf("url %s", gotURL)
+	}
+}
@@ -0,0 +1,616 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var errCDPUnavailable = errors.New("browser DevTools port not available")
+
+// cdpTimeout bounds every DevTools request so a hung page can't stall callers
+const cdpTimeout = 5 * time.Second
+
+// CDPTarget is a DevTools target, usually a browser tab
+type CDPTarget struct {
+	ID                   string `json:"id"`
+	Type                 string `json:"type"`
+	Title                string `json:"title"`
+	URL                  string `json:"url"`
+	WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
+}
+
+// CDPClient talks to the DevTools endpoint of the browser BrowserManager
+// launched. The port changes with every launch; until the browser reports it
+// every call fails with errCDPUnavailable.
+type CDPClient struct {
+	mu     sync.Mutex
+	port   int
+	nextID int64
+	http   *http.Client
+}
+
+func NewCDPClient() *CDPClient {
+	return &CDPClient{http: &http.Client{Timeout: cdpTimeout}}
+}
+
+// SetPort points the client at a browser, or at nothing when port is 0
+func (c *CDPClient) SetPort(port int) {
+	c.mu.Lock()
+	c.port = port
+	c.mu.Unlock()
+}
+
+// Port returns the current DevTools port, or 0 when there is none
+func (c *CDPClient) Port() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.port
+}
+
+// Available reports whether a browser with DevTools is running
+func (c *CDPClient) Available() bool {
+	return c.Port() != 0
+}
+
+// Targets lists the browser's DevTools targets
+func (c *CDPClient) Targets() ([]CDPTarget, error) {
+	port := c.Port()
+	if port == 0 {
+		return nil, errCDPUnavailable
+	}
+
+	resp, err := c.http.Get(fmt.Sprintf("http://127.0.0.1:%d/json", port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get CDP targets: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var targets []CDPTarget
+	if err := json.NewDecoder(resp.Body).Decode(&targets); err != nil {
+		return nil, fmt.Errorf("failed to decode CDP targets: %w", err)
+	}
+	return targets, nil
+}
+
+// CDPTargetInfo is a target as reported by Target domain events
+type CDPTargetInfo struct {
+	TargetID string `json:"targetId"`
+	Type     string `json:"type"`
+	URL      string `json:"url"`
+	OpenerID string `json:"openerId"`
+}
+
+// CloseTarget closes a tab
+func (c *CDPClient) CloseTarget(id string) error {
+	return c.targetRequest("close", id)
+}
+
+// ActivateTarget brings a tab to the front
+func (c *CDPClient) ActivateTarget(id string) error {
+	return c.targetRequest("activate", id)
+}
+
+func (c *CDPClient) targetRequest(action, id string) error {
+	port := c.Port()
+	if port == 0 {
+		return errCDPUnavailable
+	}
+	resp, err := c.http.Get(fmt.Sprintf("http://127.0.0.1:%d/json/%s/%s", port, action, id))
+	if err != nil {
+		return fmt.Errorf("failed to %s target: %w", action, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to %s target: %s", action, resp.Status)
+	}
+	return nil
+}
+
+// browserWebSocketURL returns the DevTools endpoint of the browser itself
+func (c *CDPClient) browserWebSocketURL() (string, error) {
+	port := c.Port()
+	if port == 0 {
+		return "", errCDPUnavailable
+	}
+
+	resp, err := c.http.Get(fmt.Sprintf("http://127.0.0.1:%d/json/version", port))
+	if err != nil {
+		return "", fmt.Errorf("failed to get CDP version: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var version struct {
+		WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil || version.WebSocketDebuggerURL == "" {
+		return "", fmt.Errorf("no browser DevTools endpoint on port %d", port)
+	}
+	return version.WebSocketDebuggerURL, nil
+}
+
+// NewTab opens pageURL in a new tab
+func (c *CDPClient) NewTab(pageURL string) (CDPTarget, error) {
+	port := c.Port()
+	if port == 0 {
+		return CDPTarget{}, errCDPUnavailable
+	}
+
+	// Chromium only accepts PUT here since version 111
+	req, err := http.NewRequest("PUT", fmt.Sprintf("http://127.0.0.1:%d/json/new?%s", port, url.QueryEscape(pageURL)), nil)
+	if err != nil {
+		return CDPTarget{}, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return CDPTarget{}, fmt.Errorf("failed to open tab: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var target CDPTarget
+	if err := json.NewDecoder(resp.Body).Decode(&target); err != nil {
+		return CDPTarget{}, fmt.Errorf("failed to open tab: %s", resp.Status)
+	}
+	return target, nil
+}
+
+// SetWindowState changes the window holding target to "normal",
+// "minimized", "maximized" or "fullscreen"
+func (c *CDPClient) SetWindowState(targetID, state string) error {
+	raw, err := c.CallBrowser("Browser.getWindowForTarget", map[string]interface{}{"targetId": targetID})
+	if err != nil {
+		return err
+	}
+	var window struct {
+		WindowID int `json:"windowId"`
+	}
+	if err := json.Unmarshal(raw, &window); err != nil {
+		return fmt.Errorf("failed to decode window: %w", err)
+	}
+
+	// Chromium won't go between minimized and fullscreen directly
+	if state != "normal" {
+		c.CallBrowser("Browser.setWindowBounds", map[string]interface{}{
+			"windowId": window.WindowID,
+			"bounds":   map[string]interface{}{"windowState": "normal"},
+		})
+	}
+	_, err = c.CallBrowser("Browser.setWindowBounds", map[string]interface{}{
+		"windowId": window.WindowID,
+		"bounds":   map[string]interface{}{"windowState": state},
+	})
+	return err
+}
+
+// WatchTargets reports the browser's Target.targetCreated,
+// Target.targetInfoChanged and Target.targetDestroyed events to fn until
+// stop is closed or the browser goes away. fn runs on the watching
+// goroutine.
+func (c *CDPClient) WatchTargets(stop <-chan struct{}, fn func(event string, info CDPTargetInfo)) error {
+	wsURL, err := c.browserWebSocketURL()
+	if err != nil {
+		return err
+	}
+
+	enable := map[string]map[string]interface{}{
+		"Target.setDiscoverTargets": {"discover": true},
+	}
+	return c.watch(wsURL, enable, stop, func(method string, params json.RawMessage) {
+		var p struct {
+			TargetInfo CDPTargetInfo `json:"targetInfo"`
+			TargetID   string        `json:"targetId"`
+		}
+		if json.Unmarshal(params, &p) != nil {
+			return
+		}
+		switch method {
+		case "Target.targetCreated", "Target.targetInfoChanged":
+			fn(method, p.TargetInfo)
+		case "Target.targetDestroyed":
+			fn(method, CDPTargetInfo{TargetID: p.TargetID})
+		}
+	})
+}
+
+// WatchPage sends the commands in enable to target, usually to enable
+// domains, and then reports the tab's events to fn until stop is closed or
+// the tab goes away. fn runs on the watching goroutine.
+func (c *CDPClient) WatchPage(target CDPTarget, enable map[string]map[string]interface{}, stop <-chan struct{}, fn func(method string, params json.RawMessage)) error {
+	wsURL := target.WebSocketDebuggerURL
+	if wsURL == "" {
+		port := c.Port()
+		if port == 0 {
+			return errCDPUnavailable
+		}
+		wsURL = fmt.Sprintf("ws://127.0.0.1:%d/devtools/page/%s", port, target.ID)
+	}
+	return c.watch(wsURL, enable, stop, fn)
+}
+
+// watch keeps a DevTools connection open and passes its events to fn
+func (c *CDPClient) watch(wsURL string, enable map[string]map[string]interface{}, stop <-chan struct{}, fn func(method string, params json.RawMessage)) error {
+	dialer := websocket.Dialer{HandshakeTimeout: cdpTimeout}
+	conn, _, err := dialer.Dial(wsURL, nil)
+	if err != nil {
+		return fmt.Errorf("websocket dial failed: %w", err)
+	}
+	defer conn.Close()
+
+	// Closing the connection ends the read loop below
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	for method, params := range enable {
+		request := map[string]interface{}{
+			"id":     atomic.AddInt64(&c.nextID, 1),
+			"method": method,
+			"params": params,
+		}
+		if err := conn.WriteJSON(request); err != nil {
+			return fmt.Errorf("write command failed: %w", err)
+		}
+	}
+
+	for {
+		var msg struct {
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := conn.ReadJSON(&msg); err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+				return fmt.Errorf("read event failed: %w", err)
+			}
+		}
+		if msg.Method != "" {
+			fn(msg.Method, msg.Params)
+		}
+	}
+}
+
+// FindPage returns the first page whose URL contains urlPattern
+func (c *CDPClient) FindPage(urlPattern string) (CDPTarget, error) {
+	targets, err := c.Targets()
+	if err != nil {
+		return CDPTarget{}, err
+	}
+	for _, t := range targets {
+		if t.Type == "page" && strings.Contains(t.URL, urlPattern) {
+			return t, nil
+		}
+	}
+	return CDPTarget{}, fmt.Errorf("no tab found matching %s", urlPattern)
+}
+
+// Call sends one DevTools command to target and returns its result
+func (c *CDPClient) Call(target CDPTarget, method string, params map[string]interface{}) (json.RawMessage, error) {
+	wsURL := target.WebSocketDebuggerURL
+	if wsURL == "" {
+		port := c.Port()
+		if port == 0 {
+			return nil, errCDPUnavailable
+		}
+		wsURL = fmt.Sprintf("ws://127.0.0.1:%d/devtools/page/%s", port, target.ID)
+	}
+	return c.call(wsURL, method, params)
+}
+
+// CallBrowser sends one DevTools command to the browser itself rather than
+// a tab, for the Browser and Target domains
+func (c *CDPClient) CallBrowser(method string, params map[string]interface{}) (json.RawMessage, error) {
+	wsURL, err := c.browserWebSocketURL()
+	if err != nil {
+		return nil, err
+	}
+	return c.call(wsURL, method, params)
+}
+
+func (c *CDPClient) call(wsURL, method string, params map[string]interface{}) (json.RawMessage, error) {
+	dialer := websocket.Dialer{HandshakeTimeout: cdpTimeout}
+	conn, _, err := dialer.Dial(wsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("websocket dial failed: %w", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(cdpTimeout))
+	conn.SetWriteDeadline(time.Now().Add(cdpTimeout))
+
+	id := atomic.AddInt64(&c.nextID, 1)
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	request := map[string]interface{}{"id": id, "method": method, "params": params}
+	if err := conn.WriteJSON(request); err != nil {
+		return nil, fmt.Errorf("write command failed: %w", err)
+	}
+
+	// Skip any events until the reply to our command arrives
+	for {
+		var response struct {
+			ID     int64           `json:"id"`
+			Result json.RawMessage `json:"result"`
+			Error  *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := conn.ReadJSON(&response); err != nil {
+			return nil, fmt.Errorf("read response failed: %w", err)
+		}
+		if response.ID != id {
+			continue
+		}
+		if response.Error != nil {
+			return nil, fmt.Errorf("CDP error: %s", response.Error.Message)
+		}
+		return response.Result, nil
+	}
+}
+
+// Evaluate runs expression in target and returns its value
+func (c *CDPClient) Evaluate(target CDPTarget, expression string) (interface{}, error) {
+	raw, err := c.Call(target, "Runtime.evaluate", map[string]interface{}{
+		"expression":    expression,
+		"returnByValue": true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Result struct {
+			Value interface{} `json:"value"`
+		} `json:"result"`
+		ExceptionDetails *struct {
+			Text string `json:"text"`
+		} `json:"exceptionDetails"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode evaluate result: %w", err)
+	}
+	if result.ExceptionDetails != nil {
+		return nil, fmt.Errorf("script error: %s", result.ExceptionDetails.Text)
+	}
+	return result.Result.Value, nil
+}
+
+// readDevToolsActivePort reads the port Chromium writes to
+// <user-data-dir>/DevToolsActivePort when started with
+// --remote-debugging-port=0
+func readDevToolsActivePort(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		return 0, fmt.Errorf("%s is empty", path)
+	}
+	port, err := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+	if err != nil || port <= 0 {
+		return 0, fmt.Errorf("bad port in %s", path)
+	}
+	return port, nil
+}
+
+// cdpKeyDef is what Input.dispatchKeyEvent needs to reproduce a key press
+type cdpKeyDef struct {
+	code    string
+	keyCode int
+	text    string
+}
+
+// cdpKeys maps DOM key names to their key definitions. Single letters and
+// digits are derived in cdpKeyFor.
+var cdpKeys = map[string]cdpKeyDef{
+	"Enter":              {"Enter", 13, "\r"},
+	"Escape":             {"Escape", 27, ""},
+	"Backspace":          {"Backspace", 8, ""},
+	"Tab":                {"Tab", 9, ""},
+	" ":                  {"Space", 32, " "},
+	"ArrowLeft":          {"ArrowLeft", 37, ""},
+	"ArrowUp":            {"ArrowUp", 38, ""},
+	"ArrowRight":         {"ArrowRight", 39, ""},
+	"ArrowDown":          {"ArrowDown", 40, ""},
+	"PageUp":             {"PageUp", 33, ""},
+	"PageDown":           {"PageDown", 34, ""},
+	"End":                {"End", 35, ""},
+	"Home":               {"Home", 36, ""},
+	"Delete":             {"Delete", 46, ""},
+	"F11":                {"F11", 122, ""},
+	"BrowserHome":        {"BrowserHome", 172, ""},
+	"MediaPlayPause":     {"MediaPlayPause", 179, ""},
+	"MediaTrackNext":     {"MediaTrackNext", 176, ""},
+	"MediaTrackPrevious": {"MediaTrackPrevious", 177, ""},
+}
+
+// cdpKeyFor returns the definition of key, accepting "Space" and "Esc" as
+// aliases
+func cdpKeyFor(key string) (cdpKeyDef, bool) {
+	switch key {
+	case "Space":
+		key = " "
+	case "Esc":
+		key = "Escape"
+	}
+	if def, ok := cdpKeys[key]; ok {
+		return def, true
+	}
+	if len(key) == 1 {
+		c := key[0]
+		switch {
+		case c >= 'a' && c <= 'z':
+			return cdpKeyDef{"Key" + strings.ToUpper(key), int(c - 'a' + 'A'), key}, true
+		case c >= 'A' && c <= 'Z':
+			return cdpKeyDef{"Key" + key, int(c), key}, true
+		case c >= '0' && c <= '9':
+			return cdpKeyDef{"Digit" + key, int(c), key}, true
+		}
+	}
+	return cdpKeyDef{}, false
+}
+
+// PressKey sends a trusted key press to target. Unlike a synthetic
+// KeyboardEvent it reaches pages that check event.isTrusted.
+func (c *CDPClient) PressKey(target CDPTarget, key string) error {
+	def, ok := cdpKeyFor(key)
+	if !ok {
+		return fmt.Errorf("unknown key %q", key)
+	}
+
+	down := map[string]interface{}{
+		"type":                  "rawKeyDown",
+		"key":                   key,
+		"code":                  def.code,
+		"windowsVirtualKeyCode": def.keyCode,
+		"nativeVirtualKeyCode":  def.keyCode,
+	}
+	if def.text != "" {
+		down["type"] = "keyDown"
+		down["text"] = def.text
+		down["unmodifiedText"] = def.text
+	}
+	if _, err := c.Call(target, "Input.dispatchKeyEvent", down); err != nil {
+		return err
+	}
+
+	_, err := c.Call(target, "Input.dispatchKeyEvent", map[string]interface{}{
+		"type":                  "keyUp",
+		"key":                   key,
+		"code":                  def.code,
+		"windowsVirtualKeyCode": def.keyCode,
+		"nativeVirtualKeyCode":  def.keyCode,
+	})
+	return err
+}
+
+// focusScript focuses the first element matching selector and returns
+// whether there was one
+func focusScript(selector string) string {
+	sel, _ := json.Marshal(selector)
+	return fmt.Sprintf(`(function() {
+		const el = document.querySelector(%s);
+		if (!el) return false;
+		el.focus();
+		return true;
+	})()`, sel)
+}
+
+// elementCenterScript scrolls the first element matching selector into view
+// and returns the middle of its box as {x, y}, or null
+func elementCenterScript(selector string) string {
+	sel, _ := json.Marshal(selector)
+	return fmt.Sprintf(`(function() {
+		const el = document.querySelector(%s);
+		if (!el) return null;
+		el.scrollIntoView({block: 'center', inline: 'center'});
+		const r = el.getBoundingClientRect();
+		return {x: r.left + r.width / 2, y: r.top + r.height / 2};
+	})()`, sel)
+}
+
+// elementCenter reads the result of elementCenterScript
+func elementCenter(value interface{}, selector string) (x, y float64, err error) {
+	box, ok := value.(map[string]interface{})
+	if !ok {
+		return 0, 0, fmt.Errorf("no element matches %s", selector)
+	}
+	x, _ = box["x"].(float64)
+	y, _ = box["y"].(float64)
+	return x, y, nil
+}
+
+// Focus focuses the first element matching selector in target
+func (c *CDPClient) Focus(target CDPTarget, selector string) error {
+	found, err := c.Evaluate(target, focusScript(selector))
+	if err != nil {
+		return err
+	}
+	if found != true {
+		return fmt.Errorf("no element matches %s", selector)
+	}
+	return nil
+}
+
+// Click scrolls the first element matching selector into view and clicks
+// the middle of its box with real mouse events
+func (c *CDPClient) Click(target CDPTarget, selector string) error {
+	value, err := c.Evaluate(target, elementCenterScript(selector))
+	if err != nil {
+		return err
+	}
+	x, y, err := elementCenter(value, selector)
+	if err != nil {
+		return err
+	}
+
+	for _, kind := range []string{"mouseMoved", "mousePressed", "mouseReleased"} {
+		params := map[string]interface{}{"type": kind, "x": x, "y": y}
+		if kind != "mouseMoved" {
+			params["button"] = "left"
+			params["clickCount"] = 1
+		}
+		if _, err := c.Call(target, "Input.dispatchMouseEvent", params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertText types text into the focused element of target as if it came
+// from an input method
+func (c *CDPClient) InsertText(target CDPTarget, text string) error {
+	_, err := c.Call(target, "Input.insertText", map[string]interface{}{"text": text})
+	return err
+}
+
+// Navigate loads url in target
+func (c *CDPClient) Navigate(target CDPTarget, url string) error {
+	raw, err := c.Call(target, "Page.navigate", map[string]interface{}{"url": url})
+	if err != nil {
+		return err
+	}
+	var result struct {
+		ErrorText string `json:"errorText"`
+	}
+	if json.Unmarshal(raw, &result) == nil && result.ErrorText != "" {
+		return fmt.Errorf("navigation failed: %s", result.ErrorText)
+	}
+	return nil
+}
+
+// Screenshot captures target as a PNG
+func (c *CDPClient) Screenshot(target CDPTarget) ([]byte, error) {
+	raw, err := c.Call(target, "Page.captureScreenshot", map[string]interface{}{"format": "png"})
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Data []byte `json:"data"` // base64 in the JSON
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode screenshot: %w", err)
+	}
+	return result.Data, nil
+}
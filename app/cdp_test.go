@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCdpKeyFor(t *testing.T) {
+	tests := []struct {
+		key  string
+		want cdpKeyDef
+		ok   bool
+	}{
+		{"Enter", cdpKeyDef{"Enter", 13, "\r"}, true},
+		{"Esc", cdpKeyDef{"Escape", 27, ""}, true},
+		{"Space", cdpKeyDef{"Space", 32, " "}, true},
+		{" ", cdpKeyDef{"Space", 32, " "}, true},
+		{"a", cdpKeyDef{"KeyA", 65, "a"}, true},
+		{"Z", cdpKeyDef{"KeyZ", 90, "Z"}, true},
+		{"7", cdpKeyDef{"Digit7", 55, "7"}, true},
+		{"MediaPlayPause", cdpKeyDef{"MediaPlayPause", 179, ""}, true},
+		{"!", cdpKeyDef{}, false},
+		{"F12", cdpKeyDef{}, false},
+		{"", cdpKeyDef{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := cdpKeyFor(tt.key)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("cdpKeyFor(%q) = %+v, %v, want %+v, %v", tt.key, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestReadDevToolsActivePort(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+		wantErr bool
+	}{
+		{"port and path", "9222\n/devtools/browser/abc\n", 9222, false},
+		{"port only", " 41234 ", 41234, false},
+		{"empty", "", 0, true},
+		{"not a number", "port\n", 0, true},
+		{"zero", "0\n", 0, true},
+		{"negative", "-5\n", 0, true},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "DevToolsActivePort")
+		if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readDevToolsActivePort(path)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("%s: got %d, %v", tt.name, got, err)
+		}
+	}
+
+	if _, err := readDevToolsActivePort(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("missing file: no error")
+	}
+}
+
+func TestCDPClientFollowsPort(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[{"id":"A","type":"page","url":"https://example.com/"}]`))
+	}))
+	defer srv.Close()
+
+	c := NewCDPClient()
+	if _, err := c.Targets(); err != errCDPUnavailable || c.Available() {
+		t.Errorf("before the browser reported a port: %v", err)
+	}
+
+	c.SetPort(serverPort(srv))
+	targets, err := c.Targets()
+	if err != nil || len(targets) != 1 || targets[0].ID != "A" {
+		t.Errorf("targets %+v, %v", targets, err)
+	}
+
+	c.SetPort(0)
+	if c.Available() {
+		t.Error("still available after the browser went away")
+	}
+}
+
+func TestNewTabEscapesURL(t *testing.T) {
+	var method, query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, query = r.Method, r.URL.RawQuery
+		w.Write([]byte(`{"id":"T","type":"page"}`))
+	}))
+	defer srv.Close()
+
+	c := NewCDPClient()
+	c.SetPort(serverPort(srv))
+	target, err := c.NewTab("https://example.com/watch?v=1&t=30#x")
+	if err != nil || target.ID != "T" {
+		t.Fatalf("target %+v, %v", target, err)
+	}
+	if method != "PUT" || query != "https%3A%2F%2Fexample.com%2Fwatch%3Fv%3D1%26t%3D30%23x" {
+		t.Errorf("%s ?%s", method, query)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Event is a state change pushed to /api/1/events subscribers. Type is
+// "<topic>.<name>", e.g. player.started, browser.exited, apps.changed.
+type Event struct {
+	ID   int64       `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// Sources of profile and app changes, sent as the "source" of their events
+// so that the launcher UI can skip the changes it made itself
+const (
+	eventSourceLauncher = "launcher" // the launcher window, through the App bindings
+	eventSourceAPI      = "api"      // a request to the HTTP API
+)
+
+// publishProfileEvent tells subscribers that a profile or its apps changed
+func (s *Server) publishProfileEvent(eventType, profileID, source string) {
+	s.events.Publish(eventType, map[string]string{
+		"profileId": profileID,
+		"source":    source,
+	})
+}
+
+// EventHub fans events out to every subscriber. Publish never blocks: a
+// subscriber that falls too far behind misses events rather than stalling
+// the player.
+type EventHub struct {
+	mu          sync.Mutex
+	nextID      int64
+	subscribers map[chan Event]struct{}
+}
+
+func NewEventHub() *EventHub {
+	return &EventHub{
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Publish sends an event to all current subscribers
+func (h *EventHub) Publish(eventType string, data interface{}) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID++
+	ev := Event{ID: h.nextID, Type: eventType, Time: time.Now(), Data: data}
+	for ch := range h.subscribers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel of future events and a function to stop them
+func (h *EventHub) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, 64)
+
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers, ch)
+			h.mu.Unlock()
+		})
+	}
+}
+
+// eventFilter matches events against a comma separated list of topics or
+// full types from the ?types= parameter. An empty list matches everything.
+func eventFilter(types string) func(Event) bool {
+	var wanted []string
+	for _, t := range strings.Split(types, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			wanted = append(wanted, t)
+		}
+	}
+
+	return func(ev Event) bool {
+		if len(wanted) == 0 {
+			return true
+		}
+		topic := ev.Type
+		if i := strings.Index(topic, "."); i >= 0 {
+			topic = topic[:i]
+		}
+		for _, t := range wanted {
+			if t == ev.Type || t == topic {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+var eventsUpgrader = websocket.Upgrader{
+	// Page scripts connect from the service's origin, same as the CORS policy
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// handleEvents streams events as Server-Sent Events, or over a WebSocket
+// when the client asks for an upgrade. The first event is a player.status
+// snapshot so subscribers don't need a separate status request. The phone
+// remote only gets remoteEventTopics.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	match := eventFilter(r.URL.Query().Get("types"))
+	if isRemoteRequest(r) {
+		requested, allowed := match, eventFilter(remoteEventTopics)
+		match = func(ev Event) bool { return allowed(ev) && requested(ev) }
+	}
+
+	events, unsubscribe := s.events.Subscribe()
+	defer unsubscribe()
+
+	snapshot := Event{Type: "player.status", Time: time.Now(), Data: s.player.GetStatus()}
+
+	if websocket.IsWebSocketUpgrade(r) {
+		s.streamEventsWebSocket(w, r, events, snapshot, match)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, `{"error":"Streaming not supported"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	writeEvent := func(ev Event) error {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return nil
+		}
+		if _, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", ev.ID, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	if match(snapshot) {
+		if writeEvent(snapshot) != nil {
+			return
+		}
+	}
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case ev := <-events:
+			if !match(ev) {
+				continue
+			}
+			if writeEvent(ev) != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) streamEventsWebSocket(w http.ResponseWriter, r *http.Request, events <-chan Event, snapshot Event, match func(Event) bool) {
+	conn, err := eventsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		Log("Events: websocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// Nothing is expected from the client; reading notices when it goes away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	if match(snapshot) {
+		if err := conn.WriteJSON(snapshot); err != nil {
+			return
+		}
+	}
+
+	ping := time.NewTicker(15 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second)); err != nil {
+				return
+			}
+		case ev := <-events:
+			if !match(ev) {
+				continue
+			}
+			if err := conn.WriteJSON(ev); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestEventFilter(t *testing.T) {
+	tests := []struct {
+		types string
+		event string
+		want  bool
+	}{
+		{"", "player.started", true},
+		{"", "profiles.created", true},
+		{"player", "player.started", true},
+		{"player", "playerx.started", false},
+		{"player", "browser.exited", false},
+		{"player, browser", "browser.exited", true},
+		{"player.stopped", "player.stopped", true},
+		{"player.stopped", "player.started", false},
+		{" , ", "apps.changed", true},
+		{"apps", "apps", true},
+	}
+	for _, tt := range tests {
+		if got := eventFilter(tt.types)(Event{Type: tt.event}); got != tt.want {
+			t.Errorf("eventFilter(%q)(%s) = %v, want %v", tt.types, tt.event, got, tt.want)
+		}
+	}
+}
+
+func TestProfileEventSource(t *testing.T) {
+	s := &Server{events: NewEventHub()}
+	ch, unsubscribe := s.events.Subscribe()
+	defer unsubscribe()
+
+	for _, source := range []string{eventSourceLauncher, eventSourceAPI} {
+		s.publishProfileEvent("profiles.updated", "alice", source)
+		ev := <-ch
+		data := ev.Data.(map[string]string)
+		if ev.Type != "profiles.updated" || data["profileId"] != "alice" || data["source"] != source {
+			t.Errorf("published %s %v, want source %q", ev.Type, data, source)
+		}
+	}
+}
@@ -1,5 +1,5 @@
 import './style.css';
-import { GetProfiles, GetApps, GetBrowsers, LaunchApp, Quit, SaveApps, GetServerPort, GetVersion, CreateProfile, UpdateProfile, DeleteProfile, GetProfilePhotos, GetLogoPath, GetMpvPaths, GetSelectedMpv, SetSelectedMpv, GetMpvOptions, SetMpvOptions, CloseBrowser, GetInitialUser, GetInitialApp, GetProfileCount } from '../wailsjs/go/main/App';
+import { GetProfiles, GetApps, GetBrowsers, LaunchApp, Quit, SaveApps, GetServerPort, GetVersion, CreateProfile, UpdateProfile, DeleteProfile, GetProfilePhotos, GetLogoPath, GetMpvPaths, GetSelectedMpv, SetSelectedMpv, GetMpvOptions, SetMpvOptions, GetPlayerBackends, GetSelectedPlayerBackend, SetSelectedPlayerBackend, GetPlayerCommand, SetPlayerCommand, GetPlayerSettings, SetPlayerSettings, CloseBrowser, GetInitialUser, GetInitialApp, GetProfileCount, GetRemoteURL, GetBrowserSettings, SetBrowserSettings } from '../wailsjs/go/main/App';
 
 // State
 let currentProfile = null;
@@ -45,6 +45,9 @@ async function init() {
 
   try {
     serverPort = await GetServerPort();
+    subscribeServerEvents();
+    subscribeNowPlaying();
+    subscribeRemote();
     profiles = await GetProfiles();
     browsers = await GetBrowsers();
     profilePhotos = await GetProfilePhotos();
@@ -126,6 +129,167 @@ async function init() {
   }
 }
 
+// Follow profile and app changes made outside this window (e.g. over the API)
+function subscribeServerEvents() {
+  const events = new EventSource(`http://localhost:${serverPort}/api/1/events?types=profiles,apps`);
+  events.onmessage = async (e) => {
+    const ev = JSON.parse(e.data);
+    if (ev.data?.source === 'launcher') return;
+
+    if (ev.type.startsWith('profiles.')) {
+      profiles = await GetProfiles();
+      if (currentScreen === 'profiles' && !manageProfilesMode) showProfileSelector();
+    } else if (ev.type === 'apps.changed' && currentScreen === 'launcher' && !editMode && currentProfile?.id === ev.data?.profileId) {
+      showLauncher();
+    }
+  };
+}
+
+// The phone remote sends keys and text here when neither the player nor a
+// browser is on screen, and asks us to launch apps so the selected browser
+// and window handling are the same as launching from the grid
+function subscribeRemote() {
+  const events = new EventSource(`http://localhost:${serverPort}/api/1/events?types=remote`);
+  events.onmessage = (e) => {
+    const ev = JSON.parse(e.data);
+    if (ev.type === 'remote.key') {
+      remoteKey(ev.data.key);
+    } else if (ev.type === 'remote.text') {
+      remoteText(ev.data.text);
+    } else if (ev.type === 'remote.launch') {
+      remoteLaunch(ev.data.profileId, ev.data.index);
+    }
+  };
+}
+
+function remoteKey(key) {
+  const target = document.activeElement || document.body;
+  const init = { key, bubbles: true, cancelable: true };
+  target.dispatchEvent(new KeyboardEvent('keydown', init));
+  target.dispatchEvent(new KeyboardEvent('keyup', init));
+}
+
+function remoteText(text) {
+  const el = document.activeElement;
+  if (!el || !('value' in el)) return;
+  try {
+    el.setRangeText(text, el.selectionStart, el.selectionEnd, 'end');
+  } catch {
+    el.value += text; // number inputs have no selection
+  }
+  el.dispatchEvent(new Event('input', { bubbles: true }));
+}
+
+async function remoteLaunch(profileId, index) {
+  const profile = profiles.find(p => p.id === profileId);
+  const profileApps = await GetApps(profileId) || [];
+  const app = profileApps[index];
+  if (!profile || !app) return;
+
+  hideNowPlaying();
+  currentProfile = profile;
+  apps = profileApps;
+  showLauncher();
+  try {
+    await LaunchApp(app, profileId, selectedBrowser);
+  } catch (err) {
+    console.error('Failed to launch app from remote:', err);
+  }
+}
+
+// Now playing screen for music. Audio plays without a player window, so the
+// launcher shows what's on over whatever screen was up, fed by player events.
+let nowPlaying = null; // overlay element while shown
+
+function subscribeNowPlaying() {
+  const events = new EventSource(`http://localhost:${serverPort}/api/1/events?types=player`);
+  events.onmessage = (e) => {
+    const ev = JSON.parse(e.data);
+    const status = ev.data || {};
+    if (ev.type === 'player.ended' || (ev.type === 'player.status' && !status.playing)) {
+      hideNowPlaying();
+    } else if (status.audio) {
+      showNowPlaying(status);
+    }
+  };
+}
+
+function formatPlayerTime(seconds) {
+  const s = Math.max(0, Math.floor(seconds || 0));
+  return `${Math.floor(s / 60)}:${(s % 60).toString().padStart(2, '0')}`;
+}
+
+function playerControl(action, body = {}) {
+  fetch(`http://localhost:${serverPort}/api/1/player/${action}`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify(body),
+  }).catch(e => console.error('Player control failed:', e));
+}
+
+function showNowPlaying(status) {
+  if (!nowPlaying) {
+    nowPlaying = document.createElement('div');
+    nowPlaying.className = 'now-playing';
+    nowPlaying.innerHTML = `
+      <div class="now-playing-art"><img alt=""></div>
+      <div class="now-playing-info">
+        <div class="now-playing-title"></div>
+        <div class="now-playing-track"></div>
+        <div class="now-playing-progress"><div class="now-playing-progress-bar"></div></div>
+        <div class="now-playing-time"></div>
+        <div class="now-playing-hint">Space pause · ←/→ seek · PgUp/PgDn track · Esc stop</div>
+      </div>
+    `;
+    document.body.appendChild(nowPlaying);
+    document.addEventListener('keydown', handleNowPlayingKey, true);
+  }
+
+  const img = nowPlaying.querySelector('.now-playing-art img');
+  if (status.poster && img.getAttribute('src') !== status.poster) {
+    img.src = status.poster;
+  }
+  nowPlaying.querySelector('.now-playing-art').classList.toggle('empty', !status.poster);
+  nowPlaying.querySelector('.now-playing-title').textContent = status.title || 'Now playing';
+  nowPlaying.querySelector('.now-playing-track').textContent =
+    status.playlistCount > 1 ? `Track ${status.playlistIndex + 1} of ${status.playlistCount}` : '';
+
+  if (status.position !== undefined) {
+    const percent = status.duration > 0 ? Math.min(100, (status.position / status.duration) * 100) : 0;
+    nowPlaying.querySelector('.now-playing-progress-bar').style.width = `${percent}%`;
+    nowPlaying.querySelector('.now-playing-time').textContent =
+      `${formatPlayerTime(status.position)} / ${formatPlayerTime(status.duration)}${status.paused ? ' · Paused' : ''}`;
+  }
+}
+
+function hideNowPlaying() {
+  if (!nowPlaying) return;
+  document.removeEventListener('keydown', handleNowPlayingKey, true);
+  document.body.removeChild(nowPlaying);
+  nowPlaying = null;
+}
+
+function handleNowPlayingKey(e) {
+  const actions = {
+    ' ': () => playerControl('pause'),
+    'Enter': () => playerControl('pause'),
+    'MediaPlayPause': () => playerControl('pause'),
+    'ArrowLeft': () => playerControl('seek', { offset: -10 }),
+    'ArrowRight': () => playerControl('seek', { offset: 10 }),
+    'PageUp': () => playerControl('previous'),
+    'MediaTrackPrevious': () => playerControl('previous'),
+    'PageDown': () => playerControl('next'),
+    'MediaTrackNext': () => playerControl('next'),
+    'Escape': () => playerControl('stop'),
+    'MediaStop': () => playerControl('stop'),
+  };
+  const action = actions[e.key];
+  if (!action) return;
+  e.preventDefault();
+  e.stopPropagation();
+  action();
+}
+
 function render(html) {
   document.querySelector('#app').innerHTML = html;
 }
@@ -831,9 +995,19 @@ function handleMenuKeydown(e) {
 }
 
 async function showSettingsDialog() {
+  const profileId = currentProfile ? currentProfile.id : '';
   const mpvPaths = await GetMpvPaths();
-  const selectedMpv = await GetSelectedMpv();
-  const mpvOptions = await GetMpvOptions();
+  const playerBackends = await GetPlayerBackends();
+  const selectedMpv = profileId ? await GetSelectedMpv(profileId) : '';
+  const mpvOptions = profileId ? await GetMpvOptions(profileId) : '';
+  const selectedBackend = profileId ? await GetSelectedPlayerBackend(profileId) : 'mpv';
+  const playerCommand = profileId ? await GetPlayerCommand(profileId) : '';
+  const playerSettings = profileId ? await GetPlayerSettings(profileId) : {};
+  const maxHeights = [480, 720, 1080, 1440, 2160];
+  const maxHeight = playerSettings.maxHeight || 1080;
+  const remoteURL = await GetRemoteURL();
+  const browserSettings = profileId ? await GetBrowserSettings(profileId) : {};
+  const warmTabOptions = [0, 2, 3, 4, 6];
 
   const overlay = document.createElement('div');
   overlay.className = 'dialog-overlay';
@@ -849,6 +1023,28 @@ async function showSettingsDialog() {
             <span>${escapeHtml(b.name)} (${escapeHtml(b.executable)})</span>
           </label>
         `).join('')}
+        ${profileId ? `
+        <div class="dialog-field" style="margin-top: 12px;">
+          <label>Keep apps open in the background</label>
+          <select id="warmTabsSelect" class="dialog-select">
+            ${warmTabOptions.map(n => `<option value="${n}" ${n === (browserSettings.warmTabs || 0) ? 'selected' : ''}>${n === 0 ? 'Off (close the browser)' : `Up to ${n} apps`}</option>`).join('')}
+          </select>
+        </div>` : ''}
+      </div>
+
+      ${profileId ? `
+      <div class="dialog-section">
+        <div class="dialog-section-title">Media Player</div>
+        ${playerBackends.map(b => `
+          <label class="radio-option">
+            <input type="radio" name="playerBackend" value="${escapeHtml(b.name)}" ${b.name === selectedBackend ? 'checked' : ''}>
+            <span>${escapeHtml(b.displayName)}${b.available ? '' : ' (not found)'}</span>
+          </label>
+        `).join('')}
+        <div class="dialog-field" style="margin-top: 12px;">
+          <label>Custom command</label>
+          <input type="text" id="playerCommandInput" class="dialog-input" value="${escapeHtml(playerCommand)}" placeholder="myplayer --title {title} {urls}">
+        </div>
       </div>
 
       <div class="dialog-section">
@@ -869,6 +1065,45 @@ async function showSettingsDialog() {
         </div>
       </div>
 
+      <div class="dialog-section">
+        <div class="dialog-section-title">Playback</div>
+        <div class="dialog-field">
+          <label>Maximum resolution (YouTube)</label>
+          <select id="maxHeightSelect" class="dialog-select">
+            ${maxHeights.map(h => `<option value="${h}" ${h === maxHeight ? 'selected' : ''}>${h}p</option>`).join('')}
+          </select>
+        </div>
+        <div class="dialog-field">
+          <label>Preferred video codecs</label>
+          <input type="text" id="preferredCodecsInput" class="dialog-input" value="${escapeHtml(playerSettings.preferredCodecs || '')}" placeholder="avc1,vp9">
+        </div>
+        <div class="dialog-field">
+          <label>Cache size</label>
+          <input type="text" id="cacheSizeInput" class="dialog-input" value="${escapeHtml(playerSettings.cacheSize || '')}" placeholder="150M">
+        </div>
+        <div class="dialog-field">
+          <label>Screen (0 = default)</label>
+          <input type="number" id="screenInput" class="dialog-input" min="0" value="${playerSettings.screen || 0}">
+        </div>
+        <label class="checkbox-option">
+          <input type="checkbox" id="fullscreenCheck" ${playerSettings.windowed ? '' : 'checked'}>
+          <span>Play fullscreen</span>
+        </label>
+        <div class="dialog-field">
+          <label>Intros and credits</label>
+          <select id="skipSegmentsSelect" class="dialog-select">
+            <option value="prompt" ${!playerSettings.skipSegments || playerSettings.skipSegments === 'prompt' ? 'selected' : ''}>Offer to skip</option>
+            <option value="auto" ${playerSettings.skipSegments === 'auto' ? 'selected' : ''}>Skip automatically</option>
+            <option value="off" ${playerSettings.skipSegments === 'off' ? 'selected' : ''}>Play them</option>
+          </select>
+        </div>
+        <div class="dialog-field">
+          <label>Ask "still watching?" after items without input (0 = never)</label>
+          <input type="number" id="idleItemsInput" class="dialog-input" min="0" value="${playerSettings.idleItems || 0}">
+        </div>
+      </div>
+      ` : ''}
+
       <div class="dialog-section">
         <div class="dialog-section-title">On-Screen Keyboard</div>
         <label class="checkbox-option">
@@ -877,6 +1112,14 @@ async function showSettingsDialog() {
         </label>
       </div>
 
+      <div class="dialog-section">
+        <div class="dialog-section-title">Phone Remote</div>
+        ${remoteURL
+          ? `<div class="dialog-note">Open this link on a phone on the same network:</div>
+             <div class="dialog-note remote-url">${escapeHtml(remoteURL)}</div>`
+          : '<div class="dialog-note">The phone remote is turned off</div>'}
+      </div>
+
       <div class="dialog-buttons">
         <div class="dialog-spacer"></div>
         <button class="dialog-btn primary-btn" id="settingsCloseBtn">Close</button>
@@ -893,26 +1136,76 @@ async function showSettingsDialog() {
     });
   });
 
+  // Warm browser tabs (per profile)
+  document.getElementById('warmTabsSelect')?.addEventListener('change', async (e) => {
+    const settings = await GetBrowserSettings(profileId);
+    settings.warmTabs = parseInt(e.target.value, 10) || 0;
+    await SetBrowserSettings(profileId, settings);
+  });
+
+  // Player settings are saved per profile; re-read before each change so
+  // the separate setters don't overwrite each other
+  async function updatePlayerSettings(change) {
+    const settings = await GetPlayerSettings(profileId);
+    change(settings);
+    await SetPlayerSettings(profileId, settings);
+  }
+
   // MPV selection
   document.querySelectorAll('input[name="mpv"]').forEach(radio => {
     radio.addEventListener('change', (e) => {
-      SetSelectedMpv(e.target.value);
+      SetSelectedMpv(profileId, e.target.value);
       document.getElementById('mpvCustomPath').value = '';
     });
   });
 
   // Custom MPV path
-  document.getElementById('mpvCustomPath').addEventListener('change', (e) => {
+  document.getElementById('mpvCustomPath')?.addEventListener('change', (e) => {
     const val = e.target.value.trim();
     if (val) {
-      SetSelectedMpv(val);
+      SetSelectedMpv(profileId, val);
       document.querySelectorAll('input[name="mpv"]').forEach(r => r.checked = false);
     }
   });
 
   // MPV options
-  document.getElementById('mpvOptionsInput').addEventListener('change', (e) => {
-    SetMpvOptions(e.target.value);
+  document.getElementById('mpvOptionsInput')?.addEventListener('change', (e) => {
+    SetMpvOptions(profileId, e.target.value);
+  });
+
+  // Player backend (per profile)
+  document.querySelectorAll('input[name="playerBackend"]').forEach(radio => {
+    radio.addEventListener('change', (e) => {
+      SetSelectedPlayerBackend(profileId, e.target.value);
+    });
+  });
+
+  // Custom player command (per profile)
+  document.getElementById('playerCommandInput')?.addEventListener('change', (e) => {
+    SetPlayerCommand(profileId, e.target.value.trim());
+  });
+
+  // Playback quality and placement
+  document.getElementById('maxHeightSelect')?.addEventListener('change', (e) => {
+    updatePlayerSettings(s => { s.maxHeight = parseInt(e.target.value, 10); });
+  });
+  document.getElementById('preferredCodecsInput')?.addEventListener('change', (e) => {
+    updatePlayerSettings(s => { s.preferredCodecs = e.target.value.trim(); });
+  });
+  document.getElementById('cacheSizeInput')?.addEventListener('change', (e) => {
+    updatePlayerSettings(s => { s.cacheSize = e.target.value.trim(); });
+  });
+  document.getElementById('screenInput')?.addEventListener('change', (e) => {
+    updatePlayerSettings(s => { s.screen = Math.max(0, parseInt(e.target.value, 10) || 0); });
+  });
+  document.getElementById('fullscreenCheck')?.addEventListener('change', (e) => {
+    updatePlayerSettings(s => { s.windowed = !e.target.checked; });
+  });
+  document.getElementById('skipSegmentsSelect')?.addEventListener('change', (e) => {
+    updatePlayerSettings(s => { s.skipSegments = e.target.value; });
+  });
+  document.getElementById('idleItemsInput')?.addEventListener('change', (e) => {
+    updatePlayerSettings(s => { s.idleItems = Math.max(0, parseInt(e.target.value, 10) || 0); });
   });
 
   // OSK enabled
@@ -1032,6 +1325,73 @@ function showAppEditDialog(index) {
         </label>
       </div>
 
+      <div class="dialog-field checkbox-field website-field" ${app.type !== 0 ? 'style="display:none"' : ''}>
+        <label>
+          <input type="checkbox" id="appUblock" ${browserLoads(app.browser, 'ublock-origin') ? 'checked' : ''}>
+          Block ads (uBlock Origin)
+        </label>
+      </div>
+
+      <div class="dialog-field checkbox-field website-field" ${app.type !== 0 ? 'style="display:none"' : ''}>
+        <label>
+          <input type="checkbox" id="appDarkReader" ${browserLoads(app.browser, 'dark-reader') ? 'checked' : ''}>
+          Dark Reader
+        </label>
+      </div>
+
+      <div class="dialog-field checkbox-field website-field" ${app.type !== 0 ? 'style="display:none"' : ''}>
+        <label>
+          <input type="checkbox" id="appDarkMode" ${app.browser?.darkMode === false ? '' : 'checked'}>
+          Dark mode
+        </label>
+      </div>
+
+      <div class="dialog-field website-field" ${app.type !== 0 ? 'style="display:none"' : ''}>
+        <label>Display scale</label>
+        <input type="number" id="appScale" class="dialog-input" min="0.25" max="5" step="0.05" value="${app.browser?.scale || 1}">
+      </div>
+
+      <div class="dialog-field website-field" ${app.type !== 0 ? 'style="display:none"' : ''}>
+        <label>User agent</label>
+        <input type="text" id="appUserAgent" class="dialog-input" value="${escapeHtml(app.browser?.userAgent || '')}" placeholder="Browser default">
+      </div>
+
+      <div class="dialog-field checkbox-field website-field" ${app.type !== 0 ? 'style="display:none"' : ''}>
+        <label>
+          <input type="checkbox" id="appKiosk" ${app.browser?.kiosk ? 'checked' : ''}>
+          Kiosk lockdown (stay on the app's sites)
+        </label>
+      </div>
+
+      <div class="dialog-field website-field" ${app.type !== 0 ? 'style="display:none"' : ''}>
+        <label>Also allow domains</label>
+        <input type="text" id="appKioskDomains" class="dialog-input" value="${escapeHtml((app.browser?.kioskDomains || []).join(' '))}" placeholder="accounts.google.com">
+      </div>
+
+      <div class="dialog-field website-field" ${app.type !== 0 ? 'style="display:none"' : ''}>
+        <label>Browser mode</label>
+        <select id="appBrowserMode" class="dialog-select">
+          <option value="" ${!app.browser?.mode ? 'selected' : ''}>Default</option>
+          <option value="extension" ${app.browser?.mode === 'extension' ? 'selected' : ''}>Extension</option>
+          <option value="cdp" ${app.browser?.mode === 'cdp' ? 'selected' : ''}>DevTools (Chrome only)</option>
+        </select>
+      </div>
+
+      <div class="dialog-field website-field" ${app.type !== 0 ? 'style="display:none"' : ''}>
+        <label>If the page crashes or hangs</label>
+        <select id="appOnHang" class="dialog-select">
+          <option value="" ${!app.browser?.onHang ? 'selected' : ''}>Reload it</option>
+          <option value="restart" ${app.browser?.onHang === 'restart' ? 'selected' : ''}>Restart the browser</option>
+          <option value="launcher" ${app.browser?.onHang === 'launcher' ? 'selected' : ''}>Return to the launcher</option>
+          <option value="none" ${app.browser?.onHang === 'none' ? 'selected' : ''}>Do nothing</option>
+        </select>
+      </div>
+
+      <div class="dialog-field website-field" ${app.type !== 0 ? 'style="display:none"' : ''}>
+        <label>Extra browser flags</label>
+        <input type="text" id="appBrowserFlags" class="dialog-input" value="${escapeHtml((app.browser?.flags || []).join(' '))}" placeholder="--flag --other-flag=value">
+      </div>
+
       <div class="dialog-buttons">
         <button class="dialog-btn delete-btn" id="appDeleteBtn">Delete</button>
         <div class="dialog-spacer"></div>
@@ -1167,6 +1527,7 @@ function showAppEditDialog(index) {
     app.colorValue = selectedColor;
     app.showName = document.getElementById('appShowName').checked;
     app.focusAlert = type === 0 ? document.getElementById('appFocusAlert').checked : false;
+    app.browser = type === 0 ? readBrowserOptions(app.browser) : null;
 
     await saveApps();
     closeDialog();
@@ -1174,6 +1535,38 @@ function showAppEditDialog(index) {
   });
 }
 
+// Whether the app loads a bundled extension; apps without browser options
+// load all of them
+function browserLoads(options, extension) {
+  if (extension === 'dark-reader' && options?.darkMode === false) return false;
+  return !options?.extensions || options.extensions.includes(extension);
+}
+
+// Browser options from the app dialog, or null when all are at their
+// defaults. The managed policy from the service JSON isn't in the dialog
+// and is kept from current.
+function readBrowserOptions(current) {
+  const extensions = ['ublock-origin', 'dark-reader'].filter(ext =>
+    document.getElementById(ext === 'ublock-origin' ? 'appUblock' : 'appDarkReader').checked);
+  const flags = document.getElementById('appBrowserFlags').value.trim();
+  const scale = parseFloat(document.getElementById('appScale').value);
+  const kioskDomains = document.getElementById('appKioskDomains').value.trim();
+
+  const options = {
+    extensions: extensions.length === 2 ? null : extensions,
+    flags: flags ? flags.split(/\s+/) : null,
+    darkMode: document.getElementById('appDarkMode').checked ? null : false,
+    scale: scale > 0 && scale !== 1 ? scale : null,
+    userAgent: document.getElementById('appUserAgent').value.trim() || null,
+    mode: document.getElementById('appBrowserMode').value || null,
+    kiosk: document.getElementById('appKiosk').checked || null,
+    kioskDomains: kioskDomains ? kioskDomains.split(/[\s,]+/) : null,
+    policy: current?.policy || null,
+    onHang: document.getElementById('appOnHang').value || null,
+  };
+  return Object.values(options).every(v => v === null) ? null : options;
+}
+
 function toggleMenu() {
   const menu = document.getElementById('sideMenu');
   const overlay = document.getElementById('menuOverlay');
@@ -1629,6 +2022,7 @@ async function addService(service) {
     colorValue: service.colorValue || 0xFF333333,
     showName: !service.hasLogo,
     focusAlert: service.focusAlert || false,
+    browser: service.browser || null,
   };
 
   apps.push(newApp);
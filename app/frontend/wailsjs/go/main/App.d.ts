@@ -10,6 +10,8 @@ export function DeleteProfile(arg1:string):Promise<void>;
 
 export function GetApps(arg1:string):Promise<Array<main.AppConfig>>;
 
+export function GetBrowserSettings(arg1:string):Promise<main.BrowserSettings>;
+
 export function GetBrowsers():Promise<Array<main.BrowserInfo>>;
 
 export function GetInitialApp():Promise<string>;
@@ -18,17 +20,27 @@ export function GetInitialUser():Promise<string>;
 
 export function GetLogoPath():Promise<string>;
 
-export function GetMpvOptions():Promise<string>;
+export function GetMpvOptions(arg1:string):Promise<string>;
 
 export function GetMpvPaths():Promise<Array<string>>;
 
+export function GetPlayerBackends():Promise<Array<main.PlayerBackendInfo>>;
+
+export function GetPlayerCommand(arg1:string):Promise<string>;
+
+export function GetPlayerSettings(arg1:string):Promise<main.PlayerSettings>;
+
 export function GetProfileCount():Promise<number>;
 
 export function GetProfilePhotos():Promise<Array<string>>;
 
 export function GetProfiles():Promise<Array<main.Profile>>;
 
-export function GetSelectedMpv():Promise<string>;
+export function GetRemoteURL():Promise<string>;
+
+export function GetSelectedMpv(arg1:string):Promise<string>;
+
+export function GetSelectedPlayerBackend(arg1:string):Promise<string>;
 
 export function GetServerPort():Promise<number>;
 
@@ -42,8 +54,16 @@ export function Quit():Promise<void>;
 
 export function SaveApps(arg1:string,arg2:Array<main.AppConfig>):Promise<void>;
 
-export function SetMpvOptions(arg1:string):Promise<void>;
+export function SetBrowserSettings(arg1:string,arg2:main.BrowserSettings):Promise<void>;
+
+export function SetMpvOptions(arg1:string,arg2:string):Promise<void>;
+
+export function SetPlayerCommand(arg1:string,arg2:string):Promise<void>;
+
+export function SetPlayerSettings(arg1:string,arg2:main.PlayerSettings):Promise<void>;
+
+export function SetSelectedMpv(arg1:string,arg2:string):Promise<void>;
 
-export function SetSelectedMpv(arg1:string):Promise<void>;
+export function SetSelectedPlayerBackend(arg1:string,arg2:string):Promise<void>;
 
 export function UpdateProfile(arg1:string,arg2:string,arg3:number,arg4:string,arg5:number):Promise<void>;
@@ -18,6 +18,10 @@ export function GetApps(arg1) {
   return window['go']['main']['App']['GetApps'](arg1);
 }
 
+export function GetBrowserSettings(arg1) {
+  return window['go']['main']['App']['GetBrowserSettings'](arg1);
+}
+
 export function GetBrowsers() {
   return window['go']['main']['App']['GetBrowsers']();
 }
@@ -34,14 +38,26 @@ export function GetLogoPath() {
   return window['go']['main']['App']['GetLogoPath']();
 }
 
-export function GetMpvOptions() {
-  return window['go']['main']['App']['GetMpvOptions']();
+export function GetMpvOptions(arg1) {
+  return window['go']['main']['App']['GetMpvOptions'](arg1);
 }
 
 export function GetMpvPaths() {
   return window['go']['main']['App']['GetMpvPaths']();
 }
 
+export function GetPlayerBackends() {
+  return window['go']['main']['App']['GetPlayerBackends']();
+}
+
+export function GetPlayerCommand(arg1) {
+  return window['go']['main']['App']['GetPlayerCommand'](arg1);
+}
+
+export function GetPlayerSettings(arg1) {
+  return window['go']['main']['App']['GetPlayerSettings'](arg1);
+}
+
 export function GetProfileCount() {
   return window['go']['main']['App']['GetProfileCount']();
 }
@@ -54,8 +70,16 @@ export function GetProfiles() {
   return window['go']['main']['App']['GetProfiles']();
 }
 
-export function GetSelectedMpv() {
-  return window['go']['main']['App']['GetSelectedMpv']();
+export function GetRemoteURL() {
+  return window['go']['main']['App']['GetRemoteURL']();
+}
+
+export function GetSelectedMpv(arg1) {
+  return window['go']['main']['App']['GetSelectedMpv'](arg1);
+}
+
+export function GetSelectedPlayerBackend(arg1) {
+  return window['go']['main']['App']['GetSelectedPlayerBackend'](arg1);
 }
 
 export function GetServerPort() {
@@ -82,12 +106,28 @@ export function SaveApps(arg1, arg2) {
   return window['go']['main']['App']['SaveApps'](arg1, arg2);
 }
 
-export function SetMpvOptions(arg1) {
-  return window['go']['main']['App']['SetMpvOptions'](arg1);
+export function SetBrowserSettings(arg1, arg2) {
+  return window['go']['main']['App']['SetBrowserSettings'](arg1, arg2);
+}
+
+export function SetMpvOptions(arg1, arg2) {
+  return window['go']['main']['App']['SetMpvOptions'](arg1, arg2);
+}
+
+export function SetPlayerCommand(arg1, arg2) {
+  return window['go']['main']['App']['SetPlayerCommand'](arg1, arg2);
+}
+
+export function SetPlayerSettings(arg1, arg2) {
+  return window['go']['main']['App']['SetPlayerSettings'](arg1, arg2);
+}
+
+export function SetSelectedMpv(arg1, arg2) {
+  return window['go']['main']['App']['SetSelectedMpv'](arg1, arg2);
 }
 
-export function SetSelectedMpv(arg1) {
-  return window['go']['main']['App']['SetSelectedMpv'](arg1);
+export function SetSelectedPlayerBackend(arg1, arg2) {
+  return window['go']['main']['App']['SetSelectedPlayerBackend'](arg1, arg2);
 }
 
 export function UpdateProfile(arg1, arg2, arg3, arg4, arg5) {
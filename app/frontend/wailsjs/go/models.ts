@@ -11,6 +11,7 @@ export namespace main {
 	    showName: boolean;
 	    focusAlert?: boolean;
 	    serviceId?: string;
+	    browser?: BrowserOptions;
 	
 	    static createFrom(source: any = {}) {
 	        return new AppConfig(source);
@@ -28,12 +29,33 @@ export namespace main {
 	        this.showName = source["showName"];
 	        this.focusAlert = source["focusAlert"];
 	        this.serviceId = source["serviceId"];
+	        this.browser = this.convertValues(source["browser"], BrowserOptions);
 	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
 	export class BrowserInfo {
 	    name: string;
 	    executable: string;
 	    fullscreenFlag: string;
+	    dialect: string;
+	    cdp: boolean;
 	
 	    static createFrom(source: any = {}) {
 	        return new BrowserInfo(source);
@@ -44,6 +66,100 @@ export namespace main {
 	        this.name = source["name"];
 	        this.executable = source["executable"];
 	        this.fullscreenFlag = source["fullscreenFlag"];
+	        this.dialect = source["dialect"];
+	        this.cdp = source["cdp"];
+	    }
+	}
+	export class BrowserOptions {
+	    extensions: string[];
+	    flags?: string[];
+	    darkMode?: boolean;
+	    userAgent?: string;
+	    scale?: number;
+	    mode?: string;
+	    kiosk?: boolean;
+	    kioskDomains?: string[];
+	    policy?: {[key: string]: any};
+	    onHang?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new BrowserOptions(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.extensions = source["extensions"];
+	        this.flags = source["flags"];
+	        this.darkMode = source["darkMode"];
+	        this.userAgent = source["userAgent"];
+	        this.scale = source["scale"];
+	        this.mode = source["mode"];
+	        this.kiosk = source["kiosk"];
+	        this.kioskDomains = source["kioskDomains"];
+	        this.policy = source["policy"];
+	        this.onHang = source["onHang"];
+	    }
+	}
+	export class BrowserSettings {
+	    warmTabs?: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new BrowserSettings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.warmTabs = source["warmTabs"];
+	    }
+	}
+	export class PlayerBackendInfo {
+	    name: string;
+	    displayName: string;
+	    available: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new PlayerBackendInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.displayName = source["displayName"];
+	        this.available = source["available"];
+	    }
+	}
+	export class PlayerSettings {
+	    backend?: string;
+	    command?: string;
+	    mpvPath?: string;
+	    mpvOptions?: string;
+	    maxHeight?: number;
+	    cacheSize?: string;
+	    backCacheSize?: string;
+	    preferredCodecs?: string;
+	    windowed?: boolean;
+	    screen?: number;
+	    idleItems?: number;
+	    skipSegments?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new PlayerSettings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.backend = source["backend"];
+	        this.command = source["command"];
+	        this.mpvPath = source["mpvPath"];
+	        this.mpvOptions = source["mpvOptions"];
+	        this.maxHeight = source["maxHeight"];
+	        this.cacheSize = source["cacheSize"];
+	        this.backCacheSize = source["backCacheSize"];
+	        this.preferredCodecs = source["preferredCodecs"];
+	        this.windowed = source["windowed"];
+	        this.screen = source["screen"];
+	        this.idleItems = source["idleItems"];
+	        this.skipSegments = source["skipSegments"];
 	    }
 	}
 	export class Profile {
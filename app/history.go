@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Anything watched past this fraction of its duration counts as completed
+const historyCompletedRatio = 0.9
+
+// Resuming closer than this to the start isn't worth it
+const historyMinResumePosition = 10.0
+
+// HistoryEntry is the locally remembered playback state of one item
+type HistoryEntry struct {
+	Key         string    `json:"key"`
+	URL         string    `json:"url"`
+	ItemID      string    `json:"itemId,omitempty"`
+	Title       string    `json:"title,omitempty"`
+	Service     string    `json:"service,omitempty"`
+	Position    float64   `json:"position"`
+	Duration    float64   `json:"duration"`
+	Completed   bool      `json:"completed"`
+	FirstPlayed time.Time `json:"firstPlayed"`
+	LastPlayed  time.Time `json:"lastPlayed"`
+}
+
+// WatchHistory stores what each profile played in
+// profiles/<id>/history.json, keyed by ItemID or, failing that, URL.
+type WatchHistory struct {
+	mu        sync.Mutex
+	dataDir   string
+	profiles  map[string]map[string]*HistoryEntry
+	lastSaved map[string]time.Time
+}
+
+func NewWatchHistory(dataDir string) *WatchHistory {
+	return &WatchHistory{
+		dataDir:   dataDir,
+		profiles:  make(map[string]map[string]*HistoryEntry),
+		lastSaved: make(map[string]time.Time),
+	}
+}
+
+// historyKey picks the identifier an item is remembered by
+func historyKey(itemID, url string) string {
+	if itemID != "" {
+		return itemID
+	}
+	return url
+}
+
+func (h *WatchHistory) filePath(profileID string) (string, error) {
+	return profileFile(h.dataDir, profileID, "history.json")
+}
+
+// entries returns the loaded history for a profile. Must be called with h.mu held.
+func (h *WatchHistory) entries(profileID string) map[string]*HistoryEntry {
+	if entries, ok := h.profiles[profileID]; ok {
+		return entries
+	}
+
+	entries := make(map[string]*HistoryEntry)
+	path, err := h.filePath(profileID)
+	if err != nil {
+		// Not a profile: nothing to load, and nothing worth keeping
+		return entries
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		var list []*HistoryEntry
+		if err := json.Unmarshal(data, &list); err != nil {
+			Log("WatchHistory: failed to parse history for profile %s: %v", profileID, err)
+		}
+		for _, e := range list {
+			entries[e.Key] = e
+		}
+	}
+	h.profiles[profileID] = entries
+	return entries
+}
+
+// save writes a profile's history to disk. Must be called with h.mu held.
+func (h *WatchHistory) save(profileID string) {
+	list := h.sorted(profileID)
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return
+	}
+
+	path, err := h.filePath(profileID)
+	if err != nil {
+		Log("WatchHistory: not saving history for profile %s: %v", profileID, err)
+		return
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		Log("WatchHistory: failed to save history for profile %s: %v", profileID, err)
+	}
+	h.lastSaved[profileID] = time.Now()
+}
+
+// sorted returns copies of a profile's entries, most recent first. Must be
+// called with h.mu held.
+func (h *WatchHistory) sorted(profileID string) []HistoryEntry {
+	entries := h.entries(profileID)
+	list := make([]HistoryEntry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, *e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].LastPlayed.After(list[j].LastPlayed)
+	})
+	return list
+}
+
+// Update records the latest position of an item. Writes to disk are batched
+// unless flush is set, since progress arrives every few seconds.
+func (h *WatchHistory) Update(profileID string, entry HistoryEntry, flush bool) {
+	if profileID == "" {
+		return
+	}
+	entry.Key = historyKey(entry.ItemID, entry.URL)
+	if entry.Key == "" {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := h.entries(profileID)
+	now := time.Now()
+	existing, ok := entries[entry.Key]
+	if !ok {
+		existing = &HistoryEntry{Key: entry.Key, FirstPlayed: now}
+		entries[entry.Key] = existing
+	}
+
+	existing.URL = entry.URL
+	if entry.ItemID != "" {
+		existing.ItemID = entry.ItemID
+	}
+	if entry.Title != "" {
+		existing.Title = entry.Title
+	}
+	if entry.Service != "" {
+		existing.Service = entry.Service
+	}
+	existing.Position = entry.Position
+	if entry.Duration > 0 {
+		existing.Duration = entry.Duration
+	}
+	existing.Completed = existing.Duration > 0 && existing.Position >= existing.Duration*historyCompletedRatio
+	existing.LastPlayed = now
+
+	if flush || now.Sub(h.lastSaved[profileID]) >= 30*time.Second {
+		h.save(profileID)
+	}
+}
+
+// Get returns the history entry for an ItemID or URL
+func (h *WatchHistory) Get(profileID, key string) (HistoryEntry, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if e, ok := h.entries(profileID)[key]; ok {
+		return *e, true
+	}
+	return HistoryEntry{}, false
+}
+
+// ResumePosition returns where playback of an item should resume, or 0 if it
+// was finished or barely started.
+func (h *WatchHistory) ResumePosition(profileID, itemID, url string) float64 {
+	e, ok := h.Get(profileID, historyKey(itemID, url))
+	if !ok || e.Completed || e.Position < historyMinResumePosition {
+		return 0
+	}
+	return e.Position
+}
+
+// List returns a profile's history, most recently played first
+func (h *WatchHistory) List(profileID string) []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.sorted(profileID)
+}
+
+// Delete forgets one item
+func (h *WatchHistory) Delete(profileID, key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.entries(profileID), key)
+	h.save(profileID)
+}
+
+// Clear forgets a profile's entire history
+func (h *WatchHistory) Clear(profileID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.profiles[profileID] = make(map[string]*HistoryEntry)
+	h.save(profileID)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWatchHistoryUnknownProfile(t *testing.T) {
+	root := t.TempDir()
+	dataDir := filepath.Join(root, "data")
+	writeTestProfile(t, dataDir, "alice")
+
+	h := NewWatchHistory(dataDir)
+	h.Clear("../..")
+	h.Update("../..", HistoryEntry{URL: "https://example.com/v"}, true)
+	if _, err := os.Stat(filepath.Join(root, "history.json")); !os.IsNotExist(err) {
+		t.Errorf("history written outside profiles/: %v", err)
+	}
+}
+
+func TestWatchHistorySaveAndResume(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestProfile(t, dataDir, "alice")
+
+	h := NewWatchHistory(dataDir)
+	h.Update("alice", HistoryEntry{URL: "https://example.com/a", Position: 120, Duration: 600}, true)
+	h.Update("alice", HistoryEntry{ItemID: "b", URL: "https://example.com/b", Position: 590, Duration: 600}, true)
+	h.Update("alice", HistoryEntry{ItemID: "c", URL: "https://example.com/c", Position: 5, Duration: 600}, true)
+
+	// A fresh instance reads what was saved
+	h = NewWatchHistory(dataDir)
+	tests := []struct {
+		itemID, url string
+		want        float64
+	}{
+		{"", "https://example.com/a", 120},
+		{"b", "https://example.com/b", 0}, // completed
+		{"c", "https://example.com/c", 0}, // barely started
+		{"", "https://example.com/new", 0},
+	}
+	for _, tt := range tests {
+		if got := h.ResumePosition("alice", tt.itemID, tt.url); got != tt.want {
+			t.Errorf("ResumePosition(%q, %q) = %v, want %v", tt.itemID, tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestResumePlaylist(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestProfile(t, dataDir, "alice")
+	h := NewWatchHistory(dataDir)
+	h.Update("alice", HistoryEntry{ItemID: "a", URL: "https://example.com/a", Position: 120, Duration: 600}, true)
+	s := &Server{history: h}
+
+	tests := []struct {
+		name          string
+		startPosition float64
+		resume        bool
+		wantStart     float64
+		wantResumed   bool
+	}{
+		{"not asked", 0, false, 0, false},
+		{"asked", 0, true, 120, true},
+		{"start position wins", 30, true, 30, false},
+	}
+	for _, tt := range tests {
+		req := playlistRequest{
+			Items:         []PlaylistItem{{ItemID: "a", URL: "https://example.com/a"}},
+			StartPosition: tt.startPosition,
+			Resume:        tt.resume,
+			ProfileID:     "alice",
+		}
+		saved, resumed := s.resumePlaylist(&req)
+		if saved != 120 || resumed != tt.wantResumed || req.StartPosition != tt.wantStart {
+			t.Errorf("%s: got saved %v, resumed %v, start %v", tt.name, saved, resumed, req.StartPosition)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KioskPolicy keeps a launched app on its own sites. Pages outside Domains,
+// including chrome:// and other browser pages, send the tab back to Home.
+type KioskPolicy struct {
+	Home    string   `json:"home"`
+	Domains []string `json:"domains"`
+}
+
+// newKioskPolicy builds the policy for app from its URL, MatchURLs and any
+// extra domains in its browser options, or returns nil when the app doesn't
+// use kiosk lockdown
+func newKioskPolicy(app AppConfig) *KioskPolicy {
+	if app.Browser == nil || !app.Browser.Kiosk {
+		return nil
+	}
+
+	p := &KioskPolicy{Home: app.URL}
+	seen := map[string]bool{}
+	sources := append([]string{app.URL}, app.MatchURLs...)
+	sources = append(sources, app.Browser.KioskDomains...)
+	for _, source := range sources {
+		if domain := kioskDomain(source); domain != "" && !seen[domain] {
+			seen[domain] = true
+			p.Domains = append(p.Domains, domain)
+		}
+	}
+	return p
+}
+
+// kioskDomain returns the host of a URL or bare domain, without "www."
+func kioskDomain(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// Allows reports whether the tab may show rawURL. Blank pages are allowed
+// since new tabs and popups start out as one.
+func (p *KioskPolicy) Allows(rawURL string) bool {
+	if rawURL == "" || rawURL == "about:blank" {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	if err == nil && u.Scheme == "chrome-error" {
+		// Sending a failed load home again would just loop
+		return true
+	}
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || host == "127.0.0.1" {
+		return true
+	}
+	for _, domain := range p.Domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// kioskPopupGrace is how long a new tab may stay blank before it is closed
+const kioskPopupGrace = 3 * time.Second
+
+// KioskGuard enforces a KioskPolicy on the browser behind a CDP client. It
+// keeps the current tab as the app's tab: new tabs and popups are closed,
+// and the ones for the app's own sites are opened in the app's tab instead.
+// Tabs that were already open, like other apps' warm tabs, are left alone.
+type KioskGuard struct {
+	mu     sync.Mutex
+	policy *KioskPolicy
+	cdp    *CDPClient
+	mainID string
+	closed map[string]bool // popups already dealt with, and tabs to leave alone
+	stop   chan struct{}
+}
+
+func NewKioskGuard(policy *KioskPolicy, cdp *CDPClient) *KioskGuard {
+	return &KioskGuard{
+		policy: policy,
+		cdp:    cdp,
+		closed: map[string]bool{},
+		stop:   make(chan struct{}),
+	}
+}
+
+// Policy returns the policy being enforced
+func (g *KioskGuard) Policy() *KioskPolicy {
+	return g.policy
+}
+
+// Start waits for the browser's DevTools port and watches its tabs until
+// Stop is called or the browser exits
+func (g *KioskGuard) Start() {
+	go func() {
+		deadline := time.Now().Add(30 * time.Second)
+		for !g.cdp.Available() {
+			if time.Now().After(deadline) {
+				Log("Kiosk: browser never reported its DevTools port, lockdown off")
+				return
+			}
+			select {
+			case <-g.stop:
+				return
+			case <-time.After(200 * time.Millisecond):
+			}
+		}
+
+		if targets, err := g.cdp.Targets(); err == nil {
+			g.mu.Lock()
+			for _, t := range targets {
+				if t.Type != "page" {
+					continue
+				}
+				if g.mainID == "" {
+					g.mainID = t.ID
+				} else {
+					g.closed[t.ID] = true
+				}
+			}
+			g.mu.Unlock()
+		}
+
+		Log("Kiosk: keeping browser on %s", strings.Join(g.policy.Domains, ", "))
+		if err := g.cdp.WatchTargets(g.stop, g.handleTarget); err != nil {
+			Log("Kiosk: stopped watching: %v", err)
+		}
+	}()
+}
+
+// Stop ends the lockdown
+func (g *KioskGuard) Stop() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	select {
+	case <-g.stop:
+	default:
+		close(g.stop)
+	}
+}
+
+func (g *KioskGuard) handleTarget(event string, info CDPTargetInfo) {
+	g.mu.Lock()
+	if g.mainID == "" && info.Type == "page" && event != "Target.targetDestroyed" {
+		g.mainID = info.TargetID
+	}
+	mainID := g.mainID
+	if event == "Target.targetDestroyed" {
+		if info.TargetID == mainID {
+			g.mainID = ""
+		}
+		delete(g.closed, info.TargetID)
+	}
+	handled := g.closed[info.TargetID]
+	g.mu.Unlock()
+
+	if info.Type != "page" || handled {
+		return
+	}
+
+	if info.TargetID == mainID {
+		if !g.policy.Allows(info.URL) {
+			Log("Kiosk: blocked %s, returning to %s", info.URL, g.policy.Home)
+			g.navigateMain(mainID, g.policy.Home)
+		}
+		return
+	}
+
+	// A new tab or popup
+	switch {
+	case info.URL == "" || info.URL == "about:blank":
+		if event == "Target.targetCreated" {
+			time.AfterFunc(kioskPopupGrace, func() { g.closeIfBlank(info.TargetID) })
+		}
+	case g.policy.Allows(info.URL):
+		Log("Kiosk: opening popup %s in the app tab", info.URL)
+		g.closeTab(info.TargetID)
+		g.navigateMain(mainID, info.URL)
+	default:
+		Log("Kiosk: closed popup %s", info.URL)
+		g.closeTab(info.TargetID)
+	}
+}
+
+func (g *KioskGuard) navigateMain(mainID, url string) {
+	if mainID == "" {
+		return
+	}
+	if err := g.cdp.Navigate(CDPTarget{ID: mainID}, url); err != nil {
+		Log("Kiosk: navigate failed: %v", err)
+	}
+	g.cdp.ActivateTarget(mainID)
+}
+
+func (g *KioskGuard) closeTab(id string) {
+	g.mu.Lock()
+	g.closed[id] = true
+	g.mu.Unlock()
+	if err := g.cdp.CloseTarget(id); err != nil {
+		Log("Kiosk: close failed: %v", err)
+	}
+}
+
+// closeIfBlank closes a popup that never loaded anything
+func (g *KioskGuard) closeIfBlank(id string) {
+	select {
+	case <-g.stop:
+		return
+	default:
+	}
+	targets, err := g.cdp.Targets()
+	if err != nil {
+		return
+	}
+	for _, t := range targets {
+		if t.ID == id && (t.URL == "" || t.URL == "about:blank") {
+			Log("Kiosk: closed blank popup")
+			g.closeTab(id)
+		}
+	}
+}
+
+// handleKiosk tells the launchtube extension the policy of the running app
+func (s *Server) handleKiosk(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	s.browserMu.Lock()
+	guard := s.kiosk
+	s.browserMu.Unlock()
+
+	if guard == nil {
+		fmt.Fprintf(w, `{"enabled":false}`)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled": true,
+		"home":    guard.Policy().Home,
+		"domains": guard.Policy().Domains,
+	})
+}
+
+// handleBrowserHome sends the browser back to the start page of the
+// running app
+func (s *Server) handleBrowserHome(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "POST" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.browserMu.Lock()
+	home := s.browserHome
+	s.browserMu.Unlock()
+
+	browser := s.ActiveBrowser()
+	if home == "" || !browser.IsRunning() {
+		http.Error(w, `{"error":"No app is open"}`, http.StatusConflict)
+		return
+	}
+	writeBrowserInputResult(w, browser.Navigate(home))
+}
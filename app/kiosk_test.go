@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewKioskPolicy(t *testing.T) {
+	if p := newKioskPolicy(AppConfig{URL: "https://www.netflix.com/browse"}); p != nil {
+		t.Errorf("policy without browser options: %+v", p)
+	}
+	if p := newKioskPolicy(AppConfig{URL: "https://www.netflix.com/browse", Browser: &BrowserOptions{}}); p != nil {
+		t.Errorf("policy with kiosk off: %+v", p)
+	}
+
+	app := AppConfig{
+		URL:       "https://www.netflix.com/browse",
+		MatchURLs: []string{"netflix.com", "https://assets.NFLXext.com/x"},
+		Browser:   &BrowserOptions{Kiosk: true, KioskDomains: []string{" accounts.google.com ", ""}},
+	}
+	want := &KioskPolicy{
+		Home:    "https://www.netflix.com/browse",
+		Domains: []string{"netflix.com", "assets.nflxext.com", "accounts.google.com"},
+	}
+	if p := newKioskPolicy(app); !reflect.DeepEqual(p, want) {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+}
+
+func TestKioskPolicyAllows(t *testing.T) {
+	p := &KioskPolicy{Home: "https://www.netflix.com/browse", Domains: []string{"netflix.com", "accounts.google.com"}}
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://www.netflix.com/watch/1", true},
+		{"https://netflix.com/", true},
+		{"http://help.NETFLIX.com/", true},
+		{"https://accounts.google.com/signin", true},
+		{"", true},
+		{"about:blank", true},
+		{"chrome-error://chromewebdata/", true},
+		{"http://localhost:8765/api/1/ping", true},
+		{"http://127.0.0.1:8765/", true},
+		{"https://notnetflix.com/", false},
+		{"https://netflix.com.evil.example/", false},
+		{"https://www.google.com/", false},
+		{"chrome://settings", false},
+		{"file:///etc/passwd", false},
+		{"javascript:alert(1)", false},
+	}
+	for _, tt := range tests {
+		if got := p.Allows(tt.url); got != tt.want {
+			t.Errorf("Allows(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// TestMain keeps Log from writing to the real launchtube.log
+func TestMain(m *testing.M) {
+	home, err := os.MkdirTemp("", "launchtube-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("HOME", home)
+	code := m.Run()
+	os.RemoveAll(home)
+	os.Exit(code)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+const (
+	mprisBusName     = "org.mpris.MediaPlayer2.launchtube"
+	mprisPath        = dbus.ObjectPath("/org/mpris/MediaPlayer2")
+	mprisRootIface   = "org.mpris.MediaPlayer2"
+	mprisPlayerIface = "org.mpris.MediaPlayer2.Player"
+	mprisNoTrack     = dbus.ObjectPath("/org/mpris/MediaPlayer2/TrackList/NoTrack")
+)
+
+// MPRIS publishes the external player on the D-Bus session bus as an
+// org.mpris.MediaPlayer2 object, so media keys, KDE Connect and "now
+// playing" widgets can see and control it. State follows the player events
+// on the EventHub. The bus is found through DBUS_SESSION_BUS_ADDRESS, so a
+// private dbus-daemon works for testing.
+type MPRIS struct {
+	conn   *dbus.Conn
+	player *Player
+	props  *prop.Properties
+}
+
+// mprisRoot implements the org.mpris.MediaPlayer2 methods
+type mprisRoot struct{}
+
+func (mprisRoot) Raise() *dbus.Error { return nil }
+func (mprisRoot) Quit() *dbus.Error  { return nil }
+
+// mprisPlayer implements the org.mpris.MediaPlayer2.Player methods
+type mprisPlayer struct {
+	player *Player
+}
+
+func mprisError(err error) *dbus.Error {
+	if err == nil {
+		return nil
+	}
+	return dbus.MakeFailedError(err)
+}
+
+func (m mprisPlayer) Next() *dbus.Error     { return mprisError(m.player.Next()) }
+func (m mprisPlayer) Previous() *dbus.Error { return mprisError(m.player.Previous()) }
+func (m mprisPlayer) Pause() *dbus.Error    { return mprisError(m.player.SetPaused(true)) }
+func (m mprisPlayer) Play() *dbus.Error     { return mprisError(m.player.SetPaused(false)) }
+func (m mprisPlayer) PlayPause() *dbus.Error {
+	return mprisError(m.player.TogglePause())
+}
+
+func (m mprisPlayer) Stop() *dbus.Error {
+	m.player.Stop()
+	return nil
+}
+
+// SeekBy moves by offset microseconds. It's exported to D-Bus as Seek; the
+// Go name avoids clashing with io.Seeker's signature.
+func (m mprisPlayer) SeekBy(offset int64) *dbus.Error {
+	return mprisError(m.player.Seek(float64(offset)/1e6, true))
+}
+
+// SetPosition jumps to position microseconds if trackID is still current
+func (m mprisPlayer) SetPosition(trackID dbus.ObjectPath, position int64) *dbus.Error {
+	if trackID != mprisTrackID(m.player.State()) {
+		return nil
+	}
+	return mprisError(m.player.Seek(float64(position)/1e6, false))
+}
+
+func (m mprisPlayer) OpenUri(uri string) *dbus.Error {
+	return dbus.MakeFailedError(errPlayerUnsupported)
+}
+
+func mprisTrackID(state PlayerState) dbus.ObjectPath {
+	if !state.Playing {
+		return mprisNoTrack
+	}
+	return dbus.ObjectPath(fmt.Sprintf("/org/launchtube/track/%d", state.PlaylistIndex))
+}
+
+func mprisPlaybackStatus(state PlayerState) string {
+	switch {
+	case !state.Playing:
+		return "Stopped"
+	case state.Paused:
+		return "Paused"
+	default:
+		return "Playing"
+	}
+}
+
+func mprisMetadata(state PlayerState) map[string]dbus.Variant {
+	metadata := map[string]dbus.Variant{
+		"mpris:trackid": dbus.MakeVariant(mprisTrackID(state)),
+	}
+	if !state.Playing {
+		return metadata
+	}
+	if state.Duration > 0 {
+		metadata["mpris:length"] = dbus.MakeVariant(int64(state.Duration * 1e6))
+	}
+	if state.Title != "" {
+		metadata["xesam:title"] = dbus.MakeVariant(state.Title)
+	}
+	return metadata
+}
+
+// StartMPRIS connects to the session bus and publishes the player. It
+// returns nil when there is no session bus or the name is taken.
+func StartMPRIS(player *Player, events *EventHub) *MPRIS {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		Log("MPRIS: no session bus: %v", err)
+		return nil
+	}
+
+	m := &MPRIS{conn: conn, player: player}
+	if err := m.export(); err != nil {
+		Log("MPRIS: export failed: %v", err)
+		conn.Close()
+		return nil
+	}
+
+	reply, err := conn.RequestName(mprisBusName, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		Log("MPRIS: could not own %s (reply=%v): %v", mprisBusName, reply, err)
+		conn.Close()
+		return nil
+	}
+	Log("MPRIS: published as %s", mprisBusName)
+
+	sub, _ := events.Subscribe()
+	go func() {
+		for ev := range sub {
+			m.handleEvent(ev)
+		}
+	}()
+
+	return m
+}
+
+func (m *MPRIS) export() error {
+	state := m.player.State()
+	setVolume := func(c *prop.Change) *dbus.Error {
+		return mprisError(m.player.SetVolume(c.Value.(float64) * 100))
+	}
+	setRate := func(c *prop.Change) *dbus.Error {
+		return mprisError(m.player.SetSpeed(c.Value.(float64)))
+	}
+
+	props, err := prop.Export(m.conn, mprisPath, prop.Map{
+		mprisRootIface: {
+			"CanQuit":             {Value: false, Emit: prop.EmitConst},
+			"CanRaise":            {Value: false, Emit: prop.EmitConst},
+			"HasTrackList":        {Value: false, Emit: prop.EmitConst},
+			"Identity":            {Value: "LaunchTube", Emit: prop.EmitConst},
+			"SupportedUriSchemes": {Value: []string{}, Emit: prop.EmitConst},
+			"SupportedMimeTypes":  {Value: []string{}, Emit: prop.EmitConst},
+		},
+		mprisPlayerIface: {
+			"PlaybackStatus": {Value: mprisPlaybackStatus(state), Emit: prop.EmitTrue},
+			"Rate":           {Value: 1.0, Writable: true, Emit: prop.EmitTrue, Callback: setRate},
+			"Metadata":       {Value: mprisMetadata(state), Emit: prop.EmitTrue},
+			"Volume":         {Value: 1.0, Writable: true, Emit: prop.EmitTrue, Callback: setVolume},
+			"Position":       {Value: int64(0), Emit: prop.EmitFalse},
+			"MinimumRate":    {Value: 0.25, Emit: prop.EmitConst},
+			"MaximumRate":    {Value: 4.0, Emit: prop.EmitConst},
+			"CanGoNext":      {Value: false, Emit: prop.EmitTrue},
+			"CanGoPrevious":  {Value: false, Emit: prop.EmitTrue},
+			"CanPlay":        {Value: state.Playing, Emit: prop.EmitTrue},
+			"CanPause":       {Value: state.Playing, Emit: prop.EmitTrue},
+			"CanSeek":        {Value: state.Playing, Emit: prop.EmitTrue},
+			"CanControl":     {Value: true, Emit: prop.EmitConst},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	m.props = props
+
+	if err := m.conn.Export(mprisRoot{}, mprisPath, mprisRootIface); err != nil {
+		return err
+	}
+	playerMethods := map[string]string{"SeekBy": "Seek"}
+	if err := m.conn.ExportWithMap(mprisPlayer{player: m.player}, playerMethods, mprisPath, mprisPlayerIface); err != nil {
+		return err
+	}
+	methods := introspect.Methods(mprisPlayer{})
+	for i := range methods {
+		if name, ok := playerMethods[methods[i].Name]; ok {
+			methods[i].Name = name
+		}
+	}
+
+	node := &introspect.Node{
+		Name: string(mprisPath),
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{
+				Name:       mprisRootIface,
+				Methods:    introspect.Methods(mprisRoot{}),
+				Properties: props.Introspection(mprisRootIface),
+			},
+			{
+				Name:       mprisPlayerIface,
+				Methods:    methods,
+				Properties: props.Introspection(mprisPlayerIface),
+				Signals: []introspect.Signal{{
+					Name: "Seeked",
+					Args: []introspect.Arg{{Name: "Position", Type: "x"}},
+				}},
+			},
+		},
+	}
+	return m.conn.Export(introspect.NewIntrospectable(node), mprisPath, "org.freedesktop.DBus.Introspectable")
+}
+
+// handleEvent refreshes the exported properties from the player state
+func (m *MPRIS) handleEvent(ev Event) {
+	if !strings.HasPrefix(ev.Type, "player.") {
+		return
+	}
+
+	state := m.player.State()
+	canControl := state.Playing && state.Backend != "command"
+
+	m.update("PlaybackStatus", mprisPlaybackStatus(state))
+	m.update("Metadata", mprisMetadata(state))
+	m.update("CanGoNext", canControl && state.PlaylistIndex < state.PlaylistCount-1)
+	m.update("CanGoPrevious", canControl && state.PlaylistIndex > 0)
+	m.update("CanPlay", canControl)
+	m.update("CanPause", canControl)
+	m.update("CanSeek", canControl)
+	if state.Playing {
+		m.update("Volume", state.Volume/100)
+		m.update("Rate", state.Speed)
+	}
+	m.update("Position", int64(state.Position*1e6))
+
+	if data, ok := ev.Data.(map[string]interface{}); ok && data["seeked"] == true {
+		m.conn.Emit(mprisPath, mprisPlayerIface+".Seeked", int64(state.Position*1e6))
+	}
+}
+
+// update sets a Player property, emitting a change only if it differs
+func (m *MPRIS) update(name string, value interface{}) {
+	if reflect.DeepEqual(m.props.GetMust(mprisPlayerIface, name), value) {
+		return
+	}
+	m.props.SetMust(mprisPlayerIface, name, value)
+}
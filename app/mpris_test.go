@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// startSessionBus runs a private dbus-daemon for the test and points
+// DBUS_SESSION_BUS_ADDRESS at it
+func startSessionBus(t *testing.T) {
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("needs dbus-daemon")
+	}
+	cmd := exec.Command("dbus-daemon", "--session", "--print-address", "--nofork")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	address, err := bufio.NewReader(out).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", strings.TrimSpace(address))
+}
+
+func TestMPRIS(t *testing.T) {
+	startSessionBus(t)
+	p, backend := newTestPlayer(t, []PlaylistItem{{URL: "https://example.com/1.mkv", Title: "One"}})
+	p.duration = 600
+
+	m := StartMPRIS(p, p.events)
+	if m == nil {
+		t.Fatal("MPRIS was not published")
+	}
+	defer m.conn.Close()
+
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	obj := conn.Object(mprisBusName, mprisPath)
+	get := func(name string) interface{} {
+		v, err := obj.GetProperty(mprisPlayerIface + "." + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v.Value()
+	}
+
+	if got := get("PlaybackStatus"); got != "Playing" {
+		t.Errorf("PlaybackStatus %v", got)
+	}
+	metadata := get("Metadata").(map[string]dbus.Variant)
+	if title := metadata["xesam:title"].Value(); title != "One" {
+		t.Errorf("title %v", title)
+	}
+	if length := metadata["mpris:length"].Value(); length != int64(600e6) {
+		t.Errorf("length %v", length)
+	}
+
+	if err := obj.Call(mprisPlayerIface+".PlayPause", 0).Err; err != nil {
+		t.Fatal(err)
+	}
+	if err := obj.Call(mprisPlayerIface+".Seek", 0, int64(-10e6)).Err; err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(backend.Calls(), ","); got != "toggle,seek -10 true" {
+		t.Errorf("sent %s", got)
+	}
+
+	// State follows the player's events
+	signals := make(chan *dbus.Signal, 10)
+	conn.Signal(signals)
+	if err := conn.AddMatchSignal(dbus.WithMatchInterface(mprisPlayerIface), dbus.WithMatchMember("Seeked")); err != nil {
+		t.Fatal(err)
+	}
+	p.handleEvent(backend, PlayerEvent{Kind: PlayerEventPaused, Value: true})
+	p.handleEvent(backend, PlayerEvent{Kind: PlayerEventPosition, Value: 120.0})
+	p.handleEvent(backend, PlayerEvent{Kind: PlayerEventSeeked})
+
+	select {
+	case sig := <-signals:
+		if sig.Body[0] != int64(120e6) {
+			t.Errorf("Seeked to %v", sig.Body[0])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no Seeked signal")
+	}
+	if got := get("PlaybackStatus"); got != "Paused" {
+		t.Errorf("PlaybackStatus after pausing %v", got)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errMpvIPCClosed is returned for commands still waiting when mpv goes away
+var errMpvIPCClosed = errors.New("mpv IPC closed")
+
+// mpvEvent is a message pushed by mpv over its JSON IPC socket, either an
+// event (end-file, seek, ...) or a property-change for an observed property.
+type mpvEvent struct {
+	Event  string      `json:"event"`
+	ID     int         `json:"id"`
+	Name   string      `json:"name"`
+	Data   interface{} `json:"data"`
+	Reason string      `json:"reason"`
+}
+
+type mpvResponse struct {
+	Data  interface{}
+	Error string
+}
+
+// MpvIPC is a long-lived connection to a single mpv process over its unix
+// socket, or on Windows and WSL its named pipe through DialMpvPipe.
+// Requests are matched to replies by request_id; everything else is
+// delivered to onEvent.
+type MpvIPC struct {
+	conn      io.ReadWriteCloser
+	writeMu   sync.Mutex
+	pendingMu sync.Mutex
+	pending   map[int]chan mpvResponse
+	nextID    int
+	onEvent   func(mpvEvent)
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// DialMpvIPC connects to mpv's IPC server, retrying until mpv has created the
+// socket or the timeout expires.
+func DialMpvIPC(socketPath string, timeout time.Duration, onEvent func(mpvEvent)) (*MpvIPC, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.Dial("unix", socketPath)
+		if err == nil {
+			return newMpvIPC(conn, onEvent), nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("connect to mpv IPC %s: %w", socketPath, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// mpvPipeRelay is a PowerShell script that connects to mpv's named pipe,
+// says "ready", and then copies between the pipe and its own stdin and
+// stdout for as long as both last.
+// Go can't wait on a Windows pipe handle while writing to it, and from WSL
+// can't open one at all, so one relay runs for each mpv instead.
+const mpvPipeRelay = `
+$pipe = New-Object System.IO.Pipes.NamedPipeClientStream('.', '%s', [System.IO.Pipes.PipeDirection]::InOut, [System.IO.Pipes.PipeOptions]::Asynchronous)
+$pipe.Connect(%d)
+$stdin = [Console]::OpenStandardInput()
+$stdout = [Console]::OpenStandardOutput()
+$ready = [Text.Encoding]::ASCII.GetBytes("ready` + "`" + `n")
+$stdout.Write($ready, 0, $ready.Length)
+$stdout.Flush()
+$toMpv = $stdin.CopyToAsync($pipe)
+$fromMpv = $pipe.CopyToAsync($stdout)
+[void][System.Threading.Tasks.Task]::WaitAny(@($toMpv, $fromMpv))
+$pipe.Dispose()
+`
+
+// relayConn talks to mpv through the relay process's stdin and stdout
+type relayConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+func (r *relayConn) Read(p []byte) (int, error)  { return r.stdout.Read(p) }
+func (r *relayConn) Write(p []byte) (int, error) { return r.stdin.Write(p) }
+
+func (r *relayConn) Close() error {
+	r.stdin.Close()
+	r.cmd.Process.Kill()
+	go r.cmd.Wait()
+	return nil
+}
+
+// DialMpvPipe connects to mpv's named pipe \\.\pipe\<pipeName> through a
+// PowerShell relay, waiting up to timeout for mpv to create it
+func DialMpvPipe(pipeName string, timeout time.Duration, onEvent func(mpvEvent)) (*MpvIPC, error) {
+	script := fmt.Sprintf(mpvPipeRelay, pipeName, timeout.Milliseconds())
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start mpv pipe relay: %w", err)
+	}
+
+	// The relay exits without a word if mpv never creates the pipe
+	conn := &relayConn{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}
+	if line, err := conn.stdout.ReadString('\n'); err != nil || strings.TrimSpace(line) != "ready" {
+		conn.Close()
+		return nil, fmt.Errorf("connect to mpv pipe %s: relay gave up", pipeName)
+	}
+	return newMpvIPC(conn, onEvent), nil
+}
+
+func newMpvIPC(conn io.ReadWriteCloser, onEvent func(mpvEvent)) *MpvIPC {
+	ipc := &MpvIPC{
+		conn:    conn,
+		pending: make(map[int]chan mpvResponse),
+		onEvent: onEvent,
+		done:    make(chan struct{}),
+	}
+	go ipc.readLoop()
+	return ipc
+}
+
+func (c *MpvIPC) readLoop() {
+	defer c.Close()
+
+	reader := bufio.NewReader(c.conn)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+
+		var msg struct {
+			mpvEvent
+			RequestID *int   `json:"request_id"`
+			Error     string `json:"error"`
+		}
+		if err := json.Unmarshal(line, &msg); err != nil {
+			continue
+		}
+
+		if msg.Event == "" && msg.RequestID != nil {
+			c.pendingMu.Lock()
+			ch, ok := c.pending[*msg.RequestID]
+			delete(c.pending, *msg.RequestID)
+			c.pendingMu.Unlock()
+			if ok {
+				ch <- mpvResponse{Data: msg.Data, Error: msg.Error}
+			}
+			continue
+		}
+
+		if msg.Event != "" && c.onEvent != nil {
+			c.onEvent(msg.mpvEvent)
+		}
+	}
+}
+
+// Command sends an IPC command and waits for mpv's reply. It must not be
+// called while holding a lock that the onEvent handler also takes.
+func (c *MpvIPC) Command(args ...interface{}) (interface{}, error) {
+	c.pendingMu.Lock()
+	c.nextID++
+	id := c.nextID
+	ch := make(chan mpvResponse, 1)
+	c.pending[id] = ch
+	c.pendingMu.Unlock()
+
+	data, err := json.Marshal(map[string]interface{}{
+		"command":    args,
+		"request_id": id,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.writeMu.Lock()
+	_, err = c.conn.Write(append(data, '\n'))
+	c.writeMu.Unlock()
+	if err != nil {
+		c.pendingMu.Lock()
+		delete(c.pending, id)
+		c.pendingMu.Unlock()
+		return nil, err
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != "" && resp.Error != "success" {
+			return nil, fmt.Errorf("mpv: %s", resp.Error)
+		}
+		return resp.Data, nil
+	case <-c.done:
+		return nil, errMpvIPCClosed
+	case <-time.After(2 * time.Second):
+		c.pendingMu.Lock()
+		delete(c.pending, id)
+		c.pendingMu.Unlock()
+		return nil, fmt.Errorf("mpv IPC timeout")
+	}
+}
+
+// Observe asks mpv to push property-change events for a property.
+func (c *MpvIPC) Observe(id int, property string) error {
+	_, err := c.Command("observe_property", id, property)
+	return err
+}
+
+// Done is closed when the connection is gone, usually because mpv exited.
+func (c *MpvIPC) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *MpvIPC) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeMpv answers get_property with 42 and pushes a property-change event
+// before each reply, like mpv does while playing
+func fakeMpv(t *testing.T, conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		var req struct {
+			Command   []interface{} `json:"command"`
+			RequestID int           `json:"request_id"`
+		}
+		if err := json.Unmarshal(line, &req); err != nil {
+			t.Errorf("bad request %q: %v", line, err)
+			return
+		}
+		fmt.Fprintf(conn, `{"event":"property-change","id":1,"name":"time-pos","data":12.5}`+"\n")
+		switch req.Command[0] {
+		case "get_property":
+			fmt.Fprintf(conn, `{"data":42,"request_id":%d,"error":"success"}`+"\n", req.RequestID)
+		default:
+			fmt.Fprintf(conn, `{"request_id":%d,"error":"invalid parameter"}`+"\n", req.RequestID)
+		}
+	}
+}
+
+func TestMpvIPC(t *testing.T) {
+	client, server := net.Pipe()
+	go fakeMpv(t, server)
+
+	events := make(chan mpvEvent, 10)
+	ipc := newMpvIPC(client, func(ev mpvEvent) { events <- ev })
+	defer ipc.Close()
+
+	v, err := ipc.Command("get_property", "volume")
+	if err != nil || v != 42.0 {
+		t.Errorf("get_property = %v, %v; want 42", v, err)
+	}
+	if _, err := ipc.Command("frobnicate"); err == nil {
+		t.Error("mpv's error wasn't returned")
+	}
+
+	select {
+	case ev := <-events:
+		if ev.Event != "property-change" || ev.Name != "time-pos" || ev.Data != 12.5 {
+			t.Errorf("event = %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Error("no event delivered")
+	}
+
+	server.Close()
+	select {
+	case <-ipc.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done not closed when mpv went away")
+	}
+	if _, err := ipc.Command("get_property", "volume"); err == nil {
+		t.Error("command succeeded on a closed connection")
+	}
+}
@@ -1,16 +1,10 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"net"
-	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
-	"path/filepath"
-	"runtime"
 	"strings"
 	"sync"
 	"time"
@@ -19,9 +13,54 @@ import (
 type PlaylistItem struct {
 	URL        string                 `json:"url"`
 	ItemID     string                 `json:"itemId"`
+	Title      string                 `json:"title,omitempty"`
+	Subtitles  []string               `json:"subtitles,omitempty"` // external subtitle URLs
+	Poster     string                 `json:"poster,omitempty"`    // cover image, shown for audio
+	Segments   []Segment              `json:"segments,omitempty"`  // intros, credits, ... to skip
 	OnComplete map[string]interface{} `json:"onComplete"`
 }
 
+// StreamOptions apply to every item of a play request
+type StreamOptions struct {
+	AudioLanguage    string            `json:"audioLanguage,omitempty"`    // preference list, e.g. "jpn,eng"
+	SubtitleLanguage string            `json:"subtitleLanguage,omitempty"` // preference list, e.g. "eng"
+	Headers          map[string]string `json:"headers,omitempty"`          // extra HTTP request headers
+	Cookies          string            `json:"cookies,omitempty"`          // Cookie header value
+	UserAgent        string            `json:"userAgent,omitempty"`
+	Audio            bool              `json:"audio,omitempty"` // music: no video window
+}
+
+// HTTPHeaders returns Headers with Cookies folded in as a Cookie header
+func (o StreamOptions) HTTPHeaders() map[string]string {
+	headers := make(map[string]string, len(o.Headers)+1)
+	for k, v := range o.Headers {
+		headers[k] = v
+	}
+	if o.Cookies != "" {
+		headers["Cookie"] = o.Cookies
+	}
+	return headers
+}
+
+// PlayRequest describes a single item to play. StartPosition wins when
+// given; without it, Resume asks the server to pick up where watch history
+// left off, and otherwise the item plays from the start.
+type PlayRequest struct {
+	URL           string                 `json:"url"`
+	Title         string                 `json:"title"`
+	StartPosition *float64               `json:"startPosition"`
+	Resume        bool                   `json:"resume,omitempty"`
+	ItemID        string                 `json:"itemId,omitempty"`
+	Service       string                 `json:"service,omitempty"`
+	ProfileID     string                 `json:"profileId,omitempty"`
+	Subtitles     []string               `json:"subtitles,omitempty"`
+	Poster        string                 `json:"poster,omitempty"`
+	Segments      []Segment              `json:"segments,omitempty"`
+	OnComplete    map[string]interface{} `json:"onComplete"`
+	OnProgress    map[string]interface{} `json:"onProgress"`
+	StreamOptions
+}
+
 type Player struct {
 	mu               sync.Mutex
 	cmd              *exec.Cmd
@@ -29,17 +68,34 @@ type Player struct {
 	duration         float64
 	paused           bool
 	playing          bool
+	volume           float64
+	muted            bool
+	speed            float64
 	mpvPath          string
-	mpvOptions       string
 	dataDir          string
-	socketPath       string
+	backend          PlayerBackend
 	playlist         []PlaylistItem
 	playlistPos      int
 	onComplete       map[string]interface{}
 	onProgress       map[string]interface{}
 	lastProgressTime int64
-	stopPolling      chan struct{}
+	history          *WatchHistory
+	profileID        string
+	service          string
+	callbacks        *CallbackQueue
+	events           *EventHub
+	lastPositionSent time.Time
 	onExit           func()
+	exited           chan struct{} // closed once the running player has exited
+	stopReason       string        // why Stop ended the running player
+	endSeen          bool          // the backend reported the current item ending
+	endReason        string
+	endPosition      float64
+	segmentMode      string
+	segmentPos       int // index of the segment playing now, or -1
+	segmentsSeen     map[int]bool
+	skippedSegments  []Segment
+	audio            bool
 }
 
 func (p *Player) SetOnExit(fn func()) {
@@ -48,130 +104,93 @@ func (p *Player) SetOnExit(fn func()) {
 	p.mu.Unlock()
 }
 
-func NewPlayer(dataDir string) *Player {
-	p := &Player{
-		mpvPath: "mpv",
-		dataDir: dataDir,
-	}
-	p.detectMpv()
-	return p
+func (p *Player) SetHistory(history *WatchHistory) {
+	p.mu.Lock()
+	p.history = history
+	p.mu.Unlock()
 }
 
-func (p *Player) detectMpv() {
-	// Try common locations
-	candidates := []string{"mpv"}
-
-	if runtime.GOOS == "windows" {
-		candidates = append(candidates,
-			`C:\Program Files\mpv\mpv.exe`,
-			`C:\Program Files (x86)\mpv\mpv.exe`,
-		)
-	}
-
-	for _, path := range candidates {
-		if _, err := exec.LookPath(path); err == nil {
-			p.mpvPath = path
-			return
-		}
-	}
+func (p *Player) SetCallbackQueue(callbacks *CallbackQueue) {
+	p.mu.Lock()
+	p.callbacks = callbacks
+	p.mu.Unlock()
 }
 
-func (p *Player) getMpvConfigPath() string {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return ""
-	}
-	return filepath.Join(home, ".local", "share", "launchtube", "mpv.conf")
+func (p *Player) SetEvents(events *EventHub) {
+	p.mu.Lock()
+	p.events = events
+	p.mu.Unlock()
 }
 
-func (p *Player) ensureMpvConfig() string {
-	configPath := p.getMpvConfigPath()
-	if configPath == "" {
-		return ""
-	}
-
-	// Check if file already exists
-	if _, err := os.Stat(configPath); err == nil {
-		return configPath
-	}
-
-	// Create directory if needed
-	dir := filepath.Dir(configPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		Log("ExternalPlayer: Failed to create config dir: %v", err)
-		return ""
-	}
-
-	// Write default config
-	defaultConfig := `# Launchtube mpv key bindings
-# See: https://mpv.io/manual/master/#input-conf
-
-ESC quit
-`
-	if err := os.WriteFile(configPath, []byte(defaultConfig), 0644); err != nil {
-		Log("ExternalPlayer: Failed to write mpv config: %v", err)
-		return ""
+func NewPlayer(dataDir string) *Player {
+	p := &Player{
+		mpvPath:    "mpv",
+		dataDir:    dataDir,
+		segmentPos: -1,
 	}
-
-	Log("ExternalPlayer: Created default mpv config at %s", configPath)
-	return configPath
-}
-
-func (p *Player) SetMpvPath(path string) {
-	p.mu.Lock()
-	p.mpvPath = path
-	p.mu.Unlock()
+	p.detectMpv()
+	return p
 }
 
-func (p *Player) SetMpvOptions(options string) {
-	p.mu.Lock()
-	p.mpvOptions = options
-	p.mu.Unlock()
+func (p *Player) detectMpv() {
+	if path := findExecutable(mpvCandidates()); path != "" {
+		p.mpvPath = path
+	}
 }
 
+// GetMpvPath returns the detected mpv, used unless a profile picks another
 func (p *Player) GetMpvPath() string {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	return p.mpvPath
 }
 
-func (p *Player) GetMpvOptions() string {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	return p.mpvOptions
-}
+func (p *Player) Play(req PlayRequest) error {
+	startPosition := 0.0
+	if req.StartPosition != nil {
+		startPosition = *req.StartPosition
+	}
 
-func (p *Player) Play(url, title string, startPosition float64, onComplete, onProgress map[string]interface{}) error {
-	Log("ExternalPlayer: Play() called with url=%s title=%s start=%.1f", url, title, startPosition)
-	p.Stop()
+	Log("ExternalPlayer: Play() called with url=%s title=%s start=%.1f", req.URL, req.Title, startPosition)
+	p.stop("replaced")
 	Log("ExternalPlayer: Stop() completed")
 
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	Log("ExternalPlayer: Playing %s", url)
+	Log("ExternalPlayer: Playing %s", req.URL)
 
-	p.onComplete = onComplete
-	p.onProgress = onProgress
+	p.onComplete = req.OnComplete
+	p.onProgress = req.OnProgress
 	p.position = startPosition
 	p.duration = 0
 	p.paused = false
 	p.playing = true
-	p.playlist = nil
+	p.playlist = []PlaylistItem{{
+		URL:        req.URL,
+		ItemID:     req.ItemID,
+		Title:      req.Title,
+		Subtitles:  req.Subtitles,
+		Poster:     req.Poster,
+		Segments:   req.Segments,
+		OnComplete: req.OnComplete,
+	}}
 	p.playlistPos = 0
+	p.profileID = req.ProfileID
+	p.service = req.Service
 
-	Log("ExternalPlayer: calling startMpv()")
-	err := p.startMpv(url, title, startPosition)
-	Log("ExternalPlayer: startMpv() returned err=%v", err)
+	Log("ExternalPlayer: calling start()")
+	err := p.start(startPosition, req.StreamOptions)
+	Log("ExternalPlayer: start() returned err=%v", err)
 	return err
 }
 
-func (p *Player) PlayPlaylist(items []PlaylistItem, startPosition float64) error {
+func (p *Player) PlayPlaylist(items []PlaylistItem, startPosition float64, profileID, service string, opts StreamOptions) error {
 	if len(items) == 0 {
 		return fmt.Errorf("empty playlist")
 	}
 
-	p.Stop()
+	p.stop("replaced")
 
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -182,103 +201,82 @@ func (p *Player) PlayPlaylist(items []PlaylistItem, startPosition float64) error
 	p.duration = 0
 	p.paused = false
 	p.playing = true
+	p.profileID = profileID
+	p.service = service
 
-	// Use first item's onComplete for now
-	if items[0].OnComplete != nil {
-		p.onComplete = items[0].OnComplete
-	}
+	// Each item carries its own onComplete; start with the first
+	p.onComplete = items[0].OnComplete
+	p.onProgress = nil
 
-	return p.startMpvPlaylist(items, startPosition)
+	return p.start(startPosition, opts)
 }
 
-func (p *Player) startMpv(url, title string, startPosition float64) error {
-	// Determine socket path
-	if runtime.GOOS == "windows" || isWSL() {
-		p.socketPath = `\\.\pipe\launchtube-mpv`
-	} else {
-		p.socketPath = "/tmp/launchtube-mpv.sock"
-		// Remove existing socket
-		os.Remove(p.socketPath)
-	}
-
-	args := []string{
-		"--fullscreen",
-		fmt.Sprintf("--input-ipc-server=%s", p.socketPath),
-	}
-
-	// Add custom input config if available
-	if inputConf := p.ensureMpvConfig(); inputConf != "" {
-		args = append(args, fmt.Sprintf("--input-conf=%s", inputConf))
-	}
-
-	// Add YouTube-specific options for yt-dlp streams
-	if isYouTubeURL(url) {
-		// Pass cookies file if it exists
-		cookiesPath := filepath.Join(p.dataDir, "cookies.txt")
-		if _, err := os.Stat(cookiesPath); err == nil {
-			args = append(args, fmt.Sprintf("--ytdl-raw-options=cookies=%s", cookiesPath))
+// newBackend picks the player backend from the profile's settings.
+// Must be called with p.mu held.
+func (p *Player) newBackend(settings PlayerSettings) PlayerBackend {
+	switch settings.Backend {
+	case "vlc":
+		if path := findExecutable(vlcCandidates()); path != "" {
+			return newVLCBackend(path, settings)
 		}
-		args = append(args,
-			// Cap quality at 1080p to avoid bandwidth issues
-			"--ytdl-format=bestvideo[height<=1080]+bestaudio/best[height<=1080]/best",
-			// Increase buffer for smoother playback
-			"--cache=yes",
-			"--demuxer-max-bytes=150M",
-			"--demuxer-max-back-bytes=75M",
-		)
+		Log("ExternalPlayer: VLC not found, falling back to mpv")
+	case "command":
+		if settings.Command != "" {
+			return newCommandBackend(settings.Command)
+		}
+		Log("ExternalPlayer: no player command configured, falling back to mpv")
 	}
+	return newMpvBackend(p.mpvPath, settings, p.dataDir)
+}
 
-	if startPosition > 0 {
-		args = append(args, fmt.Sprintf("--start=%d", int(startPosition)))
-	}
+// start launches the player backend on the playlist and watches it until it
+// exits. Must be called with p.mu held.
+func (p *Player) start(startPosition float64, opts StreamOptions) error {
+	p.volume = 100
+	p.muted = false
+	p.speed = 1
 
-	if title != "" {
-		args = append(args, fmt.Sprintf("--title=%s", title))
+	if !opts.Audio && allAudioURLs(playlistURLs(p.playlist)) {
+		opts.Audio = true
 	}
+	p.audio = opts.Audio
 
-	if p.mpvOptions != "" {
-		// Split options and add them
-		opts := strings.Fields(p.mpvOptions)
-		args = append(args, opts...)
+	settings := LoadPlayerSettings(p.dataDir, p.profileID)
+	backend := p.newBackend(settings)
+	Log("ExternalPlayer: Calling %s Start()", backend.Name())
+	cmd, err := backend.Start(p.playlist, startPosition, opts)
+	if err != nil {
+		Log("ExternalPlayer: Start() FAILED: %v", err)
+		return err
 	}
+	Log("ExternalPlayer: Start() succeeded, pid=%d", cmd.Process.Pid)
 
-	args = append(args, url)
-
-	Log("ExternalPlayer: Starting mpv at path=%s with args: %v", p.mpvPath, args)
+	p.resetSegments()
+	p.segmentMode = settings.skipSegments()
 
-	p.cmd = exec.Command(p.mpvPath, args...)
-	Log("ExternalPlayer: Calling cmd.Start()")
-	if err := p.cmd.Start(); err != nil {
-		Log("ExternalPlayer: cmd.Start() FAILED: %v", err)
-		return err
-	}
-	Log("ExternalPlayer: cmd.Start() succeeded, pid=%d", p.cmd.Process.Pid)
+	exited := make(chan struct{})
+	p.cmd = cmd
+	p.backend = backend
+	p.exited = exited
+	p.stopReason = ""
+	p.endSeen = false
+	p.publish("player.started")
 
-	// Start position polling
-	p.stopPolling = make(chan struct{})
-	go p.pollPosition()
+	go backend.Attach(cmd, func(ev PlayerEvent) {
+		p.handleEvent(backend, ev)
+	})
 
 	// Wait for process to exit
 	go func() {
 		Log("ExternalPlayer: waiting for process to exit...")
-		err := p.cmd.Wait()
+		err := cmd.Wait()
 		Log("ExternalPlayer: process exited, err=%v", err)
+		backend.Detach()
+
 		p.mu.Lock()
-		p.playing = false
-		p.cmd = nil
-		onExit := p.onExit
+		onExit := p.finish(cmd, err)
 		p.mu.Unlock()
-
-		// Close polling
-		select {
-		case <-p.stopPolling:
-		default:
-			close(p.stopPolling)
-		}
-
-		// Execute onComplete callback
-		Log("ExternalPlayer: executing onComplete callback")
-		p.executeOnComplete()
+		close(exited)
 
 		// Execute onExit callback (for Flutter respawn)
 		Log("ExternalPlayer: executing onExit callback (onExit=%v)", onExit != nil)
@@ -291,285 +289,529 @@ func (p *Player) startMpv(url, title string, startPosition float64) error {
 	return nil
 }
 
-func (p *Player) startMpvPlaylist(items []PlaylistItem, startPosition float64) error {
-	if len(items) == 0 {
-		return fmt.Errorf("empty playlist")
+// finish completes the item that was playing when cmd went away: it records
+// history, publishes player.ended and queues onComplete with the final
+// position and a reason. It runs once per launch and returns the onExit hook
+// to call, which is skipped when another item replaced this one. Must be
+// called with p.mu held.
+func (p *Player) finish(cmd *exec.Cmd, err error) func() {
+	if p.cmd != cmd {
+		return nil
+	}
+
+	reason := p.stopReason
+	if reason == "" {
+		switch {
+		case p.endSeen:
+			reason = endFileReason(p.endReason)
+			p.position = p.endPosition
+		case err != nil:
+			reason = "error"
+		default:
+			reason = "ended"
+		}
 	}
+	Log("ExternalPlayer: finished reason=%s position=%.1f", reason, p.position)
 
-	// For now, just play the first item
-	// TODO: Implement full playlist support with position tracking
-	return p.startMpv(items[0].URL, "", startPosition)
-}
-
-func (p *Player) pollPosition() {
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-p.stopPolling:
-			return
-		case <-ticker.C:
-			p.queryPosition()
+	p.playing = false
+	p.cmd = nil
+	p.recordHistory(true)
+	p.publishWith("player.ended", map[string]interface{}{"reason": reason})
+	p.queueCallback("complete", p.onComplete, reason)
 
-			// Send progress update every 3 seconds
-			now := time.Now().Unix()
-			p.mu.Lock()
-			if p.onProgress != nil && now-p.lastProgressTime >= 3 {
-				p.lastProgressTime = now
-				go p.executeOnProgress()
-			}
-			p.mu.Unlock()
-		}
+	if reason == "replaced" {
+		return nil
 	}
+	return p.onExit
 }
 
-func (p *Player) queryPosition() {
-	if runtime.GOOS == "windows" || isWSL() {
-		p.queryPositionWindows()
-	} else {
-		p.queryPositionUnix()
+// endFileReason maps a backend end-file reason to a completion reason
+func endFileReason(reason string) string {
+	switch reason {
+	case "quit":
+		return "user-quit"
+	case "stop":
+		return "skipped"
+	case "error":
+		return "error"
+	default:
+		return "ended"
 	}
 }
 
-func (p *Player) queryPositionUnix() {
-	conn, err := net.Dial("unix", p.socketPath)
-	if err != nil {
+// setPlaylistPos handles the player moving to another playlist entry. The item that
+// was playing is finished, so its onComplete fires with its last position.
+// Must be called with p.mu held.
+func (p *Player) setPlaylistPos(pos int) {
+	if p.playlist == nil || pos < 0 || pos >= len(p.playlist) || pos == p.playlistPos {
 		return
 	}
-	defer conn.Close()
-
-	conn.SetDeadline(time.Now().Add(500 * time.Millisecond))
 
-	// Query time-pos
-	conn.Write([]byte(`{"command":["get_property","time-pos"],"request_id":1}` + "\n"))
-	// Query duration
-	conn.Write([]byte(`{"command":["get_property","duration"],"request_id":2}` + "\n"))
-	// Query pause
-	conn.Write([]byte(`{"command":["get_property","pause"],"request_id":3}` + "\n"))
+	Log("ExternalPlayer: playlist moved from item %d to %d", p.playlistPos, pos)
 
-	reader := bufio.NewReader(conn)
-	for i := 0; i < 3; i++ {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			break
-		}
-		p.parseIpcResponse(line)
-	}
-}
-
-func (p *Player) queryPositionWindows() {
-	// Use PowerShell to communicate with named pipe
-	script := fmt.Sprintf(`
-$pipe = New-Object System.IO.Pipes.NamedPipeClientStream(".", "launchtube-mpv", [System.IO.Pipes.PipeDirection]::InOut)
-$pipe.Connect(500)
-$writer = New-Object System.IO.StreamWriter($pipe)
-$reader = New-Object System.IO.StreamReader($pipe)
-$writer.WriteLine('{"command":["get_property","time-pos"],"request_id":1}')
-$writer.WriteLine('{"command":["get_property","duration"],"request_id":2}')
-$writer.WriteLine('{"command":["get_property","pause"],"request_id":3}')
-$writer.Flush()
-Write-Output $reader.ReadLine()
-Write-Output $reader.ReadLine()
-Write-Output $reader.ReadLine()
-$pipe.Close()
-`)
-
-	cmd := exec.Command("powershell", "-Command", script)
-	output, err := cmd.Output()
-	if err != nil {
-		return
+	reason := "skipped"
+	if p.endSeen {
+		reason = endFileReason(p.endReason)
+		p.position = p.endPosition
+		p.endSeen = false
 	}
+	p.queueCallback("complete", p.onComplete, reason)
+	p.recordHistory(true)
+	p.resetSegments()
 
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		p.parseIpcResponse(line)
-	}
+	p.playlistPos = pos
+	p.onComplete = p.playlist[pos].OnComplete
+	p.position = 0
+	p.duration = 0
+	p.publish("player.item-changed")
 }
 
-func (p *Player) parseIpcResponse(line string) {
-	var resp struct {
-		RequestID int         `json:"request_id"`
-		Data      interface{} `json:"data"`
-		Error     string      `json:"error"`
-	}
-
-	if err := json.Unmarshal([]byte(line), &resp); err != nil {
-		return
-	}
+// handleEvent applies a backend event to the player state. Pause, resume
+// and seeks send a progress update immediately; plain position changes are
+// throttled. Events from a backend that has been replaced are ignored.
+func (p *Player) handleEvent(backend PlayerBackend, ev PlayerEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	if resp.Error != "" && resp.Error != "success" {
+	if p.backend != backend {
 		return
 	}
 
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	switch resp.RequestID {
-	case 1: // time-pos
-		if pos, ok := resp.Data.(float64); ok {
+	force := false
+	switch ev.Kind {
+	case PlayerEventPosition:
+		if pos, ok := ev.Value.(float64); ok {
+			prev := p.position
 			p.position = pos
+			p.checkSegments(prev)
+			if time.Since(p.lastPositionSent) >= time.Second {
+				p.lastPositionSent = time.Now()
+				p.publish("player.position")
+			}
 		}
-	case 2: // duration
-		if dur, ok := resp.Data.(float64); ok {
+	case PlayerEventDuration:
+		if dur, ok := ev.Value.(float64); ok {
 			p.duration = dur
 		}
-	case 3: // pause
-		if paused, ok := resp.Data.(bool); ok {
+	case PlayerEventPaused:
+		if paused, ok := ev.Value.(bool); ok {
+			force = paused != p.paused
 			p.paused = paused
+			if force && paused {
+				p.publish("player.paused")
+			} else if force {
+				p.publish("player.resumed")
+			}
+		}
+	case PlayerEventPlaylistPos:
+		if pos, ok := ev.Value.(int); ok {
+			p.setPlaylistPos(pos)
 		}
+	case PlayerEventVolume:
+		if vol, ok := ev.Value.(float64); ok {
+			p.volume = vol
+		}
+	case PlayerEventMuted:
+		if muted, ok := ev.Value.(bool); ok {
+			p.muted = muted
+		}
+	case PlayerEventSpeed:
+		if speed, ok := ev.Value.(float64); ok {
+			p.speed = speed
+		}
+	case PlayerEventSeeked:
+		force = true
+		p.publishWith("player.position", map[string]interface{}{"seeked": true})
+	case PlayerEventEndFile:
+		Log("ExternalPlayer: end-file reason=%s position=%.1f", ev.Reason, p.position)
+		p.endSeen = true
+		p.endReason = ev.Reason
+		p.endPosition = p.position
 	}
+
+	p.maybeSendProgress(force)
 }
 
-func (p *Player) executeOnComplete() {
-	p.mu.Lock()
-	onComplete := p.onComplete
-	position := p.position
-	p.mu.Unlock()
+// maybeSendProgress records the position and fires onProgress if forced or
+// if 3 seconds have passed since the last update. Must be called with p.mu
+// held.
+func (p *Player) maybeSendProgress(force bool) {
+	now := time.Now().Unix()
+	if !force && now-p.lastProgressTime < 3 {
+		return
+	}
+	p.lastProgressTime = now
+
+	p.recordHistory(force)
+	p.queueCallback("progress", p.onProgress, "")
+}
 
-	if onComplete == nil {
+// recordHistory saves the current item's position to the watch history.
+// Must be called with p.mu held.
+func (p *Player) recordHistory(flush bool) {
+	if p.history == nil || p.playlistPos >= len(p.playlist) {
 		return
 	}
 
-	url, _ := onComplete["url"].(string)
-	method, _ := onComplete["method"].(string)
-	headers, _ := onComplete["headers"].(map[string]interface{})
-	bodyTemplate, _ := onComplete["bodyTemplate"].(map[string]interface{})
+	item := p.playlist[p.playlistPos]
+	p.history.Update(p.profileID, HistoryEntry{
+		URL:      item.URL,
+		ItemID:   item.ItemID,
+		Title:    item.Title,
+		Service:  p.service,
+		Position: p.position,
+		Duration: p.duration,
+	}, flush)
+}
+
+// callbackVars describes the current item for a callback template. Must be
+// called with p.mu held.
+func (p *Player) callbackVars(event string) CallbackVars {
+	state := "playing"
+	if event == "complete" {
+		state = "stopped"
+	} else if p.paused {
+		state = "paused"
+	}
+
+	vars := newCallbackVars(event, state, p.position, p.duration, p.paused)
+	vars["playlistIndex"] = p.playlistPos
+	vars["playlistCount"] = len(p.playlist)
+	vars["service"] = p.service
+	vars["profileId"] = p.profileID
+	vars["itemId"] = ""
+	vars["title"] = ""
+	if p.playlistPos < len(p.playlist) {
+		vars["itemId"] = p.playlist[p.playlistPos].ItemID
+		vars["title"] = p.playlist[p.playlistPos].Title
+	}
+	skipped := make([]Segment, len(p.skippedSegments))
+	copy(skipped, p.skippedSegments)
+	vars["skippedSegments"] = skipped
+	return vars
+}
+
+// publish sends a player event describing the current item to /api/1/events
+// subscribers. Must be called with p.mu held.
+func (p *Player) publish(eventType string) {
+	p.publishWith(eventType, nil)
+}
+
+// publishWith is publish with extra fields added to the event data. Must be
+// called with p.mu held.
+func (p *Player) publishWith(eventType string, extra map[string]interface{}) {
+	data := map[string]interface{}{
+		"position":      p.position,
+		"duration":      p.duration,
+		"paused":        p.paused,
+		"playlistIndex": p.playlistPos,
+		"playlistCount": len(p.playlist),
+	}
+	if p.playlistPos < len(p.playlist) {
+		data["itemId"] = p.playlist[p.playlistPos].ItemID
+		data["title"] = p.playlist[p.playlistPos].Title
+		data["poster"] = p.playlist[p.playlistPos].Poster
+	}
+	data["audio"] = p.audio
+	if p.backend != nil {
+		data["backend"] = p.backend.Name()
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+	p.events.Publish(eventType, data)
+}
 
-	if url == "" || method == "" {
+// queueCallback hands an onComplete or onProgress callback describing the
+// current item to the delivery queue. reason says why a complete callback
+// fired: ended, user-quit, replaced, skipped or error. Must be called with
+// p.mu held.
+func (p *Player) queueCallback(event string, callback map[string]interface{}, reason string) {
+	if callback == nil || p.callbacks == nil {
 		return
 	}
 
-	// Build body from template
-	positionTicks := int64(position * 10000000) // Convert to ticks
-	body := make(map[string]interface{})
-	for k, v := range bodyTemplate {
-		if s, ok := v.(string); ok {
-			s = strings.ReplaceAll(s, "${positionTicks}", fmt.Sprintf("%d", positionTicks))
-			s = strings.ReplaceAll(s, "${isPaused}", "false")
-			body[k] = s
-		} else {
-			body[k] = v
-		}
+	key := ""
+	if p.playlistPos < len(p.playlist) {
+		item := p.playlist[p.playlistPos]
+		key = historyKey(item.ItemID, item.URL)
 	}
+	vars := p.callbackVars(event)
+	vars["reason"] = reason
+	p.callbacks.Enqueue(event, key, callback, vars)
+}
 
-	bodyBytes, _ := json.Marshal(body)
+// Stop asks the player to quit and waits for it to exit
+func (p *Player) Stop() {
+	p.stop("user-quit")
+}
 
-	req, err := http.NewRequest(method, url, bytes.NewReader(bodyBytes))
-	if err != nil {
+// stop ends the running player. The backend is asked for its final position
+// before it is told to quit, since the exit may be handled as soon as it
+// does; a player that doesn't exit in time is terminated, then killed.
+// reason is reported with the complete callback and player.ended.
+func (p *Player) stop(reason string) {
+	p.mu.Lock()
+	cmd, backend, exited := p.cmd, p.backend, p.exited
+	if cmd == nil || cmd.Process == nil {
+		p.mu.Unlock()
+		Log("ExternalPlayer: Stop() no process running, returning early")
 		return
 	}
+	p.stopReason = reason
+	p.mu.Unlock()
 
-	req.Header.Set("Content-Type", "application/json")
-	for k, v := range headers {
-		if s, ok := v.(string); ok {
-			req.Header.Set(k, s)
-		}
+	Log("ExternalPlayer: stopping pid=%d reason=%s", cmd.Process.Pid, reason)
+
+	position := backend.Position()
+	p.mu.Lock()
+	if position >= 0 && p.cmd == cmd {
+		p.position = position
 	}
+	p.mu.Unlock()
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	client.Do(req)
-}
+	grace := playerQuitTimeout
+	if err := backend.Quit(); err != nil {
+		Log("ExternalPlayer: quit not sent (%v), terminating", err)
+		grace = 0
+	}
+
+	terminatePlayerProcess(cmd, exited, grace)
 
-func (p *Player) executeOnProgress() {
+	// Normally the exit goroutine has finished the item by now; if even the
+	// kill didn't take, finish it here so completion still fires
 	p.mu.Lock()
-	onProgress := p.onProgress
-	position := p.position
-	paused := p.paused
+	onExit := p.finish(cmd, nil)
 	p.mu.Unlock()
+	if onExit != nil {
+		onExit()
+	}
+}
 
-	if onProgress == nil {
-		return
+// runningBackend returns the backend of the running player. Controls are
+// sent without holding p.mu, since backends report events back under it.
+func (p *Player) runningBackend() (PlayerBackend, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cmd == nil || p.backend == nil {
+		return nil, fmt.Errorf("player not running")
 	}
+	return p.backend, nil
+}
 
-	url, _ := onProgress["url"].(string)
-	method, _ := onProgress["method"].(string)
-	headers, _ := onProgress["headers"].(map[string]interface{})
-	bodyTemplate, _ := onProgress["bodyTemplate"].(map[string]interface{})
+// SetPaused pauses or resumes playback
+func (p *Player) SetPaused(paused bool) error {
+	backend, err := p.runningBackend()
+	if err != nil {
+		return err
+	}
+	return backend.SetPaused(paused)
+}
 
-	if url == "" || method == "" {
-		return
+// TogglePause flips between paused and playing
+func (p *Player) TogglePause() error {
+	backend, err := p.runningBackend()
+	if err != nil {
+		return err
 	}
+	return backend.TogglePause()
+}
 
-	positionTicks := int64(position * 10000000)
-	isPaused := "false"
-	if paused {
-		isPaused = "true"
+// Seek moves to an absolute position, or by an offset when relative is set
+func (p *Player) Seek(seconds float64, relative bool) error {
+	backend, err := p.runningBackend()
+	if err != nil {
+		return err
 	}
+	return backend.Seek(seconds, relative)
+}
 
-	body := make(map[string]interface{})
-	for k, v := range bodyTemplate {
-		if s, ok := v.(string); ok {
-			s = strings.ReplaceAll(s, "${positionTicks}", fmt.Sprintf("%d", positionTicks))
-			s = strings.ReplaceAll(s, "${isPaused}", isPaused)
-			body[k] = s
-		} else {
-			body[k] = v
-		}
+// SetVolume sets the volume in percent
+func (p *Player) SetVolume(volume float64) error {
+	backend, err := p.runningBackend()
+	if err != nil {
+		return err
 	}
+	return backend.SetVolume(volume)
+}
 
-	bodyBytes, _ := json.Marshal(body)
+// SetMute mutes or unmutes audio
+func (p *Player) SetMute(muted bool) error {
+	backend, err := p.runningBackend()
+	if err != nil {
+		return err
+	}
+	return backend.SetMute(muted)
+}
 
-	req, err := http.NewRequest(method, url, bytes.NewReader(bodyBytes))
+// Next skips to the next playlist item
+func (p *Player) Next() error {
+	backend, err := p.runningBackend()
 	if err != nil {
-		return
+		return err
 	}
+	return backend.Next()
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	for k, v := range headers {
-		if s, ok := v.(string); ok {
-			req.Header.Set(k, s)
-		}
+// Previous goes back to the previous playlist item
+func (p *Player) Previous() error {
+	backend, err := p.runningBackend()
+	if err != nil {
+		return err
 	}
+	return backend.Previous()
+}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	client.Do(req)
+// SetAudioTrack selects an audio track by ID, or "auto"/"no"
+func (p *Player) SetAudioTrack(track interface{}) error {
+	backend, err := p.runningBackend()
+	if err != nil {
+		return err
+	}
+	return backend.SetAudioTrack(track)
 }
 
-func (p *Player) Stop() {
-	Log("ExternalPlayer: Stop() entering, about to lock mutex")
-	p.mu.Lock()
-	Log("ExternalPlayer: Stop() mutex acquired, setting up defer")
-	defer func() {
-		Log("ExternalPlayer: Stop() unlocking mutex")
-		p.mu.Unlock()
-	}()
-	Log("ExternalPlayer: Stop() defer set up")
+// SetSubtitleTrack selects a subtitle track by ID, or "auto"/"no"
+func (p *Player) SetSubtitleTrack(track interface{}) error {
+	backend, err := p.runningBackend()
+	if err != nil {
+		return err
+	}
+	return backend.SetSubtitleTrack(track)
+}
 
-	Log("ExternalPlayer: Stop() checking cmd, cmd==nil: %v", p.cmd == nil)
+// SetSpeed sets the playback speed multiplier
+func (p *Player) SetSpeed(speed float64) error {
+	if speed <= 0 {
+		return fmt.Errorf("speed must be positive")
+	}
+	backend, err := p.runningBackend()
+	if err != nil {
+		return err
+	}
+	return backend.SetSpeed(speed)
+}
 
-	if p.cmd == nil || p.cmd.Process == nil {
-		Log("ExternalPlayer: Stop() no process running, returning early")
-		return
+// Enqueue adds items to the end of the running playlist
+func (p *Player) Enqueue(items []PlaylistItem) error {
+	backend, err := p.runningBackend()
+	if err != nil {
+		return err
 	}
 
-	if p.stopPolling != nil {
-		select {
-		case <-p.stopPolling:
-		default:
-			close(p.stopPolling)
+	for _, item := range items {
+		if err := backend.Append(item); err != nil {
+			return err
 		}
+		p.mu.Lock()
+		if p.backend == backend {
+			p.playlist = append(p.playlist, item)
+		}
+		p.mu.Unlock()
 	}
 
-	if runtime.GOOS == "windows" {
-		exec.Command("taskkill", "/F", "/PID", fmt.Sprintf("%d", p.cmd.Process.Pid)).Run()
-	} else {
-		p.cmd.Process.Signal(os.Interrupt)
+	p.mu.Lock()
+	p.publish("player.queue-changed")
+	p.mu.Unlock()
+	return nil
+}
+
+// Queue returns the playlist and the index of the item playing
+func (p *Player) Queue() ([]PlaylistItem, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]PlaylistItem{}, p.playlist...), p.playlistPos
+}
+
+// ShowText shows a message on the player's on-screen display
+func (p *Player) ShowText(text string, duration time.Duration) error {
+	backend, err := p.runningBackend()
+	if err != nil {
+		return err
 	}
+	return backend.ShowText(text, duration)
+}
 
-	p.cmd = nil
-	p.playing = false
+// PlayerState is a snapshot of what the player is doing
+type PlayerState struct {
+	Playing       bool
+	Paused        bool
+	Position      float64
+	Duration      float64
+	PlaylistIndex int
+	PlaylistCount int
+	ItemID        string
+	Title         string
+	Volume        float64
+	Muted         bool
+	Speed         float64
+	Backend       string
+	ProfileID     string
+	Segment       *Segment // segment playing now
+	Audio         bool
+	Poster        string
 }
 
-func (p *Player) GetStatus() map[string]interface{} {
+// State returns a snapshot of the player state
+func (p *Player) State() PlayerState {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	state := PlayerState{
+		Playing:       p.playing,
+		Paused:        p.paused,
+		Position:      p.position,
+		Duration:      p.duration,
+		PlaylistIndex: p.playlistPos,
+		PlaylistCount: len(p.playlist),
+		Volume:        p.volume,
+		Muted:         p.muted,
+		Speed:         p.speed,
+		ProfileID:     p.profileID,
+		Segment:       p.activeSegment(),
+		Audio:         p.audio,
+	}
+	if p.playlistPos < len(p.playlist) {
+		state.ItemID = p.playlist[p.playlistPos].ItemID
+		state.Title = p.playlist[p.playlistPos].Title
+		state.Poster = p.playlist[p.playlistPos].Poster
+	}
+	if p.backend != nil {
+		state.Backend = p.backend.Name()
+	}
+	return state
+}
+
+func (p *Player) GetStatus() map[string]interface{} {
+	state := p.State()
+
+	p.mu.Lock()
+	callbacks := p.callbacks
+	p.mu.Unlock()
+
+	var callbackError *CallbackError
+	if callbacks != nil {
+		callbackError = callbacks.LastError()
+	}
+
 	return map[string]interface{}{
-		"playing":  p.playing,
-		"paused":   p.paused,
-		"position": p.position,
-		"duration": p.duration,
+		"playing":       state.Playing,
+		"paused":        state.Paused,
+		"position":      state.Position,
+		"duration":      state.Duration,
+		"playlistIndex": state.PlaylistIndex,
+		"playlistCount": state.PlaylistCount,
+		"itemId":        state.ItemID,
+		"title":         state.Title,
+		"volume":        state.Volume,
+		"muted":         state.Muted,
+		"speed":         state.Speed,
+		"backend":       state.Backend,
+		"segment":       state.Segment,
+		"audio":         state.Audio,
+		"poster":        state.Poster,
+		"callbackError": callbackError,
 	}
 }
 
@@ -581,6 +823,44 @@ func isWSL() bool {
 	return strings.Contains(strings.ToLower(string(data)), "microsoft")
 }
 
+// audioExtensions are file types played in audio mode without being asked
+var audioExtensions = []string{".mp3", ".flac", ".ogg", ".oga", ".opus", ".m4a", ".aac", ".wav", ".wma"}
+
+func isAudioURL(rawURL string) bool {
+	if strings.Contains(rawURL, "music.youtube.com") {
+		return true
+	}
+	path := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		path = u.Path
+	}
+	path = strings.ToLower(path)
+	for _, ext := range audioExtensions {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func allAudioURLs(urls []string) bool {
+	for _, u := range urls {
+		if !isAudioURL(u) {
+			return false
+		}
+	}
+	return len(urls) > 0
+}
+
 func isYouTubeURL(url string) bool {
 	return strings.Contains(url, "youtube.com") || strings.Contains(url, "youtu.be")
 }
+
+func anyYouTubeURL(urls []string) bool {
+	for _, url := range urls {
+		if isYouTubeURL(url) {
+			return true
+		}
+	}
+	return false
+}
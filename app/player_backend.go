@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var errPlayerUnsupported = errors.New("not supported by this player")
+
+// Kinds of PlayerEvent a backend can report
+const (
+	PlayerEventPosition    = "position"     // Value: float64 seconds
+	PlayerEventDuration    = "duration"     // Value: float64 seconds
+	PlayerEventPaused      = "paused"       // Value: bool
+	PlayerEventPlaylistPos = "playlist-pos" // Value: int
+	PlayerEventVolume      = "volume"       // Value: float64 percent
+	PlayerEventMuted       = "muted"        // Value: bool
+	PlayerEventSpeed       = "speed"        // Value: float64 multiplier
+	PlayerEventSeeked      = "seeked"       // position is settled after a seek or file start
+	PlayerEventEndFile     = "end-file"     // Reason: eof, stop, quit, error, ...
+)
+
+// PlayerEvent is a state change reported by a PlayerBackend
+type PlayerEvent struct {
+	Kind   string
+	Value  interface{}
+	Reason string
+}
+
+// PlayerBackend is an external media player that Player can launch and,
+// where the player allows it, observe and control. A backend instance
+// drives a single process; Player creates a new one for every launch.
+type PlayerBackend interface {
+	// Name is the identifier used in player settings
+	Name() string
+
+	// Start launches the player on items. startPosition applies to the
+	// first item only. Options a player can't honor are ignored.
+	Start(items []PlaylistItem, startPosition float64, opts StreamOptions) (*exec.Cmd, error)
+
+	// Attach connects to the started process and reports state changes
+	// through emit until Detach is called or the process exits.
+	Attach(cmd *exec.Cmd, emit func(PlayerEvent))
+
+	// Detach drops the control connection
+	Detach()
+
+	// Append adds an item to the end of the running player's playlist
+	Append(item PlaylistItem) error
+
+	// Position asks the player where it is, returning -1 if it can't tell
+	Position() float64
+
+	// Quit asks the player to exit. An error means the request wasn't sent.
+	Quit() error
+
+	SetPaused(paused bool) error
+	TogglePause() error
+	Seek(seconds float64, relative bool) error
+	SetVolume(volume float64) error
+	SetMute(muted bool) error
+	Next() error
+	Previous() error
+	SetAudioTrack(track interface{}) error
+	SetSubtitleTrack(track interface{}) error
+	SetSpeed(speed float64) error
+
+	// ShowText puts a message on the player's on-screen display
+	ShowText(text string, duration time.Duration) error
+
+	// OfferSkip shows prompt for up to duration and lets the viewer accept
+	// it from the player's own controls by seeking to target. ClearSkip
+	// withdraws the offer.
+	OfferSkip(prompt string, target float64, duration time.Duration) error
+	ClearSkip() error
+}
+
+// noPlayerControls is embedded by backends that can't be remote controlled
+type noPlayerControls struct{}
+
+func (noPlayerControls) SetPaused(bool) error                 { return errPlayerUnsupported }
+func (noPlayerControls) TogglePause() error                   { return errPlayerUnsupported }
+func (noPlayerControls) Seek(float64, bool) error             { return errPlayerUnsupported }
+func (noPlayerControls) SetVolume(float64) error              { return errPlayerUnsupported }
+func (noPlayerControls) SetMute(bool) error                   { return errPlayerUnsupported }
+func (noPlayerControls) Next() error                          { return errPlayerUnsupported }
+func (noPlayerControls) Previous() error                      { return errPlayerUnsupported }
+func (noPlayerControls) SetAudioTrack(interface{}) error      { return errPlayerUnsupported }
+func (noPlayerControls) SetSubtitleTrack(interface{}) error   { return errPlayerUnsupported }
+func (noPlayerControls) SetSpeed(float64) error               { return errPlayerUnsupported }
+func (noPlayerControls) Position() float64                    { return -1 }
+func (noPlayerControls) Quit() error                          { return errPlayerUnsupported }
+func (noPlayerControls) Append(PlaylistItem) error            { return errPlayerUnsupported }
+func (noPlayerControls) ShowText(string, time.Duration) error { return errPlayerUnsupported }
+func (noPlayerControls) OfferSkip(string, float64, time.Duration) error {
+	return errPlayerUnsupported
+}
+func (noPlayerControls) ClearSkip() error { return errPlayerUnsupported }
+
+// PlayerBackendInfo describes a selectable backend for the settings UI
+type PlayerBackendInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	Available   bool   `json:"available"`
+}
+
+// DetectPlayerBackends lists the known backends and whether each can run here
+func DetectPlayerBackends() []PlayerBackendInfo {
+	return []PlayerBackendInfo{
+		{Name: "mpv", DisplayName: "mpv", Available: findExecutable(mpvCandidates()) != ""},
+		{Name: "vlc", DisplayName: "VLC", Available: findExecutable(vlcCandidates()) != ""},
+		{Name: "command", DisplayName: "Custom command", Available: true},
+	}
+}
+
+// playlistURLs returns the URL of every item
+func playlistURLs(items []PlaylistItem) []string {
+	urls := make([]string, len(items))
+	for i, item := range items {
+		urls[i] = item.URL
+	}
+	return urls
+}
+
+// redactHeaderArgs hides header values, which often carry tokens, in args
+// logged at startup
+func redactHeaderArgs(args []string, prefix string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		if strings.HasPrefix(arg, prefix) {
+			if colon := strings.Index(arg[len(prefix):], ":"); colon >= 0 {
+				arg = arg[:len(prefix)+colon+1] + " ***"
+			}
+		}
+		redacted[i] = arg
+	}
+	return redacted
+}
+
+// findExecutable returns the first candidate that exists, either on PATH or
+// as an absolute path
+func findExecutable(candidates []string) string {
+	for _, path := range candidates {
+		if _, err := exec.LookPath(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// How long a player gets to exit at each step of terminatePlayerProcess
+const (
+	playerQuitTimeout      = 3 * time.Second
+	playerTerminateTimeout = 2 * time.Second
+)
+
+// terminatePlayerProcess waits up to grace for a player that was asked to
+// quit, then escalates to SIGTERM and finally SIGKILL. exited is closed once
+// the process has exited and been handled.
+func terminatePlayerProcess(cmd *exec.Cmd, exited <-chan struct{}, grace time.Duration) {
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	if waitForExit(exited, grace) {
+		return
+	}
+
+	pid := cmd.Process.Pid
+	Log("ExternalPlayer: player still running, terminating pid=%d", pid)
+	if runtime.GOOS == "windows" {
+		exec.Command("taskkill", "/PID", fmt.Sprintf("%d", pid)).Run()
+	} else {
+		cmd.Process.Signal(syscall.SIGTERM)
+	}
+	if waitForExit(exited, playerTerminateTimeout) {
+		return
+	}
+
+	Log("ExternalPlayer: player ignored SIGTERM, killing pid=%d", pid)
+	cmd.Process.Kill()
+	waitForExit(exited, playerTerminateTimeout)
+}
+
+func waitForExit(exited <-chan struct{}, timeout time.Duration) bool {
+	if timeout <= 0 {
+		select {
+		case <-exited:
+			return true
+		default:
+			return false
+		}
+	}
+	select {
+	case <-exited:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCommandBackendArgs(t *testing.T) {
+	player, readArgs := fakeExecutable(t)
+	items := []PlaylistItem{
+		{URL: "https://example.com/1.mkv", Title: "One"},
+		{URL: "https://example.com/2.mkv"},
+	}
+
+	tests := []struct {
+		template string
+		want     []string
+	}{
+		{"", []string{"https://example.com/1.mkv", "https://example.com/2.mkv"}},
+		{"--start={start} {url}", []string{"--start=75", "https://example.com/1.mkv"}},
+		{"--title={title} {urls} --fs", []string{"--title=One", "https://example.com/1.mkv", "https://example.com/2.mkv", "--fs"}},
+		{"--fs", []string{"--fs", "https://example.com/1.mkv", "https://example.com/2.mkv"}},
+	}
+	for _, tt := range tests {
+		args := startFake(t, newCommandBackend(player+" "+tt.template), readArgs, items, 75.9, StreamOptions{})
+		if !reflect.DeepEqual(args, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.template, args, tt.want)
+		}
+	}
+
+	if _, err := newCommandBackend("  ").Start(items, 0, StreamOptions{}); err == nil {
+		t.Error("empty command started")
+	}
+	if err := newCommandBackend(player).SetPaused(true); err != errPlayerUnsupported {
+		t.Errorf("command backend pause: %v", err)
+	}
+}
+
+func TestVLCArgs(t *testing.T) {
+	vlc, readArgs := fakeExecutable(t)
+	backend := newVLCBackend(vlc, PlayerSettings{})
+	items := []PlaylistItem{
+		{URL: "https://example.com/1.mkv", Title: "One"},
+		{URL: "https://example.com/2.mkv"},
+	}
+	args := startFake(t, backend, readArgs, items, 42, StreamOptions{})
+
+	// Options starting with ':' follow the item they apply to
+	for _, run := range [][]string{
+		{"https://example.com/1.mkv", ":start-time=42", ":meta-title=One", "https://example.com/2.mkv"},
+		{"--extraintf=rc"},
+		{"--fullscreen"},
+	} {
+		if !containsRun(args, run) {
+			t.Errorf("args %q lack %q", args, run)
+		}
+	}
+	if args[len(args)-1] != "https://example.com/2.mkv" {
+		t.Errorf("the second item got options: %q", args)
+	}
+}
+
+func TestNewBackendFollowsSettings(t *testing.T) {
+	p := NewPlayer(t.TempDir())
+	tests := []struct {
+		settings PlayerSettings
+		want     string
+	}{
+		{PlayerSettings{}, "mpv"},
+		{PlayerSettings{Backend: "mpv"}, "mpv"},
+		{PlayerSettings{Backend: "command", Command: "true {url}"}, "command"},
+		{PlayerSettings{Backend: "command"}, "mpv"}, // nothing to run
+		{PlayerSettings{Backend: "unknown"}, "mpv"},
+	}
+	for _, tt := range tests {
+		if got := p.newBackend(tt.settings).Name(); got != tt.want {
+			t.Errorf("%+v: got %s, want %s", tt.settings, got, tt.want)
+		}
+	}
+}
+
+func TestMpvStreamOptions(t *testing.T) {
+	mpv, readArgs := fakeExecutable(t)
+	backend := newMpvBackend(mpv, PlayerSettings{}, t.TempDir())
+	items := []PlaylistItem{{
+		URL:       "https://example.com/1.mkv",
+		Subtitles: []string{"https://example.com/1.en.srt", "https://example.com/1.de.srt"},
+		Poster:    "https://example.com/1.jpg",
+	}}
+	opts := StreamOptions{
+		AudioLanguage:    "jpn,eng",
+		SubtitleLanguage: "eng",
+		Headers:          map[string]string{"Authorization": "MediaBrowser Token=abc, Client=x"},
+		Cookies:          "session=1",
+		UserAgent:        "LaunchTube/1",
+	}
+	args := startFake(t, backend, readArgs, items, 0, opts)
+
+	for _, want := range []string{
+		"--alang=jpn,eng",
+		"--slang=eng",
+		"--user-agent=LaunchTube/1",
+		"--http-header-fields-append=Authorization: MediaBrowser Token=abc, Client=x",
+		"--http-header-fields-append=Cookie: session=1",
+		"--sub-file=https://example.com/1.en.srt",
+		"--sub-file=https://example.com/1.de.srt",
+		"--cover-art-file=https://example.com/1.jpg",
+	} {
+		if !containsRun(args, []string{want}) {
+			t.Errorf("args %q lack %q", args, want)
+		}
+	}
+}
+
+func TestVLCStreamOptions(t *testing.T) {
+	vlc, readArgs := fakeExecutable(t)
+	backend := newVLCBackend(vlc, PlayerSettings{})
+	items := []PlaylistItem{
+		{URL: "https://example.com/1.mkv", Subtitles: []string{"https://example.com/1.en.srt", "https://example.com/1.de.srt"}},
+		{URL: "https://example.com/2.mkv"},
+	}
+	opts := StreamOptions{
+		AudioLanguage: "jpn",
+		Headers:       map[string]string{"Referer": "https://example.com/", "Authorization": "secret"},
+	}
+	args := startFake(t, backend, readArgs, items, 0, opts)
+
+	// VLC only takes the first subtitle, and of the headers only Referer
+	for _, run := range [][]string{
+		{"--audio-language=jpn"},
+		{"https://example.com/1.mkv", ":sub-file=https://example.com/1.en.srt", ":http-referrer=https://example.com/", "https://example.com/2.mkv", ":http-referrer=https://example.com/"},
+	} {
+		if !containsRun(args, run) {
+			t.Errorf("args %q lack %q", args, run)
+		}
+	}
+	for _, arg := range args {
+		if strings.Contains(arg, "secret") || strings.Contains(arg, "1.de.srt") {
+			t.Errorf("vlc got %q", arg)
+		}
+	}
+}
+
+func TestRedactHeaderArgs(t *testing.T) {
+	args := []string{"--fs", "--http-header-fields-append=Authorization: Token=abc", "--http-header-fields-append=odd"}
+	want := []string{"--fs", "--http-header-fields-append=Authorization: ***", "--http-header-fields-append=odd"}
+	if got := redactHeaderArgs(args, "--http-header-fields-append="); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// commandBackend runs a user-supplied command line for players LaunchTube
+// can't talk to. It reports nothing and can't be controlled; Player only
+// learns when the process exits.
+//
+// The template is split on whitespace and these placeholders are replaced
+// in each argument:
+//
+//	{url}    first URL
+//	{urls}   all URLs, as separate arguments (must stand alone)
+//	{title}  title, if any
+//	{start}  start position in whole seconds
+//
+// Without {url} or {urls} the URLs are appended at the end.
+type commandBackend struct {
+	noPlayerControls
+	template string
+}
+
+func newCommandBackend(template string) *commandBackend {
+	return &commandBackend{template: template}
+}
+
+func (c *commandBackend) Name() string {
+	return "command"
+}
+
+func (c *commandBackend) Start(items []PlaylistItem, startPosition float64, opts StreamOptions) (*exec.Cmd, error) {
+	urls := playlistURLs(items)
+	title := items[0].Title
+
+	fields := strings.Fields(c.template)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no player command configured")
+	}
+
+	var args []string
+	hasURL := false
+	for _, field := range fields[1:] {
+		if field == "{urls}" {
+			args = append(args, urls...)
+			hasURL = true
+			continue
+		}
+		if strings.Contains(field, "{url}") {
+			hasURL = true
+		}
+		field = strings.ReplaceAll(field, "{url}", urls[0])
+		field = strings.ReplaceAll(field, "{title}", title)
+		field = strings.ReplaceAll(field, "{start}", fmt.Sprintf("%d", int(startPosition)))
+		args = append(args, field)
+	}
+	if !hasURL {
+		args = append(args, urls...)
+	}
+
+	Log("ExternalPlayer: Starting command %s with args: %v", fields[0], args)
+
+	cmd := exec.Command(fields[0], args...)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+func (c *commandBackend) Attach(cmd *exec.Cmd, emit func(PlayerEvent)) {}
+
+func (c *commandBackend) Detach() {}
@@ -0,0 +1,559 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mpvPipeName is mpv's IPC named pipe on Windows and WSL
+const mpvPipeName = "launchtube-mpv"
+
+// mpvBackend drives mpv through its JSON IPC interface
+type mpvBackend struct {
+	mu          sync.Mutex
+	mpvPath     string
+	settings    PlayerSettings
+	dataDir     string
+	socketPath  string
+	ipc         *MpvIPC
+	stopPolling chan struct{}
+	detached    bool
+}
+
+func newMpvBackend(mpvPath string, settings PlayerSettings, dataDir string) *mpvBackend {
+	if settings.MpvPath != "" {
+		mpvPath = settings.MpvPath
+	}
+	return &mpvBackend{
+		mpvPath:  mpvPath,
+		settings: settings,
+		dataDir:  dataDir,
+	}
+}
+
+// mpvCandidates lists where mpv is usually installed
+func mpvCandidates() []string {
+	candidates := []string{"mpv"}
+	if runtime.GOOS == "windows" {
+		candidates = append(candidates,
+			`C:\Program Files\mpv\mpv.exe`,
+			`C:\Program Files (x86)\mpv\mpv.exe`,
+		)
+	}
+	return candidates
+}
+
+func getMpvConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "share", "launchtube", "mpv.conf")
+}
+
+func ensureMpvConfig() string {
+	configPath := getMpvConfigPath()
+	if configPath == "" {
+		return ""
+	}
+
+	// Check if file already exists
+	if _, err := os.Stat(configPath); err == nil {
+		return configPath
+	}
+
+	// Create directory if needed
+	dir := filepath.Dir(configPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		Log("ExternalPlayer: Failed to create config dir: %v", err)
+		return ""
+	}
+
+	// Write default config
+	defaultConfig := `# Launchtube mpv key bindings
+# See: https://mpv.io/manual/master/#input-conf
+
+ESC quit
+`
+	if err := os.WriteFile(configPath, []byte(defaultConfig), 0644); err != nil {
+		Log("ExternalPlayer: Failed to write mpv config: %v", err)
+		return ""
+	}
+
+	Log("ExternalPlayer: Created default mpv config at %s", configPath)
+	return configPath
+}
+
+func (m *mpvBackend) Name() string {
+	return "mpv"
+}
+
+// usesNamedPipe reports whether mpv's IPC server is a Windows named pipe,
+// which we can only reach through PowerShell, see DialMpvPipe
+func (m *mpvBackend) usesNamedPipe() bool {
+	return runtime.GOOS == "windows" || isWSL()
+}
+
+// Start launches mpv with one or more URLs. When several URLs are given
+// they form mpv's internal playlist and startPosition applies only to the
+// first one.
+func (m *mpvBackend) Start(items []PlaylistItem, startPosition float64, opts StreamOptions) (*exec.Cmd, error) {
+	urls := playlistURLs(items)
+
+	// Determine socket path
+	if m.usesNamedPipe() {
+		m.socketPath = `\\.\pipe\` + mpvPipeName
+	} else {
+		m.socketPath = "/tmp/launchtube-mpv.sock"
+		// Remove existing socket
+		os.Remove(m.socketPath)
+	}
+
+	args := []string{
+		fmt.Sprintf("--input-ipc-server=%s", m.socketPath),
+	}
+	if opts.Audio {
+		// Nothing to look at: no window, not even for embedded cover art
+		args = append(args, "--no-video", "--force-window=no")
+	} else {
+		if !m.settings.Windowed {
+			args = append(args, "--fullscreen")
+		}
+		if m.settings.Screen > 0 {
+			// mpv numbers screens from 0
+			screen := m.settings.Screen - 1
+			args = append(args, fmt.Sprintf("--screen=%d", screen), fmt.Sprintf("--fs-screen=%d", screen))
+		}
+	}
+
+	// Add custom input config if available
+	if inputConf := ensureMpvConfig(); inputConf != "" {
+		args = append(args, fmt.Sprintf("--input-conf=%s", inputConf))
+	}
+
+	// Add YouTube-specific options for yt-dlp streams
+	if anyYouTubeURL(urls) {
+		// Pass cookies file if it exists
+		cookiesPath := filepath.Join(m.dataDir, "cookies.txt")
+		if _, err := os.Stat(cookiesPath); err == nil {
+			args = append(args, fmt.Sprintf("--ytdl-raw-options=cookies=%s", cookiesPath))
+		}
+		format := m.settings.ytdlFormat()
+		if opts.Audio {
+			format = "bestaudio/best"
+		}
+		args = append(args,
+			// Cap quality (1080p unless the profile says otherwise) to
+			// avoid bandwidth issues
+			fmt.Sprintf("--ytdl-format=%s", format),
+			// Increase buffer for smoother playback
+			"--cache=yes",
+			fmt.Sprintf("--demuxer-max-bytes=%s", m.settings.cacheSize()),
+			fmt.Sprintf("--demuxer-max-back-bytes=%s", m.settings.backCacheSize()),
+		)
+	} else if m.settings.CacheSize != "" || m.settings.BackCacheSize != "" {
+		args = append(args,
+			"--cache=yes",
+			fmt.Sprintf("--demuxer-max-bytes=%s", m.settings.cacheSize()),
+			fmt.Sprintf("--demuxer-max-back-bytes=%s", m.settings.backCacheSize()),
+		)
+	}
+
+	if opts.AudioLanguage != "" {
+		args = append(args, fmt.Sprintf("--alang=%s", opts.AudioLanguage))
+	}
+	if opts.SubtitleLanguage != "" {
+		args = append(args, fmt.Sprintf("--slang=%s", opts.SubtitleLanguage))
+	}
+	if opts.UserAgent != "" {
+		args = append(args, fmt.Sprintf("--user-agent=%s", opts.UserAgent))
+	}
+	// -append takes one header at a time, so commas in values are safe
+	for name, value := range opts.HTTPHeaders() {
+		args = append(args, fmt.Sprintf("--http-header-fields-append=%s: %s", name, value))
+	}
+
+	if m.settings.MpvOptions != "" {
+		// Split options and add them
+		args = append(args, strings.Fields(m.settings.MpvOptions)...)
+	}
+
+	if len(items) == 1 {
+		item := items[0]
+		if item.Title != "" {
+			args = append(args, fmt.Sprintf("--title=%s", item.Title))
+		}
+		if startPosition > 0 {
+			args = append(args, fmt.Sprintf("--start=%d", int(startPosition)))
+		}
+		args = append(args, mpvItemOptions(item)...)
+		args = append(args, item.URL)
+	} else {
+		// Per-file option groups so each item keeps its own title,
+		// subtitles and, for the first, start offset
+		for i, item := range items {
+			itemArgs := mpvItemOptions(item)
+			if item.Title != "" {
+				itemArgs = append(itemArgs, fmt.Sprintf("--force-media-title=%s", item.Title))
+			}
+			if i == 0 && startPosition > 0 {
+				itemArgs = append(itemArgs, fmt.Sprintf("--start=%d", int(startPosition)))
+			}
+			if len(itemArgs) == 0 {
+				args = append(args, item.URL)
+				continue
+			}
+			args = append(args, "--{")
+			args = append(args, itemArgs...)
+			args = append(args, item.URL, "--}")
+		}
+	}
+
+	Log("ExternalPlayer: Starting mpv at path=%s with args: %v", m.mpvPath, redactHeaderArgs(args, "--http-header-fields-append="))
+
+	cmd := exec.Command(m.mpvPath, args...)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// mpvItemOptions returns the options for an item's subtitles and poster
+func mpvItemOptions(item PlaylistItem) []string {
+	var args []string
+	for _, sub := range item.Subtitles {
+		args = append(args, fmt.Sprintf("--sub-file=%s", sub))
+	}
+	if item.Poster != "" {
+		args = append(args, fmt.Sprintf("--cover-art-file=%s", item.Poster))
+	}
+	return args
+}
+
+// Attach opens the persistent IPC connection to a freshly started mpv and
+// subscribes to the properties the player tracks. If a named pipe can't be
+// reached that way, it is polled instead.
+func (m *mpvBackend) Attach(cmd *exec.Cmd, emit func(PlayerEvent)) {
+	onEvent := func(ev mpvEvent) {
+		m.translateEvent(ev, emit)
+	}
+	var ipc *MpvIPC
+	var err error
+	if m.usesNamedPipe() {
+		ipc, err = DialMpvPipe(mpvPipeName, 10*time.Second, onEvent)
+	} else {
+		ipc, err = DialMpvIPC(m.socketPath, 10*time.Second, onEvent)
+	}
+	if err != nil {
+		Log("ExternalPlayer: %v", err)
+		if m.usesNamedPipe() {
+			m.startPolling(emit)
+		}
+		return
+	}
+
+	m.mu.Lock()
+	if m.detached {
+		// mpv was stopped while we were connecting
+		m.mu.Unlock()
+		ipc.Close()
+		return
+	}
+	m.ipc = ipc
+	m.mu.Unlock()
+
+	for i, name := range []string{"time-pos", "duration", "pause", "playlist-pos", "volume", "mute", "speed"} {
+		if err := ipc.Observe(i+1, name); err != nil {
+			Log("ExternalPlayer: observe %s failed: %v", name, err)
+		}
+	}
+	Log("ExternalPlayer: IPC connected to %s", m.socketPath)
+}
+
+// startPolling falls back to asking a named pipe for the position every
+// second, one PowerShell process per poll
+func (m *mpvBackend) startPolling(emit func(PlayerEvent)) {
+	m.mu.Lock()
+	if m.detached {
+		m.mu.Unlock()
+		return
+	}
+	m.stopPolling = make(chan struct{})
+	stop := m.stopPolling
+	m.mu.Unlock()
+	Log("ExternalPlayer: polling %s instead", m.socketPath)
+	m.pollPosition(stop, emit)
+}
+
+func (m *mpvBackend) Detach() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.detached = true
+	if m.stopPolling != nil {
+		select {
+		case <-m.stopPolling:
+		default:
+			close(m.stopPolling)
+		}
+	}
+	if m.ipc != nil {
+		m.ipc.Close()
+		m.ipc = nil
+	}
+}
+
+// translateEvent maps mpv's own events and property names onto PlayerEvents
+func (m *mpvBackend) translateEvent(ev mpvEvent, emit func(PlayerEvent)) {
+	switch ev.Event {
+	case "property-change":
+		switch ev.Name {
+		case "time-pos":
+			emit(PlayerEvent{Kind: PlayerEventPosition, Value: ev.Data})
+		case "duration":
+			emit(PlayerEvent{Kind: PlayerEventDuration, Value: ev.Data})
+		case "pause":
+			emit(PlayerEvent{Kind: PlayerEventPaused, Value: ev.Data})
+		case "playlist-pos":
+			if pos, ok := ev.Data.(float64); ok {
+				emit(PlayerEvent{Kind: PlayerEventPlaylistPos, Value: int(pos)})
+			}
+		case "volume":
+			emit(PlayerEvent{Kind: PlayerEventVolume, Value: ev.Data})
+		case "mute":
+			emit(PlayerEvent{Kind: PlayerEventMuted, Value: ev.Data})
+		case "speed":
+			emit(PlayerEvent{Kind: PlayerEventSpeed, Value: ev.Data})
+		}
+	case "playback-restart":
+		// Fires once a seek (or file start) settles, so time-pos is accurate
+		emit(PlayerEvent{Kind: PlayerEventSeeked})
+	case "end-file":
+		emit(PlayerEvent{Kind: PlayerEventEndFile, Reason: ev.Reason})
+	}
+}
+
+func (m *mpvBackend) pollPosition(stop chan struct{}, emit func(PlayerEvent)) {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			m.queryPositionWindows(emit)
+		}
+	}
+}
+
+func (m *mpvBackend) queryPositionWindows(emit func(PlayerEvent)) {
+	// Use PowerShell to communicate with named pipe
+	script := fmt.Sprintf(`
+$pipe = New-Object System.IO.Pipes.NamedPipeClientStream(".", "launchtube-mpv", [System.IO.Pipes.PipeDirection]::InOut)
+$pipe.Connect(500)
+$writer = New-Object System.IO.StreamWriter($pipe)
+$reader = New-Object System.IO.StreamReader($pipe)
+$writer.WriteLine('{"command":["get_property","time-pos"],"request_id":1}')
+$writer.WriteLine('{"command":["get_property","duration"],"request_id":2}')
+$writer.WriteLine('{"command":["get_property","pause"],"request_id":3}')
+$writer.WriteLine('{"command":["get_property","playlist-pos"],"request_id":4}')
+$writer.Flush()
+Write-Output $reader.ReadLine()
+Write-Output $reader.ReadLine()
+Write-Output $reader.ReadLine()
+Write-Output $reader.ReadLine()
+$pipe.Close()
+`)
+
+	cmd := exec.Command("powershell", "-Command", script)
+	output, err := cmd.Output()
+	if err != nil {
+		return
+	}
+
+	lines := strings.Split(string(output), "\n")
+	for _, line := range lines {
+		m.parseIpcResponse(line, emit)
+	}
+}
+
+func (m *mpvBackend) parseIpcResponse(line string, emit func(PlayerEvent)) {
+	var resp struct {
+		RequestID int         `json:"request_id"`
+		Data      interface{} `json:"data"`
+		Error     string      `json:"error"`
+	}
+
+	if err := json.Unmarshal([]byte(line), &resp); err != nil {
+		return
+	}
+
+	if resp.Error != "" && resp.Error != "success" {
+		return
+	}
+
+	switch resp.RequestID {
+	case 1: // time-pos
+		emit(PlayerEvent{Kind: PlayerEventPosition, Value: resp.Data})
+	case 2: // duration
+		emit(PlayerEvent{Kind: PlayerEventDuration, Value: resp.Data})
+	case 3: // pause
+		emit(PlayerEvent{Kind: PlayerEventPaused, Value: resp.Data})
+	case 4: // playlist-pos
+		if pos, ok := resp.Data.(float64); ok {
+			emit(PlayerEvent{Kind: PlayerEventPlaylistPos, Value: int(pos)})
+		}
+	}
+}
+
+// Command sends a raw mpv IPC command. On Windows and WSL without a relay,
+// it goes through a one-off PowerShell process.
+func (m *mpvBackend) Command(args ...interface{}) (interface{}, error) {
+	m.mu.Lock()
+	ipc := m.ipc
+	m.mu.Unlock()
+
+	if ipc != nil {
+		return ipc.Command(args...)
+	}
+	if m.usesNamedPipe() {
+		return nil, m.commandWindows(args)
+	}
+	return nil, fmt.Errorf("player IPC not connected")
+}
+
+func (m *mpvBackend) commandWindows(args []interface{}) error {
+	line, err := json.Marshal(map[string]interface{}{"command": args})
+	if err != nil {
+		return err
+	}
+	script := fmt.Sprintf(`
+$pipe = New-Object System.IO.Pipes.NamedPipeClientStream(".", "launchtube-mpv", [System.IO.Pipes.PipeDirection]::InOut)
+$pipe.Connect(500)
+$writer = New-Object System.IO.StreamWriter($pipe)
+$writer.WriteLine('%s')
+$writer.Flush()
+$pipe.Close()
+`, strings.ReplaceAll(string(line), "'", "''"))
+	return exec.Command("powershell", "-Command", script).Run()
+}
+
+// Append queues an item after the last one. Per-item options such as
+// subtitles aren't passed, since loadfile's argument order differs between
+// mpv versions.
+func (m *mpvBackend) Append(item PlaylistItem) error {
+	_, err := m.Command("loadfile", item.URL, "append")
+	return err
+}
+
+// Position reads time-pos. When a named pipe is being polled it is
+// write-only from here, so the position comes from the last poll instead.
+func (m *mpvBackend) Position() float64 {
+	if v, err := m.Command("get_property", "time-pos"); err == nil {
+		if pos, ok := v.(float64); ok {
+			return pos
+		}
+	}
+	return -1
+}
+
+// Quit tells mpv to quit
+func (m *mpvBackend) Quit() error {
+	// mpv may exit before it answers, which still means it got the command
+	if _, err := m.Command("quit"); err != nil && err != errMpvIPCClosed {
+		return err
+	}
+	return nil
+}
+
+func (m *mpvBackend) SetPaused(paused bool) error {
+	_, err := m.Command("set_property", "pause", paused)
+	return err
+}
+
+func (m *mpvBackend) TogglePause() error {
+	_, err := m.Command("cycle", "pause")
+	return err
+}
+
+func (m *mpvBackend) Seek(seconds float64, relative bool) error {
+	mode := "absolute"
+	if relative {
+		mode = "relative"
+	}
+	_, err := m.Command("seek", seconds, mode)
+	return err
+}
+
+// SetVolume sets the volume in percent (mpv allows up to 130 by default)
+func (m *mpvBackend) SetVolume(volume float64) error {
+	_, err := m.Command("set_property", "volume", volume)
+	return err
+}
+
+func (m *mpvBackend) SetMute(muted bool) error {
+	_, err := m.Command("set_property", "mute", muted)
+	return err
+}
+
+func (m *mpvBackend) Next() error {
+	_, err := m.Command("playlist-next")
+	return err
+}
+
+func (m *mpvBackend) Previous() error {
+	_, err := m.Command("playlist-prev")
+	return err
+}
+
+// SetAudioTrack selects an audio track by mpv track ID, or "auto"/"no"
+func (m *mpvBackend) SetAudioTrack(track interface{}) error {
+	_, err := m.Command("set_property", "aid", track)
+	return err
+}
+
+// SetSubtitleTrack selects a subtitle track by mpv track ID, or "auto"/"no"
+func (m *mpvBackend) SetSubtitleTrack(track interface{}) error {
+	_, err := m.Command("set_property", "sid", track)
+	return err
+}
+
+func (m *mpvBackend) SetSpeed(speed float64) error {
+	_, err := m.Command("set_property", "speed", speed)
+	return err
+}
+
+func (m *mpvBackend) ShowText(text string, duration time.Duration) error {
+	_, err := m.Command("show-text", text, duration.Milliseconds())
+	return err
+}
+
+// mpvSkipSection is the input section bound while a skip is on offer
+const mpvSkipSection = "launchtube-skip"
+
+// OfferSkip binds Enter to the skip in a forced input section, so it wins
+// over mpv's default Enter binding until ClearSkip
+func (m *mpvBackend) OfferSkip(prompt string, target float64, duration time.Duration) error {
+	seek := fmt.Sprintf("seek %.3f absolute", target)
+	bindings := fmt.Sprintf("ENTER %s\nKP_ENTER %s\n", seek, seek)
+	if _, err := m.Command("define-section", mpvSkipSection, bindings, "force"); err != nil {
+		return err
+	}
+	if _, err := m.Command("enable-section", mpvSkipSection); err != nil {
+		return err
+	}
+	return m.ShowText(prompt, duration)
+}
+
+func (m *mpvBackend) ClearSkip() error {
+	_, err := m.Command("disable-section", mpvSkipSection)
+	return err
+}
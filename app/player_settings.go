@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Defaults used when a profile leaves a setting empty
+const (
+	defaultMaxHeight     = 1080
+	defaultCacheSize     = "150M"
+	defaultBackCacheSize = "75M"
+)
+
+// PlayerSettings are a profile's external player preferences, stored in
+// profiles/<id>/player.json
+type PlayerSettings struct {
+	// Backend is "mpv" (default), "vlc" or "command"
+	Backend string `json:"backend,omitempty"`
+	// Command is the command line template for the "command" backend
+	Command string `json:"command,omitempty"`
+
+	// MpvPath overrides the detected mpv executable
+	MpvPath string `json:"mpvPath,omitempty"`
+	// MpvOptions are extra mpv arguments, split on whitespace
+	MpvOptions string `json:"mpvOptions,omitempty"`
+
+	// MaxHeight caps the resolution picked for yt-dlp streams (720, 2160, ...)
+	MaxHeight int `json:"maxHeight,omitempty"`
+	// CacheSize and BackCacheSize size the demuxer cache, in mpv notation
+	// ("150M", "1G")
+	CacheSize     string `json:"cacheSize,omitempty"`
+	BackCacheSize string `json:"backCacheSize,omitempty"`
+	// PreferredCodecs is a comma separated list of video codec prefixes
+	// tried in order for yt-dlp streams, e.g. "avc1,vp9"
+	PreferredCodecs string `json:"preferredCodecs,omitempty"`
+
+	// Windowed turns off fullscreen playback
+	Windowed bool `json:"windowed,omitempty"`
+	// Screen is the 1-based monitor to play on; 0 leaves it to the player
+	Screen int `json:"screen,omitempty"`
+
+	// IdleItems pauses playback and asks whether anyone is still watching
+	// after this many items in a row play without input; 0 turns it off
+	IdleItems int `json:"idleItems,omitempty"`
+
+	// SkipSegments is what happens at intros, credits and other segments
+	// the media server marks: "prompt" (default), "auto" or "off"
+	SkipSegments string `json:"skipSegments,omitempty"`
+}
+
+func (s PlayerSettings) skipSegments() string {
+	switch s.SkipSegments {
+	case segmentSkipAuto, segmentSkipOff:
+		return s.SkipSegments
+	}
+	return segmentSkipPrompt
+}
+
+func (s PlayerSettings) maxHeight() int {
+	if s.MaxHeight > 0 {
+		return s.MaxHeight
+	}
+	return defaultMaxHeight
+}
+
+func (s PlayerSettings) cacheSize() string {
+	if s.CacheSize != "" {
+		return s.CacheSize
+	}
+	return defaultCacheSize
+}
+
+func (s PlayerSettings) backCacheSize() string {
+	if s.BackCacheSize != "" {
+		return s.BackCacheSize
+	}
+	return defaultBackCacheSize
+}
+
+// ytdlFormat builds the yt-dlp format selector for the resolution cap and
+// codec preference, falling back to any codec and then to anything at all
+func (s PlayerSettings) ytdlFormat() string {
+	height := fmt.Sprintf("[height<=%d]", s.maxHeight())
+
+	var formats []string
+	for _, codec := range strings.Split(s.PreferredCodecs, ",") {
+		if codec = strings.TrimSpace(codec); codec != "" {
+			formats = append(formats, fmt.Sprintf("bestvideo%s[vcodec^=%s]+bestaudio", height, codec))
+		}
+	}
+	formats = append(formats,
+		fmt.Sprintf("bestvideo%s+bestaudio", height),
+		fmt.Sprintf("best%s", height),
+		"best",
+	)
+	return strings.Join(formats, "/")
+}
+
+func playerSettingsPath(dataDir, profileID string) (string, error) {
+	return profileFile(dataDir, profileID, "player.json")
+}
+
+// LoadPlayerSettings reads a profile's player settings, falling back to
+// defaults when the profile has none
+func LoadPlayerSettings(dataDir, profileID string) PlayerSettings {
+	var settings PlayerSettings
+	if profileID == "" {
+		return settings
+	}
+
+	path, err := playerSettingsPath(dataDir, profileID)
+	if err != nil {
+		return settings
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return settings
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		Log("Failed to parse player settings for profile %s: %v", profileID, err)
+	}
+	return settings
+}
+
+// SavePlayerSettings writes a profile's player settings
+func SavePlayerSettings(dataDir, profileID string, settings PlayerSettings) error {
+	if profileID == "" {
+		return fmt.Errorf("no profile selected")
+	}
+
+	path, err := playerSettingsPath(dataDir, profileID)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
@@ -0,0 +1,72 @@
+package main
+
+import "testing"
+
+func TestYtdlFormat(t *testing.T) {
+	tests := []struct {
+		settings PlayerSettings
+		want     string
+	}{
+		{
+			PlayerSettings{},
+			"bestvideo[height<=1080]+bestaudio/best[height<=1080]/best",
+		},
+		{
+			PlayerSettings{MaxHeight: 720},
+			"bestvideo[height<=720]+bestaudio/best[height<=720]/best",
+		},
+		{
+			PlayerSettings{MaxHeight: 2160, PreferredCodecs: "avc1, vp9,,"},
+			"bestvideo[height<=2160][vcodec^=avc1]+bestaudio/bestvideo[height<=2160][vcodec^=vp9]+bestaudio/" +
+				"bestvideo[height<=2160]+bestaudio/best[height<=2160]/best",
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.settings.ytdlFormat(); got != tt.want {
+			t.Errorf("%+v: got %s, want %s", tt.settings, got, tt.want)
+		}
+	}
+}
+
+func TestPlayerSettingsSaveAndLoad(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestProfile(t, dataDir, "alice")
+
+	if got := LoadPlayerSettings(dataDir, "alice"); got != (PlayerSettings{}) {
+		t.Errorf("no settings yet: got %+v", got)
+	}
+	want := PlayerSettings{Backend: "vlc", MaxHeight: 720, CacheSize: "1G", PreferredCodecs: "avc1", Screen: 2}
+	if err := SavePlayerSettings(dataDir, "alice", want); err != nil {
+		t.Fatal(err)
+	}
+	if got := LoadPlayerSettings(dataDir, "alice"); got != want {
+		t.Errorf("loaded %+v, want %+v", got, want)
+	}
+	if err := SavePlayerSettings(dataDir, "", want); err == nil {
+		t.Error("saved settings without a profile")
+	}
+}
+
+func TestMpvFollowsPlayerSettings(t *testing.T) {
+	mpv, readArgs := fakeExecutable(t)
+	settings := PlayerSettings{MaxHeight: 720, CacheSize: "1G", PreferredCodecs: "vp9", Windowed: true, Screen: 2, MpvOptions: "--volume=50  --mute=yes"}
+	backend := newMpvBackend(mpv, settings, t.TempDir())
+	args := startFake(t, backend, readArgs, []PlaylistItem{{URL: "https://www.youtube.com/watch?v=x"}}, 0, StreamOptions{})
+
+	for _, want := range []string{
+		"--ytdl-format=" + settings.ytdlFormat(),
+		"--demuxer-max-bytes=1G",
+		"--demuxer-max-back-bytes=75M",
+		"--screen=1",
+		"--fs-screen=1",
+		"--volume=50",
+		"--mute=yes",
+	} {
+		if !containsRun(args, []string{want}) {
+			t.Errorf("args %q lack %q", args, want)
+		}
+	}
+	if containsRun(args, []string{"--fullscreen"}) {
+		t.Errorf("windowed playback went fullscreen: %q", args)
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBackend stands in for a running player, recording the controls sent
+// to it
+type fakeBackend struct {
+	noPlayerControls
+	mu    sync.Mutex
+	calls []string
+}
+
+func (f *fakeBackend) Name() string { return "fake" }
+
+func (f *fakeBackend) Start([]PlaylistItem, float64, StreamOptions) (*exec.Cmd, error) {
+	return nil, errPlayerUnsupported
+}
+func (f *fakeBackend) Attach(*exec.Cmd, func(PlayerEvent)) {}
+func (f *fakeBackend) Detach()                             {}
+
+func (f *fakeBackend) record(format string, args ...interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, fmt.Sprintf(format, args...))
+	return nil
+}
+
+func (f *fakeBackend) SetPaused(paused bool) error { return f.record("pause %v", paused) }
+func (f *fakeBackend) TogglePause() error          { return f.record("toggle") }
+func (f *fakeBackend) Seek(seconds float64, relative bool) error {
+	return f.record("seek %v %v", seconds, relative)
+}
+func (f *fakeBackend) SetVolume(volume float64) error { return f.record("volume %v", volume) }
+func (f *fakeBackend) SetMute(muted bool) error       { return f.record("mute %v", muted) }
+func (f *fakeBackend) SetSpeed(speed float64) error   { return f.record("speed %v", speed) }
+func (f *fakeBackend) ShowText(text string, _ time.Duration) error {
+	return f.record("text %s", text)
+}
+func (f *fakeBackend) OfferSkip(prompt string, target float64, _ time.Duration) error {
+	return f.record("offer %s %v", prompt, target)
+}
+func (f *fakeBackend) ClearSkip() error { return f.record("clear") }
+
+// Calls returns the controls received so far and forgets them
+func (f *fakeBackend) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	calls := f.calls
+	f.calls = nil
+	return calls
+}
+
+// newTestPlayer returns a Player that is playing items on a fakeBackend,
+// without a process behind it
+func newTestPlayer(t *testing.T, items []PlaylistItem) (*Player, *fakeBackend) {
+	backend := &fakeBackend{}
+	p := NewPlayer(t.TempDir())
+	p.SetEvents(NewEventHub())
+	p.backend = backend
+	p.cmd = &exec.Cmd{}
+	p.playing = true
+	p.playlist = items
+	if len(items) > 0 {
+		p.onComplete = items[0].OnComplete
+	}
+	p.segmentMode = segmentSkipPrompt
+	return p, backend
+}
+
+// fakeExecutable writes a script that records its arguments, one per line,
+// for a backend to run instead of the real player
+func fakeExecutable(t *testing.T) (path string, readArgs func() []string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	dir := t.TempDir()
+	path = filepath.Join(dir, "player")
+	argsFile := filepath.Join(dir, "args")
+	script := fmt.Sprintf("#!/bin/sh\nprintf '%%s\\n' \"$@\" > %q\n", argsFile)
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() []string {
+		data, err := os.ReadFile(argsFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+}
+
+// startFake runs backend.Start against the fake executable and returns the
+// arguments it was given
+func startFake(t *testing.T, backend PlayerBackend, readArgs func() []string, items []PlaylistItem, start float64, opts StreamOptions) []string {
+	cmd, err := backend.Start(items, start, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.Wait()
+	return readArgs()
+}
+
+// containsRun reports whether want appears in args as a contiguous run
+func containsRun(args, want []string) bool {
+	for i := 0; i+len(want) <= len(args); i++ {
+		if reflect.DeepEqual(args[i:i+len(want)], want) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMpvPlaylistArgs(t *testing.T) {
+	mpv, readArgs := fakeExecutable(t)
+	backend := newMpvBackend(mpv, PlayerSettings{}, t.TempDir())
+
+	items := []PlaylistItem{
+		{URL: "https://example.com/1.mkv", Title: "One"},
+		{URL: "https://example.com/2.mkv"},
+		{URL: "https://example.com/3.mkv", Title: "Three"},
+	}
+	args := startFake(t, backend, readArgs, items, 90, StreamOptions{})
+
+	// Every item is on the command line, in order, keeping its own title;
+	// the start offset belongs to the first item only
+	for _, run := range [][]string{
+		{"--{", "--force-media-title=One", "--start=90", "https://example.com/1.mkv", "--}"},
+		{"--}", "https://example.com/2.mkv", "--{"},
+		{"--{", "--force-media-title=Three", "https://example.com/3.mkv", "--}"},
+	} {
+		if !containsRun(args, run) {
+			t.Errorf("args %q lack %q", args, run)
+		}
+	}
+
+	args = startFake(t, backend, readArgs, items[:1], 90, StreamOptions{})
+	if !containsRun(args, []string{"--title=One", "--start=90", "https://example.com/1.mkv"}) {
+		t.Errorf("single item args %q", args)
+	}
+}
+
+func TestPlaylistPosFinishesItem(t *testing.T) {
+	items := []PlaylistItem{
+		{URL: "https://example.com/1.mkv", ItemID: "1", OnComplete: map[string]interface{}{"url": "http://one"}},
+		{URL: "https://example.com/2.mkv", ItemID: "2", OnComplete: map[string]interface{}{"url": "http://two"}},
+	}
+	p, backend := newTestPlayer(t, items)
+	writeTestProfile(t, p.dataDir, "alice")
+	p.profileID = "alice"
+	p.SetHistory(NewWatchHistory(p.dataDir))
+	events, unsubscribe := p.events.Subscribe()
+	defer unsubscribe()
+
+	p.handleEvent(backend, PlayerEvent{Kind: PlayerEventPosition, Value: 300.0})
+	p.handleEvent(backend, PlayerEvent{Kind: PlayerEventEndFile, Reason: "eof"})
+	p.handleEvent(backend, PlayerEvent{Kind: PlayerEventPlaylistPos, Value: 1})
+
+	state := p.State()
+	if state.PlaylistIndex != 1 || state.ItemID != "2" || state.Position != 0 {
+		t.Errorf("after moving on: %+v", state)
+	}
+	if p.onComplete["url"] != "http://two" {
+		t.Errorf("onComplete is still %v", p.onComplete)
+	}
+	if e, ok := p.history.Get("alice", "1"); !ok || e.Position != 300 {
+		t.Errorf("history of the finished item: %+v, %v", e, ok)
+	}
+
+	var changed bool
+	for len(events) > 0 {
+		ev := <-events
+		if ev.Type == "player.item-changed" {
+			changed = ev.Data.(map[string]interface{})["playlistIndex"] == 1
+		}
+	}
+	if !changed {
+		t.Error("no player.item-changed for item 1")
+	}
+
+	// Events from a player that has been replaced change nothing
+	p.handleEvent(&fakeBackend{}, PlayerEvent{Kind: PlayerEventPlaylistPos, Value: 0})
+	if p.State().PlaylistIndex != 1 {
+		t.Error("a stale backend moved the playlist")
+	}
+}
+
+// quittingBackend is a fakeBackend for a real process that exits as soon as
+// it is told to quit
+type quittingBackend struct {
+	*fakeBackend
+	cmd      *exec.Cmd
+	position float64
+}
+
+func (q *quittingBackend) Position() float64 { return q.position }
+func (q *quittingBackend) Quit() error       { return q.cmd.Process.Kill() }
+
+// runTestProcess makes p's running player the process cmd, finishing it
+// on exit the way start does
+func runTestProcess(t *testing.T, p *Player, cmd *exec.Cmd) {
+	if err := cmd.Start(); err != nil {
+		t.Skip(err)
+	}
+	exited := make(chan struct{})
+	p.cmd = cmd
+	p.exited = exited
+	go func() {
+		err := cmd.Wait()
+		p.mu.Lock()
+		p.finish(cmd, err)
+		p.mu.Unlock()
+		close(exited)
+	}()
+}
+
+func TestStopReportsFinalPosition(t *testing.T) {
+	p, fake := newTestPlayer(t, []PlaylistItem{{URL: "https://example.com/1.mkv", ItemID: "1"}})
+	writeTestProfile(t, p.dataDir, "alice")
+	p.profileID = "alice"
+	p.SetHistory(NewWatchHistory(p.dataDir))
+	events, unsubscribe := p.events.Subscribe()
+	defer unsubscribe()
+
+	cmd := exec.Command("sleep", "30")
+	p.backend = &quittingBackend{fakeBackend: fake, cmd: cmd, position: 1234.5}
+	runTestProcess(t, p, cmd)
+	p.position = 1200 // the last position event, a while ago
+	p.Stop()
+
+	var ended map[string]interface{}
+	for len(events) > 0 {
+		if ev := <-events; ev.Type == "player.ended" {
+			ended = ev.Data.(map[string]interface{})
+		}
+	}
+	if ended["position"] != 1234.5 || ended["reason"] != "user-quit" {
+		t.Errorf("player.ended %v", ended)
+	}
+	if e, _ := p.history.Get("alice", "1"); e.Position != 1234.5 {
+		t.Errorf("history position %v", e.Position)
+	}
+}
+
+func TestTerminatePlayerProcess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs POSIX signals")
+	}
+	start := func(script string) (*exec.Cmd, chan struct{}) {
+		cmd := exec.Command("sh", "-c", script)
+		if err := cmd.Start(); err != nil {
+			t.Skip(err)
+		}
+		exited := make(chan struct{})
+		go func() {
+			cmd.Wait()
+			close(exited)
+		}()
+		return cmd, exited
+	}
+
+	// A player that exits on SIGTERM doesn't wait for the kill
+	cmd, exited := start("exec sleep 30")
+	begin := time.Now()
+	terminatePlayerProcess(cmd, exited, 0)
+	if !waitForExit(exited, 0) || time.Since(begin) >= playerTerminateTimeout {
+		t.Errorf("SIGTERM took %v", time.Since(begin))
+	}
+
+	// One that ignores SIGTERM is killed
+	cmd, exited = start("trap '' TERM; exec sleep 30")
+	time.Sleep(100 * time.Millisecond) // let the trap be set
+	terminatePlayerProcess(cmd, exited, 0)
+	if !waitForExit(exited, 0) {
+		t.Error("player ignoring SIGTERM is still running")
+	}
+	if state := cmd.ProcessState; state == nil || state.String() != "signal: killed" {
+		t.Errorf("exit state %v", state)
+	}
+
+	// Nothing is signalled once the player has exited by itself
+	cmd, exited = start("exit 0")
+	<-exited
+	terminatePlayerProcess(cmd, exited, time.Second)
+}
+
+func TestIsAudioURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://example.com/music/song.mp3", true},
+		{"https://example.com/Album/Track.FLAC?api_key=x", true},
+		{"https://music.youtube.com/watch?v=abc", true},
+		{"/home/me/Music/a.opus", true},
+		{"https://example.com/video.mkv", false},
+		{"https://example.com/stream?file=song.mp3", false},
+		{"https://www.youtube.com/watch?v=abc", false},
+	}
+	for _, tt := range tests {
+		if got := isAudioURL(tt.url); got != tt.want {
+			t.Errorf("isAudioURL(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+
+	if !allAudioURLs([]string{"https://example.com/1.mp3", "https://example.com/2.ogg"}) {
+		t.Error("an all-audio playlist isn't audio")
+	}
+	if allAudioURLs([]string{"https://example.com/1.mp3", "https://example.com/2.mkv"}) {
+		t.Error("a playlist with a video is audio")
+	}
+	if allAudioURLs(nil) {
+		t.Error("an empty playlist is audio")
+	}
+}
+
+func TestAudioModeArgs(t *testing.T) {
+	mpv, readMpvArgs := fakeExecutable(t)
+	items := []PlaylistItem{{URL: "https://music.youtube.com/watch?v=abc"}}
+	args := startFake(t, newMpvBackend(mpv, PlayerSettings{Screen: 2}, t.TempDir()), readMpvArgs, items, 0, StreamOptions{Audio: true})
+	for _, want := range []string{"--no-video", "--force-window=no", "--ytdl-format=bestaudio/best"} {
+		if !containsRun(args, []string{want}) {
+			t.Errorf("mpv args %q lack %q", args, want)
+		}
+	}
+	for _, arg := range args {
+		if arg == "--fullscreen" || strings.HasPrefix(arg, "--screen=") {
+			t.Errorf("audio mode mpv got %q", arg)
+		}
+	}
+
+	vlc, readVLCArgs := fakeExecutable(t)
+	args = startFake(t, newVLCBackend(vlc, PlayerSettings{}), readVLCArgs, items, 0, StreamOptions{Audio: true})
+	if !containsRun(args, []string{"--no-video"}) || containsRun(args, []string{"--fullscreen"}) {
+		t.Errorf("audio mode vlc args %q", args)
+	}
+}
+
+func TestAudioPlaylistStartsInAudioMode(t *testing.T) {
+	command, _ := fakeExecutable(t)
+	p := NewPlayer(t.TempDir())
+	p.SetEvents(NewEventHub())
+	writeTestProfile(t, p.dataDir, "alice")
+	if err := SavePlayerSettings(p.dataDir, "alice", PlayerSettings{Backend: "command", Command: command}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		urls []string
+		want bool
+	}{
+		{[]string{"https://example.com/1.mp3", "https://example.com/2.flac"}, true},
+		{[]string{"https://example.com/1.mp3", "https://example.com/2.mkv"}, false},
+	} {
+		var items []PlaylistItem
+		for _, u := range tt.urls {
+			items = append(items, PlaylistItem{URL: u})
+		}
+		if err := p.PlayPlaylist(items, 0, "alice", "", StreamOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if got := p.State().Audio; got != tt.want {
+			t.Errorf("%q: audio %v, want %v", tt.urls, got, tt.want)
+		}
+		if got := p.GetStatus()["audio"]; got != tt.want {
+			t.Errorf("%q: status audio %v", tt.urls, got)
+		}
+	}
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// vlcBackend drives VLC through its remote-control (rc) interface on a
+// local TCP port. The rc interface is line based and has no events, so
+// state is polled once a second. It can't tell which playlist item is
+// playing, so per-item onComplete only fires when VLC exits.
+type vlcBackend struct {
+	mu       sync.Mutex
+	vlcPath  string
+	settings PlayerSettings
+	port     int
+	conn     net.Conn
+	reader   *bufio.Reader
+	done     chan struct{}
+	detached bool
+	position float64
+	paused   bool
+	volume   float64 // rc units, 256 == 100%
+	unmuted  float64 // volume to restore after SetMute(false)
+}
+
+func newVLCBackend(vlcPath string, settings PlayerSettings) *vlcBackend {
+	return &vlcBackend{
+		vlcPath:  vlcPath,
+		settings: settings,
+		done:     make(chan struct{}),
+	}
+}
+
+// vlcCandidates lists where VLC is usually installed
+func vlcCandidates() []string {
+	candidates := []string{"vlc"}
+	if runtime.GOOS == "windows" {
+		candidates = append(candidates,
+			`C:\Program Files\VideoLAN\VLC\vlc.exe`,
+			`C:\Program Files (x86)\VideoLAN\VLC\vlc.exe`,
+		)
+	}
+	return candidates
+}
+
+func (v *vlcBackend) Name() string {
+	return "vlc"
+}
+
+// freeLocalPort asks the kernel for an unused TCP port on localhost
+func freeLocalPort() (int, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
+
+func (v *vlcBackend) Start(items []PlaylistItem, startPosition float64, opts StreamOptions) (*exec.Cmd, error) {
+	port, err := freeLocalPort()
+	if err != nil {
+		return nil, err
+	}
+	v.port = port
+
+	args := []string{
+		"--play-and-exit",
+		"--no-video-title-show",
+		"--extraintf=rc",
+		fmt.Sprintf("--rc-host=127.0.0.1:%d", port),
+	}
+	if runtime.GOOS == "windows" {
+		args = append(args, "--rc-quiet")
+	}
+	if opts.Audio {
+		args = append(args, "--no-video")
+	} else {
+		if !v.settings.Windowed {
+			args = append(args, "--fullscreen")
+		}
+		if v.settings.Screen > 0 {
+			// Only honored by the Qt interface, numbered from 0
+			args = append(args, fmt.Sprintf("--qt-fullscreen-screennumber=%d", v.settings.Screen-1))
+		}
+	}
+	if opts.AudioLanguage != "" {
+		args = append(args, "--audio-language="+opts.AudioLanguage)
+	}
+	if opts.SubtitleLanguage != "" {
+		args = append(args, "--sub-language="+opts.SubtitleLanguage)
+	}
+
+	// VLC has no generic header option; Referer and User-Agent are the
+	// only request headers it lets us set
+	var httpArgs []string
+	if opts.UserAgent != "" {
+		httpArgs = append(httpArgs, ":http-user-agent="+opts.UserAgent)
+	}
+	for name, value := range opts.HTTPHeaders() {
+		switch strings.ToLower(name) {
+		case "referer":
+			httpArgs = append(httpArgs, ":http-referrer="+value)
+		case "user-agent":
+			httpArgs = append(httpArgs, ":http-user-agent="+value)
+		default:
+			Log("ExternalPlayer: vlc can't send header %s, ignoring it", name)
+		}
+	}
+
+	// Options starting with ':' apply only to the item before them
+	for i, item := range items {
+		args = append(args, item.URL)
+		if i == 0 && startPosition > 0 {
+			args = append(args, fmt.Sprintf(":start-time=%d", int(startPosition)))
+		}
+		if item.Title != "" {
+			args = append(args, ":meta-title="+item.Title)
+		}
+		// VLC takes a single external subtitle per item
+		if len(item.Subtitles) > 0 {
+			args = append(args, ":sub-file="+item.Subtitles[0])
+		}
+		args = append(args, httpArgs...)
+	}
+
+	Log("ExternalPlayer: Starting vlc at path=%s with args: %v", v.vlcPath, args)
+
+	cmd := exec.Command(v.vlcPath, args...)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+func (v *vlcBackend) Attach(cmd *exec.Cmd, emit func(PlayerEvent)) {
+	addr := fmt.Sprintf("127.0.0.1:%d", v.port)
+	deadline := time.Now().Add(10 * time.Second)
+
+	var conn net.Conn
+	for {
+		var err error
+		conn, err = net.Dial("tcp", addr)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			Log("ExternalPlayer: connect to vlc rc %s: %v", addr, err)
+			return
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	v.mu.Lock()
+	if v.detached {
+		v.mu.Unlock()
+		conn.Close()
+		return
+	}
+	v.conn = conn
+	v.reader = bufio.NewReader(conn)
+	v.mu.Unlock()
+
+	Log("ExternalPlayer: connected to vlc rc at %s", addr)
+
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-v.done:
+			return
+		case <-ticker.C:
+			events, err := v.poll()
+			// Emit without holding v.mu; the receiver takes its own locks
+			for _, ev := range events {
+				emit(ev)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// poll reads time, length and play state from VLC
+func (v *vlcBackend) poll() ([]PlayerEvent, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.conn == nil {
+		return nil, fmt.Errorf("vlc rc not connected")
+	}
+
+	var events []PlayerEvent
+
+	lines, err := v.query("get_time", isVLCNumber)
+	if err != nil {
+		return events, err
+	}
+	if pos, ok := lastVLCNumber(lines); ok {
+		v.position = pos
+		events = append(events, PlayerEvent{Kind: PlayerEventPosition, Value: pos})
+	}
+
+	lines, err = v.query("get_length", isVLCNumber)
+	if err != nil {
+		return events, err
+	}
+	if length, ok := lastVLCNumber(lines); ok && length > 0 {
+		events = append(events, PlayerEvent{Kind: PlayerEventDuration, Value: length})
+	}
+
+	lines, err = v.query("status", func(line string) bool {
+		return strings.Contains(line, "state ")
+	})
+	if err != nil {
+		return events, err
+	}
+	for _, line := range lines {
+		line = strings.Trim(line, "() ")
+		if strings.HasPrefix(line, "audio volume:") {
+			if vol, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimPrefix(line, "audio volume:")), 64); err == nil {
+				v.volume = vol
+				events = append(events, PlayerEvent{Kind: PlayerEventVolume, Value: vol * 100 / 256})
+			}
+		} else if strings.HasPrefix(line, "state ") {
+			v.paused = strings.TrimPrefix(line, "state ") == "paused"
+			events = append(events, PlayerEvent{Kind: PlayerEventPaused, Value: v.paused})
+		}
+	}
+	return events, nil
+}
+
+// query sends an rc command and collects reply lines until done matches one
+// or the reply times out. Must be called with v.mu held.
+func (v *vlcBackend) query(command string, done func(string) bool) ([]string, error) {
+	if _, err := fmt.Fprintf(v.conn, "%s\n", command); err != nil {
+		return nil, err
+	}
+
+	v.conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	defer v.conn.SetReadDeadline(time.Time{})
+
+	var lines []string
+	for {
+		line, err := v.reader.ReadString('\n')
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return lines, nil
+			}
+			return lines, err
+		}
+		// Replies may be preceded by the "> " prompt
+		line = strings.TrimSpace(strings.TrimLeft(line, "> "))
+		if line == "" {
+			continue
+		}
+		lines = append(lines, line)
+		if done(line) {
+			return lines, nil
+		}
+	}
+}
+
+func isVLCNumber(line string) bool {
+	_, err := strconv.ParseFloat(line, 64)
+	return err == nil
+}
+
+func lastVLCNumber(lines []string) (float64, bool) {
+	for i := len(lines) - 1; i >= 0; i-- {
+		if n, err := strconv.ParseFloat(lines[i], 64); err == nil {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// send writes an rc command that has no reply we care about
+func (v *vlcBackend) send(format string, args ...interface{}) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.conn == nil {
+		return fmt.Errorf("vlc rc not connected")
+	}
+	_, err := fmt.Fprintf(v.conn, format+"\n", args...)
+	return err
+}
+
+func (v *vlcBackend) Detach() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if !v.detached {
+		v.detached = true
+		close(v.done)
+	}
+	if v.conn != nil {
+		v.conn.Close()
+		v.conn = nil
+	}
+}
+
+func (v *vlcBackend) Append(item PlaylistItem) error {
+	return v.send("enqueue %s", item.URL)
+}
+
+// Position reads the current time from VLC
+func (v *vlcBackend) Position() float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.conn != nil {
+		if lines, err := v.query("get_time", isVLCNumber); err == nil {
+			if pos, ok := lastVLCNumber(lines); ok {
+				return pos
+			}
+		}
+	}
+	return -1
+}
+
+// Quit tells VLC to quit
+func (v *vlcBackend) Quit() error {
+	return v.send("quit")
+}
+
+func (v *vlcBackend) SetPaused(paused bool) error {
+	v.mu.Lock()
+	current := v.paused
+	v.mu.Unlock()
+
+	if paused == current {
+		return nil
+	}
+	// rc "pause" toggles
+	return v.send("pause")
+}
+
+func (v *vlcBackend) TogglePause() error {
+	return v.send("pause")
+}
+
+func (v *vlcBackend) Seek(seconds float64, relative bool) error {
+	if relative {
+		v.mu.Lock()
+		seconds += v.position
+		v.mu.Unlock()
+	}
+	if seconds < 0 {
+		seconds = 0
+	}
+	return v.send("seek %d", int(seconds))
+}
+
+// SetVolume takes percent and converts to rc units
+func (v *vlcBackend) SetVolume(volume float64) error {
+	return v.send("volume %d", int(volume*256/100))
+}
+
+// SetMute emulates mute, which rc lacks, by zeroing and restoring the volume
+func (v *vlcBackend) SetMute(muted bool) error {
+	v.mu.Lock()
+	if muted {
+		if v.volume > 0 {
+			v.unmuted = v.volume
+		}
+		v.mu.Unlock()
+		return v.send("volume 0")
+	}
+	volume := v.unmuted
+	v.mu.Unlock()
+	if volume <= 0 {
+		volume = 256
+	}
+	return v.send("volume %d", int(volume))
+}
+
+func (v *vlcBackend) Next() error {
+	return v.send("next")
+}
+
+func (v *vlcBackend) Previous() error {
+	return v.send("prev")
+}
+
+func (v *vlcBackend) SetAudioTrack(track interface{}) error {
+	return v.send("atrack %v", track)
+}
+
+func (v *vlcBackend) SetSubtitleTrack(track interface{}) error {
+	if s, ok := track.(string); ok && s == "no" {
+		track = -1
+	}
+	return v.send("strack %v", track)
+}
+
+func (v *vlcBackend) SetSpeed(speed float64) error {
+	return v.send("rate %g", speed)
+}
+
+// ShowText isn't available over the rc interface
+func (v *vlcBackend) ShowText(string, time.Duration) error {
+	return errPlayerUnsupported
+}
+
+func (v *vlcBackend) OfferSkip(string, float64, time.Duration) error {
+	return errPlayerUnsupported
+}
+
+func (v *vlcBackend) ClearSkip() error {
+	return errPlayerUnsupported
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// errUnknownProfile is returned for a profile ID that isn't one of the
+// profiles in profiles/
+var errUnknownProfile = errors.New("unknown profile")
+
+// listProfiles reads every profile in dataDir, in display order
+func listProfiles(dataDir string) []Profile {
+	profilesDir := filepath.Join(dataDir, "profiles")
+	entries, err := os.ReadDir(profilesDir)
+	if err != nil {
+		Log("Failed to read profiles dir: %v", err)
+		return []Profile{}
+	}
+
+	var profiles []Profile
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		profileDir := filepath.Join(profilesDir, entry.Name())
+		profilePath := filepath.Join(profileDir, "profile.json")
+		data, err := os.ReadFile(profilePath)
+		if err != nil {
+			continue
+		}
+
+		var profile Profile
+		if err := json.Unmarshal(data, &profile); err != nil {
+			continue
+		}
+
+		// Convert relative photoPath to embed path (for use with embed= param)
+		if profile.PhotoPath != "" && !filepath.IsAbs(profile.PhotoPath) {
+			profile.PhotoPath = "images/profile-photos/" + profile.PhotoPath
+		}
+
+		profiles = append(profiles, profile)
+	}
+
+	// Sort by order
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Order < profiles[j].Order
+	})
+
+	return profiles
+}
+
+// validProfileID reports whether id can name a directory in profiles/: not
+// empty and a single path element
+func validProfileID(id string) bool {
+	return id != "" && id != "." && !strings.Contains(id, "..") && !strings.ContainsAny(id, `/\:`)
+}
+
+// profileFile returns the path of elem inside the directory of profile id.
+// Profile IDs come in API requests that any web page can make, so every
+// per-profile path is built here: it fails with errUnknownProfile unless id
+// is the ID of an existing profile.
+func profileFile(dataDir, id string, elem ...string) (string, error) {
+	if !validProfileID(id) {
+		return "", errUnknownProfile
+	}
+	for _, p := range listProfiles(dataDir) {
+		if p.ID == id {
+			return filepath.Join(append([]string{dataDir, "profiles", id}, elem...)...), nil
+		}
+	}
+	return "", errUnknownProfile
+}
+
+// knownProfile reports whether id is the ID of an existing profile
+func knownProfile(dataDir, id string) bool {
+	_, err := profileFile(dataDir, id)
+	return err == nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidProfileID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"alice", true},
+		{"kids-room-2", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"../alice", false},
+		{"alice/..", false},
+		{"a/b", false},
+		{`a\b`, false},
+		{"c:", false},
+		{"/etc", false},
+	}
+	for _, tt := range tests {
+		if got := validProfileID(tt.id); got != tt.want {
+			t.Errorf("validProfileID(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestProfileFile(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestProfile(t, dataDir, "alice")
+	// A directory without profile.json isn't a profile
+	os.MkdirAll(filepath.Join(dataDir, "profiles", "stray"), 0755)
+
+	tests := []struct {
+		id      string
+		wantErr bool
+	}{
+		{"alice", false},
+		{"bob", true},
+		{"stray", true},
+		{"", true},
+		{"../profiles/alice", true},
+		{"alice/../../..", true},
+	}
+	for _, tt := range tests {
+		path, err := profileFile(dataDir, tt.id, "player.json")
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("profileFile(%q) = %q, want an error", tt.id, path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("profileFile(%q) failed: %v", tt.id, err)
+		} else if want := filepath.Join(dataDir, "profiles", tt.id, "player.json"); path != want {
+			t.Errorf("profileFile(%q) = %q, want %q", tt.id, path, want)
+		}
+	}
+}
+
+func TestLoadPlayerSettingsUnknownProfile(t *testing.T) {
+	dataDir := t.TempDir()
+	// A player.json outside profiles/ must never be picked up
+	evil := `{"backend":"command","command":"touch pwned"}`
+	os.WriteFile(filepath.Join(dataDir, "player.json"), []byte(evil), 0644)
+
+	settings := LoadPlayerSettings(filepath.Join(dataDir, "data"), "../..")
+	if settings.Backend != "" || settings.Command != "" {
+		t.Errorf("LoadPlayerSettings read settings through a traversal: %+v", settings)
+	}
+	if err := SavePlayerSettings(dataDir, "../..", PlayerSettings{}); err == nil {
+		t.Error("SavePlayerSettings accepted a traversal")
+	}
+}
+
+// writeTestProfile creates profile id in dataDir
+func writeTestProfile(t *testing.T, dataDir, id string) {
+	t.Helper()
+	dir := filepath.Join(dataDir, "profiles", id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(`{"id":"` + id + `","displayName":"` + id + `"}`)
+	if err := os.WriteFile(filepath.Join(dir, "profile.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The phone remote is served on its own listener on the local network, next
+// to the localhost-only API. It listens on this machine's private LAN
+// address only, needs the pairing key from the remote link shown in the
+// launcher's settings, and only reaches the endpoints the remote page uses.
+// Set LAUNCHTUBE_REMOTE=0 to turn it off.
+var remotePorts = []int{8775, 8776, 8777, 8778, 8779}
+
+const remoteCookie = "launchtube_remote"
+
+// remoteLANRoutes are the paths served to the network. Entries ending in /
+// match everything below them.
+var remoteLANRoutes = []string{
+	"/remote",
+	"/api/1/remote/",
+	"/api/1/profiles",
+	"/api/1/apps",
+	"/api/1/image",
+	"/api/1/events",
+	"/api/1/player/status",
+	"/api/1/player/stop",
+	"/api/1/player/pause",
+	"/api/1/player/seek",
+	"/api/1/player/volume",
+	"/api/1/player/next",
+	"/api/1/player/previous",
+	"/api/1/player/skip",
+	"/api/1/browser/status",
+	"/api/1/browser/close",
+	"/api/1/browser/key",
+	"/api/1/browser/click",
+	"/api/1/browser/home",
+	"/api/1/browser/hide",
+}
+
+// A client address that gets the pairing key wrong this many times is
+// turned away until remoteFailureWindow has passed since its first miss
+const (
+	remoteMaxFailures   = 5
+	remoteFailureWindow = 10 * time.Minute
+)
+
+// remoteEventTopics are the /api/1/events topics the remote page follows.
+// Requests from the network get nothing else, whatever ?types= asks for.
+const remoteEventTopics = "player,browser"
+
+// remoteVolumeStep is how much the remote's volume buttons change the volume
+const remoteVolumeStep = 5
+
+func (s *Server) registerRemoteRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/remote", s.handleRemotePage)
+	mux.HandleFunc("/api/1/profiles", s.handleProfiles)
+	mux.HandleFunc("/api/1/apps", s.handleApps)
+	mux.HandleFunc("/api/1/remote/key", s.handleRemoteKey)
+	mux.HandleFunc("/api/1/remote/text", s.handleRemoteText)
+	mux.HandleFunc("/api/1/remote/launch", s.handleRemoteLaunch)
+	mux.HandleFunc("/api/1/remote/home", s.handleRemoteHome)
+}
+
+// startRemote opens the network listener for the phone remote
+func (s *Server) startRemote(mux *http.ServeMux) {
+	if os.Getenv("LAUNCHTUBE_REMOTE") == "0" {
+		Log("Remote: disabled (LAUNCHTUBE_REMOTE=0)")
+		return
+	}
+
+	key, err := s.remoteKey()
+	if err != nil {
+		Log("Remote: can't create pairing key: %v", err)
+		return
+	}
+
+	host := lanAddress()
+	if host == "" {
+		Log("Remote: no private network address, phone remote disabled")
+		return
+	}
+
+	handler := s.remoteAuth(key, remoteOnly(mux))
+	for _, port := range remotePorts {
+		ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			continue
+		}
+		s.remoteHost = host
+		s.remotePort = port
+		s.remoteKeyValue = key
+		// The link carries the key, so only the address goes in the log
+		Log("Remote: serving phone remote on http://%s:%d/remote", host, port)
+		go http.Serve(ln, handler)
+		return
+	}
+	Log("Remote: all ports in use, phone remote disabled")
+}
+
+// remoteKey returns the pairing key, creating it on first use. It is kept
+// so that bookmarked remote links keep working across restarts.
+func (s *Server) remoteKey() (string, error) {
+	path := filepath.Join(s.dataDir, "remote_key")
+	if data, err := os.ReadFile(path); err == nil {
+		if key := strings.TrimSpace(string(data)); key != "" {
+			return key, nil
+		}
+	}
+
+	// Short enough to type from the screen: 8 characters, 40 bits
+	key, err := randomKey(8)
+	if err != nil {
+		return "", err
+	}
+
+	os.MkdirAll(s.dataDir, 0755)
+	if err := os.WriteFile(path, []byte(key), 0600); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// remoteKeyAlphabet leaves out characters that are easy to misread
+const remoteKeyAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// randomKey returns n characters from remoteKeyAlphabet. Random bytes past
+// the largest multiple of the alphabet's size are drawn again, so that
+// every character is equally likely.
+func randomKey(n int) (string, error) {
+	limit := 256 - 256%len(remoteKeyAlphabet)
+	key := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(key) < n {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) < limit && len(key) < n {
+				key = append(key, remoteKeyAlphabet[int(b)%len(remoteKeyAlphabet)])
+			}
+		}
+	}
+	return string(key), nil
+}
+
+// RemoteURL is the link that opens the phone remote, or "" when the remote
+// isn't being served
+func (s *Server) RemoteURL() string {
+	if s.remotePort == 0 {
+		return ""
+	}
+	return fmt.Sprintf("http://%s:%d/remote?key=%s", s.remoteHost, s.remotePort, s.remoteKeyValue)
+}
+
+// lanAddress returns this machine's private IPv4 address: the one it
+// reaches other networks from, or failing that the first private one
+func lanAddress() string {
+	// Connecting a UDP socket sends nothing, it just picks the route
+	if conn, err := net.Dial("udp4", "192.0.2.1:9"); err == nil {
+		ip := conn.LocalAddr().(*net.UDPAddr).IP
+		conn.Close()
+		if ip.IsPrivate() {
+			return ip.String()
+		}
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok {
+			if ip := ipnet.IP.To4(); ip != nil && ip.IsPrivate() {
+				return ip.String()
+			}
+		}
+	}
+	return ""
+}
+
+// remoteThrottle counts wrong pairing keys per client address
+type remoteThrottle struct {
+	mu       sync.Mutex
+	failures map[string]*remoteFailures
+}
+
+type remoteFailures struct {
+	count int
+	first time.Time
+}
+
+func newRemoteThrottle() *remoteThrottle {
+	return &remoteThrottle{failures: make(map[string]*remoteFailures)}
+}
+
+// blocked reports whether ip has used up its attempts
+func (t *remoteThrottle) blocked(ip string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f := t.failures[ip]
+	return f != nil && f.count >= remoteMaxFailures && now.Sub(f.first) < remoteFailureWindow
+}
+
+// fail records a wrong key from ip
+func (t *remoteThrottle) fail(ip string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for addr, f := range t.failures {
+		if now.Sub(f.first) >= remoteFailureWindow {
+			delete(t.failures, addr)
+		}
+	}
+	f := t.failures[ip]
+	if f == nil {
+		f = &remoteFailures{first: now}
+		t.failures[ip] = f
+	}
+	f.count++
+}
+
+// remoteAuth admits requests that carry the pairing key, either as ?key= or
+// in the cookie set the first time the remote link is opened. Clients that
+// keep guessing wrong are turned away for a while.
+func (s *Server) remoteAuth(key string, next http.Handler) http.Handler {
+	throttle := newRemoteThrottle()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		if throttle.blocked(ip, time.Now()) {
+			http.Error(w, "Too many wrong pairing keys, try again later", http.StatusTooManyRequests)
+			return
+		}
+
+		given := r.URL.Query().Get("key")
+		fromLink := given != ""
+		if !fromLink {
+			if c, err := r.Cookie(remoteCookie); err == nil {
+				given = c.Value
+			}
+		}
+
+		if subtle.ConstantTimeCompare([]byte(given), []byte(key)) != 1 {
+			throttle.fail(ip, time.Now())
+			Log("Remote: wrong pairing key from %s", ip)
+			http.Error(w, "Open the remote link shown in LaunchTube's settings", http.StatusUnauthorized)
+			return
+		}
+		if fromLink {
+			http.SetCookie(w, &http.Cookie{
+				Name:     remoteCookie,
+				Value:    given,
+				Path:     "/",
+				MaxAge:   365 * 24 * 60 * 60,
+				HttpOnly: true,
+				SameSite: http.SameSiteStrictMode,
+			})
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// remoteRequestKey marks the context of requests from the network
+type remoteRequestKey struct{}
+
+// isRemoteRequest reports whether r came in on the phone remote's listener
+func isRemoteRequest(r *http.Request) bool {
+	remote, _ := r.Context().Value(remoteRequestKey{}).(bool)
+	return remote
+}
+
+// remoteOnly limits next to remoteLANRoutes
+func remoteOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, route := range remoteLANRoutes {
+			if r.URL.Path == route || (strings.HasSuffix(route, "/") && strings.HasPrefix(r.URL.Path, route)) {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), remoteRequestKey{}, true)))
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+}
+
+func (s *Server) handleRemotePage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	http.ServeFile(w, r, s.findFile("remote.html"))
+}
+
+// handleProfiles lists the profiles. The remote only gets what its profile
+// picker shows.
+func (s *Server) handleProfiles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	profiles := s.GetProfiles()
+	if !isRemoteRequest(r) {
+		json.NewEncoder(w).Encode(profiles)
+		return
+	}
+
+	type remoteProfile struct {
+		ID          string `json:"id"`
+		DisplayName string `json:"displayName"`
+	}
+	list := make([]remoteProfile, 0, len(profiles))
+	for _, p := range profiles {
+		list = append(list, remoteProfile{ID: p.ID, DisplayName: p.DisplayName})
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+func (s *Server) handleApps(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	apps := s.GetAppsForProfile(r.URL.Query().Get("profile"))
+	if apps == nil {
+		apps = []AppConfig{}
+	}
+	json.NewEncoder(w).Encode(apps)
+}
+
+// handleRemoteKey sends a key press to whatever is on screen
+func (s *Server) handleRemoteKey(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Key string `json:"key"`
+	}
+	if !decodePlayerControl(w, r, &req) {
+		return
+	}
+	if req.Key == "" {
+		http.Error(w, `{"error":"key is required"}`, http.StatusBadRequest)
+		return
+	}
+	writeBrowserInputResult(w, s.remoteKeyPress(req.Key))
+}
+
+// remoteKeyPress routes a key from the remote: video playback gets player
+// controls, a running browser gets the key over CDP, and otherwise the
+// launcher gets it as a remote.key event
+func (s *Server) remoteKeyPress(key string) error {
+	state := s.player.State()
+	if state.Playing && !state.Audio {
+		s.sleep.NoteInput()
+		return s.remotePlayerKey(key, state)
+	}
+	if browser := s.ActiveBrowser(); browser.IsRunning() {
+		return browser.SendKeyToPage("", key, "")
+	}
+	s.PublishEvent("remote.key", map[string]string{"key": key})
+	return nil
+}
+
+func (s *Server) remotePlayerKey(key string, state PlayerState) error {
+	switch key {
+	case "Enter", " ", "MediaPlayPause":
+		return s.player.TogglePause()
+	case "ArrowLeft":
+		return s.player.Seek(-10, true)
+	case "ArrowRight":
+		return s.player.Seek(10, true)
+	case "ArrowUp":
+		return s.player.SetVolume(state.Volume + remoteVolumeStep)
+	case "ArrowDown":
+		return s.player.SetVolume(state.Volume - remoteVolumeStep)
+	case "MediaTrackNext", "PageDown":
+		return s.player.Next()
+	case "MediaTrackPrevious", "PageUp":
+		return s.player.Previous()
+	case "Escape":
+		s.player.Stop()
+		return nil
+	}
+	return fmt.Errorf("key %s does nothing in the player", key)
+}
+
+// handleRemoteText types text into the focused field of the browser or the
+// launcher
+func (s *Server) handleRemoteText(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Text string `json:"text"`
+	}
+	if !decodePlayerControl(w, r, &req) {
+		return
+	}
+	if browser := s.ActiveBrowser(); browser.IsRunning() {
+		writeBrowserInputResult(w, browser.TypeText("", req.Text))
+		return
+	}
+	s.PublishEvent("remote.text", map[string]string{"text": req.Text})
+	fmt.Fprintf(w, `{"status":"ok"}`)
+}
+
+// handleRemoteLaunch starts an app of a profile. The launcher does the
+// launching, since it knows the selected browser and manages its window.
+func (s *Server) handleRemoteLaunch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ProfileID string `json:"profileId"`
+		Index     int    `json:"index"`
+	}
+	if !decodePlayerControl(w, r, &req) {
+		return
+	}
+	apps := s.GetAppsForProfile(req.ProfileID)
+	if req.ProfileID == "" || req.Index < 0 || req.Index >= len(apps) {
+		http.Error(w, `{"error":"No such app"}`, http.StatusNotFound)
+		return
+	}
+
+	Log("Remote: launching %s for profile %s", apps[req.Index].Name, req.ProfileID)
+	s.player.Stop()
+	s.ReturnToLauncher()
+	s.PublishEvent("remote.launch", map[string]interface{}{
+		"profileId": req.ProfileID,
+		"index":     req.Index,
+		"name":      apps[req.Index].Name,
+	})
+	fmt.Fprintf(w, `{"status":"ok"}`)
+}
+
+// handleRemoteHome stops whatever is playing and returns to the launcher,
+// leaving a warm browser in the background
+func (s *Server) handleRemoteHome(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "POST" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	s.player.Stop()
+	s.ReturnToLauncher()
+	s.PublishEvent("remote.home", nil)
+	fmt.Fprintf(w, `{"status":"ok"}`)
+}
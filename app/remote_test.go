@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRandomKey(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		key, err := randomKey(8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(key) != 8 {
+			t.Fatalf("randomKey(8) = %q", key)
+		}
+		for _, c := range key {
+			if !strings.ContainsRune(remoteKeyAlphabet, c) {
+				t.Fatalf("randomKey(8) = %q, %q isn't in the alphabet", key, c)
+			}
+		}
+		if seen[key] {
+			t.Fatalf("randomKey(8) repeated %q", key)
+		}
+		seen[key] = true
+	}
+}
+
+func TestRemoteThrottle(t *testing.T) {
+	th := newRemoteThrottle()
+	start := time.Now()
+
+	for i := 0; i < remoteMaxFailures; i++ {
+		if th.blocked("192.168.1.20", start) {
+			t.Fatalf("blocked after %d failures", i)
+		}
+		th.fail("192.168.1.20", start)
+	}
+	if !th.blocked("192.168.1.20", start.Add(time.Minute)) {
+		t.Error("not blocked after too many failures")
+	}
+	if th.blocked("192.168.1.21", start.Add(time.Minute)) {
+		t.Error("another address is blocked too")
+	}
+	if th.blocked("192.168.1.20", start.Add(remoteFailureWindow)) {
+		t.Error("still blocked after the window")
+	}
+}
+
+func TestRemoteProfilesAreTrimmed(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestProfile(t, dataDir, "alice")
+	s := &Server{dataDir: dataDir}
+	handler := remoteOnly(http.HandlerFunc(s.handleProfiles))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/1/profiles", nil))
+	var profiles []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &profiles); err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 1 || len(profiles[0]) != 2 || profiles[0]["id"] != "alice" {
+		t.Errorf("remote got %v", profiles)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/1/history", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("remote reached /api/1/history: %d", w.Code)
+	}
+}
@@ -2,8 +2,6 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -13,25 +11,23 @@ import (
 	"strings"
 	"sync"
 	"time"
-
-	"github.com/gorilla/websocket"
 )
 
 // ScreensaverInhibitor manages xscreensaver inhibition based on video playback
 type ScreensaverInhibitor struct {
 	mu            sync.Mutex
 	player        *Player
-	browserMgr    *BrowserManager
+	browser       func() Browser // the active browser
 	ticker        *time.Ticker
 	stopChan      chan struct{}
 	checkInterval time.Duration
 	isNativeLinux *bool
 }
 
-func NewScreensaverInhibitor(player *Player, browserMgr *BrowserManager) *ScreensaverInhibitor {
+func NewScreensaverInhibitor(player *Player, browser func() Browser) *ScreensaverInhibitor {
 	return &ScreensaverInhibitor{
 		player:        player,
-		browserMgr:    browserMgr,
+		browser:       browser,
 		checkInterval: 60 * time.Second, // Default, will be updated from config
 	}
 }
@@ -148,105 +144,45 @@ func (s *ScreensaverInhibitor) checkAndUpdate() {
 }
 
 func (s *ScreensaverInhibitor) isVideoPlaying() bool {
-	// Check mpv player first
+	// Check mpv player first. Music doesn't keep the screen on; the
+	// screensaver may as well come up over the now-playing screen.
 	if s.player != nil {
-		status := s.player.GetStatus()
-		if playing, ok := status["playing"].(bool); ok && playing {
-			if paused, ok := status["paused"].(bool); ok && !paused {
-				return true
-			}
+		state := s.player.State()
+		if state.Playing && !state.Paused && !state.Audio {
+			return true
 		}
 	}
 
-	// Check browser for fullscreen video via CDP
-	if s.browserMgr != nil && s.browserMgr.IsRunning() {
-		if s.checkBrowserVideoPlaying() {
-			return true
+	// Check browser for fullscreen video
+	if s.browser != nil {
+		if browser := s.browser(); browser.IsRunning() {
+			return s.checkPageForVideo(browser)
 		}
 	}
 
 	return false
 }
 
-func (s *ScreensaverInhibitor) checkBrowserVideoPlaying() bool {
-	// Get CDP targets
-	resp, err := http.Get("http://localhost:9222/json")
-	if err != nil {
-		return false
-	}
-	defer resp.Body.Close()
-
-	var targets []struct {
-		ID                   string `json:"id"`
-		Type                 string `json:"type"`
-		WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&targets); err != nil {
-		return false
-	}
-
-	// Check each page target for fullscreen video
-	for _, t := range targets {
-		if t.Type == "page" && t.WebSocketDebuggerURL != "" {
-			if s.checkPageForVideo(t.WebSocketDebuggerURL) {
-				return true
+func (s *ScreensaverInhibitor) checkPageForVideo(browser Browser) bool {
+	// Only inhibit if there's a playing video AND we're in fullscreen. The
+	// fullscreen tab is the current one.
+	value, err := browser.Evaluate("", `(function() {
+		if (!document.fullscreenElement) {
+			return false;
+		}
+		const videos = document.querySelectorAll('video');
+		for (const v of videos) {
+			if (!v.paused && !v.ended && v.readyState > 2) {
+				return true;
 			}
 		}
-	}
-
-	return false
-}
-
-func (s *ScreensaverInhibitor) checkPageForVideo(wsURL string) bool {
-	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		return false;
+	})()`)
 	if err != nil {
 		return false
 	}
-	defer conn.Close()
-
-	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
-	conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
-
-	// Query for playing fullscreen video
-	cmd := map[string]interface{}{
-		"id":     1,
-		"method": "Runtime.evaluate",
-		"params": map[string]interface{}{
-			"expression": `(function() {
-				// Only inhibit if there's a playing video AND we're in fullscreen
-				if (!document.fullscreenElement) {
-					return false;
-				}
-				const videos = document.querySelectorAll('video');
-				for (const v of videos) {
-					if (!v.paused && !v.ended && v.readyState > 2) {
-						return true;
-					}
-				}
-				return false;
-			})()`,
-			"returnByValue": true,
-		},
-	}
-
-	if err := conn.WriteJSON(cmd); err != nil {
-		return false
-	}
-
-	var response struct {
-		ID     int `json:"id"`
-		Result struct {
-			Result struct {
-				Value interface{} `json:"value"`
-			} `json:"result"`
-		} `json:"result"`
-	}
-
-	if err := conn.ReadJSON(&response); err != nil {
-		return false
-	}
 
-	if result, ok := response.Result.Result.Value.(bool); ok {
+	if result, ok := value.(bool); ok {
 		return result
 	}
 
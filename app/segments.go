@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Segment is a labelled stretch of an item that can be skipped, such as an
+// intro, recap or credits, as reported by the media server
+type Segment struct {
+	Label string  `json:"label"`
+	Start float64 `json:"start"` // seconds
+	End   float64 `json:"end"`   // seconds
+}
+
+// How segments are handled, from the profile's SkipSegments setting
+const (
+	segmentSkipPrompt = "prompt" // offer a skip on the OSD (default)
+	segmentSkipAuto   = "auto"   // seek past the segment straight away
+	segmentSkipOff    = "off"    // play segments like anything else
+)
+
+// resetSegments forgets the segment state of the previous item. Must be
+// called with p.mu held.
+func (p *Player) resetSegments() {
+	if p.segmentPos >= 0 && p.segmentMode == segmentSkipPrompt && p.backend != nil {
+		go p.backend.ClearSkip()
+	}
+	p.segmentPos = -1
+	p.segmentsSeen = make(map[int]bool)
+	p.skippedSegments = nil
+}
+
+// currentSegments returns the segments of the current item. Must be called
+// with p.mu held.
+func (p *Player) currentSegments() []Segment {
+	if p.playlistPos >= len(p.playlist) {
+		return nil
+	}
+	return p.playlist[p.playlistPos].Segments
+}
+
+// checkSegments acts on the position moving into or out of a segment. prev
+// is the position before this update; jumping from inside a segment to its
+// end counts as skipping it, whether the skip came from us, the OSD prompt
+// or a seek. Each segment is acted on once, so seeking back into one plays
+// it. Must be called with p.mu held; backend calls are made asynchronously.
+func (p *Player) checkSegments(prev float64) {
+	if p.segmentMode == segmentSkipOff {
+		return
+	}
+	segments := p.currentSegments()
+
+	if p.segmentPos >= 0 && p.segmentPos < len(segments) {
+		seg := segments[p.segmentPos]
+		if p.position >= seg.Start && p.position < seg.End {
+			return
+		}
+		if p.position >= seg.End-0.5 && prev < seg.End-2 {
+			Log("ExternalPlayer: skipped %s segment %.1f-%.1f", seg.Label, seg.Start, seg.End)
+			p.skippedSegments = append(p.skippedSegments, seg)
+			p.publishWith("player.segment-skipped", map[string]interface{}{"segment": seg})
+		}
+		p.segmentPos = -1
+		if p.segmentMode == segmentSkipPrompt {
+			go p.backend.ClearSkip()
+		}
+	}
+
+	for i, seg := range segments {
+		if p.segmentsSeen[i] || p.position < seg.Start || p.position >= seg.End {
+			continue
+		}
+		p.segmentsSeen[i] = true
+		p.segmentPos = i
+		p.publishWith("player.segment", map[string]interface{}{"segment": seg, "mode": p.segmentMode})
+
+		backend := p.backend
+		switch p.segmentMode {
+		case segmentSkipAuto:
+			Log("ExternalPlayer: skipping %s segment to %.1f", seg.Label, seg.End)
+			go backend.Seek(seg.End, false)
+		default:
+			prompt := fmt.Sprintf("Skip %s? Press Enter", segmentLabel(seg))
+			duration := time.Duration((seg.End - p.position) * float64(time.Second))
+			go func() {
+				if err := backend.OfferSkip(prompt, seg.End, duration); err != nil {
+					Log("ExternalPlayer: can't offer skip: %v", err)
+				}
+			}()
+		}
+		return
+	}
+}
+
+func segmentLabel(seg Segment) string {
+	if seg.Label == "" {
+		return "segment"
+	}
+	return strings.ToLower(seg.Label)
+}
+
+// SkipSegment seeks past the segment currently playing
+func (p *Player) SkipSegment() error {
+	p.mu.Lock()
+	if p.cmd == nil || p.backend == nil {
+		p.mu.Unlock()
+		return fmt.Errorf("player not running")
+	}
+	segments := p.currentSegments()
+	if p.segmentPos < 0 || p.segmentPos >= len(segments) {
+		p.mu.Unlock()
+		return fmt.Errorf("no segment to skip")
+	}
+	backend, target := p.backend, segments[p.segmentPos].End
+	p.mu.Unlock()
+
+	return backend.Seek(target, false)
+}
+
+// activeSegment returns the segment currently playing, if any. Must be
+// called with p.mu held.
+func (p *Player) activeSegment() *Segment {
+	segments := p.currentSegments()
+	if p.segmentPos < 0 || p.segmentPos >= len(segments) {
+		return nil
+	}
+	seg := segments[p.segmentPos]
+	return &seg
+}
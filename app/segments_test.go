@@ -0,0 +1,107 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// waitCalls waits for n controls, which segments send asynchronously, and
+// returns them
+func waitCalls(t *testing.T, f *fakeBackend, n int) []string {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		f.mu.Lock()
+		got := len(f.calls)
+		f.mu.Unlock()
+		if got >= n {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return f.Calls()
+}
+
+func newSegmentPlayer(t *testing.T, mode string) (*Player, *fakeBackend, func(float64)) {
+	p, backend := newTestPlayer(t, []PlaylistItem{{
+		URL: "https://example.com/1.mkv",
+		Segments: []Segment{
+			{Label: "Intro", Start: 10, End: 40},
+			{Label: "Credits", Start: 500, End: 600},
+		},
+	}})
+	p.mu.Lock()
+	p.resetSegments()
+	p.segmentMode = mode
+	p.mu.Unlock()
+	return p, backend, func(position float64) {
+		p.handleEvent(backend, PlayerEvent{Kind: PlayerEventPosition, Value: position})
+	}
+}
+
+func TestSegmentSkipPrompt(t *testing.T) {
+	p, backend, moveTo := newSegmentPlayer(t, segmentSkipPrompt)
+
+	moveTo(5)
+	moveTo(12)
+	want := []string{"offer Skip intro? Press Enter 40"}
+	if got := waitCalls(t, backend, 1); !reflect.DeepEqual(got, want) {
+		t.Errorf("entering the intro sent %q, want %q", got, want)
+	}
+
+	// Jumping to the end is a skip; the offer is withdrawn
+	moveTo(40.2)
+	if got := waitCalls(t, backend, 1); !reflect.DeepEqual(got, []string{"clear"}) {
+		t.Errorf("leaving the intro sent %q", got)
+	}
+	if len(p.skippedSegments) != 1 || p.skippedSegments[0].Label != "Intro" {
+		t.Errorf("skipped %+v", p.skippedSegments)
+	}
+
+	// Seeking back into a segment plays it
+	moveTo(20)
+	if err := p.SkipSegment(); err == nil {
+		t.Error("skipped a segment that was already offered")
+	}
+
+	moveTo(510)
+	waitCalls(t, backend, 1)
+	if err := p.SkipSegment(); err != nil {
+		t.Fatal(err)
+	}
+	if got := backend.Calls(); !reflect.DeepEqual(got, []string{"seek 600 false"}) {
+		t.Errorf("SkipSegment sent %q", got)
+	}
+}
+
+func TestSegmentPlayedThroughIsNotSkipped(t *testing.T) {
+	p, backend, moveTo := newSegmentPlayer(t, segmentSkipPrompt)
+	for _, position := range []float64{11, 20, 30, 39, 40.5} {
+		moveTo(position)
+	}
+	waitCalls(t, backend, 2)
+	if len(p.skippedSegments) != 0 {
+		t.Errorf("skipped %+v", p.skippedSegments)
+	}
+}
+
+func TestSegmentSkipAuto(t *testing.T) {
+	_, backend, moveTo := newSegmentPlayer(t, segmentSkipAuto)
+	moveTo(12)
+	if got := waitCalls(t, backend, 1); !reflect.DeepEqual(got, []string{"seek 40 false"}) {
+		t.Errorf("auto skip sent %q", got)
+	}
+}
+
+func TestSegmentSkipOff(t *testing.T) {
+	p, backend, moveTo := newSegmentPlayer(t, segmentSkipOff)
+	moveTo(12)
+	moveTo(510)
+	time.Sleep(50 * time.Millisecond)
+	if got := backend.Calls(); got != nil {
+		t.Errorf("segments off sent %q", got)
+	}
+	if err := p.SkipSegment(); err == nil {
+		t.Error("SkipSegment with segments off")
+	}
+}
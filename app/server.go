@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -10,6 +11,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -30,31 +32,47 @@ type Server struct {
 	dataDir               string
 	kvStore               *KVStore
 	player                *Player
+	history               *WatchHistory
+	callbacks             *CallbackQueue
+	events                *EventHub
+	mpris                 *MPRIS
+	sleep                 *SleepTimer
 	fileCache             *FileCache
 	apps                  []AppConfig
 	appsMu                sync.RWMutex
 	appsProfile           string
 	appsLoadTime          time.Time
-	browserMgr            *BrowserManager
-	cdpBrowser            *CDPBrowser
-	useCDP                bool // Use CDP-based browser instead of extension-based
+	browserMgr            *BrowserManager // extension mode
+	cdpBrowser            *CDPBrowser     // CDP mode
+	browser               Browser         // whichever the last app was launched in
+	browserMu             sync.Mutex
+	browserMode           string      // mode for apps that don't pick one
+	browserHome           string      // start page of the running app
+	browserApp            AppConfig   // the running app, for the watchdog
+	browserName           string
+	kiosk                 *KioskGuard // lockdown of the running app, if any
 	activeProfile         string
 	onBrowserExit         func()
+	onBrowserHidden       func()
 	onShutdown            func()
 	screensaverInhibitor  *ScreensaverInhibitor
+	remoteHost            string // private address the phone remote listens on
+	remotePort            int    // phone remote listener, 0 when not serving
+	remoteKeyValue        string // pairing key for the phone remote
 }
 
 type AppConfig struct {
-	Name        string   `json:"name"`
-	URL         string   `json:"url,omitempty"`
-	MatchURLs   []string `json:"matchUrls,omitempty"`
-	CommandLine string   `json:"commandLine,omitempty"`
-	Type        int      `json:"type"`
-	ImagePath   string   `json:"imagePath,omitempty"`
-	ColorValue  int      `json:"colorValue"`
-	ShowName    bool     `json:"showName"`
-	FocusAlert  bool     `json:"focusAlert,omitempty"`
-	ServiceID   string   `json:"serviceId,omitempty"`
+	Name        string          `json:"name"`
+	URL         string          `json:"url,omitempty"`
+	MatchURLs   []string        `json:"matchUrls,omitempty"`
+	CommandLine string          `json:"commandLine,omitempty"`
+	Type        int             `json:"type"`
+	ImagePath   string          `json:"imagePath,omitempty"`
+	ColorValue  int             `json:"colorValue"`
+	ShowName    bool            `json:"showName"`
+	FocusAlert  bool            `json:"focusAlert,omitempty"`
+	ServiceID   string          `json:"serviceId,omitempty"`
+	Browser     *BrowserOptions `json:"browser,omitempty"`
 }
 
 func NewServer() *Server {
@@ -71,10 +89,20 @@ func NewServer() *Server {
 	}
 
 	// Extension mode is default (CDP triggers bot detection on YouTube etc)
-	useCDP := os.Getenv("LAUNCHTUBE_USE_CDP") == "1"
+	browserMode := browserModeExtension
+	if os.Getenv("LAUNCHTUBE_USE_CDP") == "1" {
+		browserMode = browserModeCDP
+	}
 
+	history := NewWatchHistory(dataDir)
+	callbacks := NewCallbackQueue(dataDir)
 	player := NewPlayer(dataDir)
+	player.SetHistory(history)
+	player.SetCallbackQueue(callbacks)
+	events := NewEventHub()
+	player.SetEvents(events)
 	browserMgr := NewBrowserManager(overridesDir, assetDir, dataDir)
+	cdpBrowser := NewCDPBrowser(assetDir, dataDir, 0) // port set by Start
 
 	s := &Server{
 		assetDir:     assetDir,
@@ -82,37 +110,94 @@ func NewServer() *Server {
 		dataDir:      dataDir,
 		kvStore:    NewKVStore(),
 		player:     player,
+		history:    history,
+		callbacks:  callbacks,
+		events:     events,
 		fileCache:  NewFileCache(),
-		browserMgr: browserMgr, // Kept as fallback
-		useCDP:     useCDP,
-		screensaverInhibitor: NewScreensaverInhibitor(player, browserMgr),
+		browserMgr: browserMgr,
+		cdpBrowser: cdpBrowser,
+		browser:    browserMgr,
+		browserMode: browserMode,
 	}
+	s.screensaverInhibitor = NewScreensaverInhibitor(player, s.ActiveBrowser)
+	cdpBrowser.SetGetScript(s.GetServiceScript)
+	browserMgr.SetOnHang(s.onBrowserHang)
 
-	if useCDP {
-		Log("Using CDP-based browser (set LAUNCHTUBE_USE_CDP=1)")
+	if browserMode == browserModeCDP {
+		Log("Using CDP-based browser by default (set LAUNCHTUBE_USE_CDP=1)")
 	} else {
-		Log("Using extension-based browser")
+		Log("Using extension-based browser by default")
 	}
 
 	// Start screensaver inhibitor
 	s.screensaverInhibitor.Start()
 
+	s.sleep = NewSleepTimer(player, events, dataDir, s.CloseBrowser)
+
+	// Media keys and "now playing" widgets on Linux desktops
+	if runtime.GOOS == "linux" && !isWSL() {
+		s.mpris = StartMPRIS(player, events)
+	}
+
 	return s
 }
 
 func (s *Server) SetOnBrowserExit(fn func()) {
-	s.onBrowserExit = fn
-	s.browserMgr.SetOnExit(fn)
+	s.onBrowserExit = func() {
+		s.events.Publish("browser.exited", nil)
+		if fn != nil {
+			fn()
+		}
+	}
+	s.browserMgr.SetOnExit(s.onBrowserExit)
+	s.cdpBrowser.SetOnExit(s.onBrowserExit)
+}
+
+// SetOnBrowserHidden sets a function called when the browser is put away
+// without closing it, see ReturnToLauncher
+func (s *Server) SetOnBrowserHidden(fn func()) {
+	s.onBrowserHidden = fn
+}
+
+// PublishEvent sends an event to /api/1/events subscribers
+func (s *Server) PublishEvent(eventType string, data interface{}) {
+	s.events.Publish(eventType, data)
 }
 
 func (s *Server) SetOnPlayerExit(fn func()) {
 	s.player.SetOnExit(fn)
 }
 
+// SetOnAudioStarted sets a function called when audio-only playback starts
+func (s *Server) SetOnAudioStarted(fn func()) {
+	events, _ := s.events.Subscribe()
+	go func() {
+		for ev := range events {
+			if ev.Type != "player.started" {
+				continue
+			}
+			if data, ok := ev.Data.(map[string]interface{}); ok && data["audio"] == true {
+				fn()
+			}
+		}
+	}()
+}
+
 func (s *Server) SetOnShutdown(fn func()) {
 	s.onShutdown = fn
 }
 
+// Close stops the server's background work when the app exits, saving
+// anything still waiting to be sent
+func (s *Server) Close() {
+	s.callbacks.Close()
+}
+
+// GetProfiles returns all user profiles, in display order
+func (s *Server) GetProfiles() []Profile {
+	return listProfiles(s.dataDir)
+}
+
 func (s *Server) GetAppsForProfile(profileID string) []AppConfig {
 	if profileID == "" {
 		// Use active profile if no profile specified
@@ -134,7 +219,11 @@ func (s *Server) GetAppsForProfile(profileID string) []AppConfig {
 	}
 	s.appsMu.RUnlock()
 
-	appsPath := filepath.Join(s.dataDir, "profiles", profileID, "apps.json")
+	appsPath, err := profileFile(s.dataDir, profileID, "apps.json")
+	if err != nil {
+		Log("Failed to load apps for profile %s: %v", profileID, err)
+		return nil
+	}
 	data, err := os.ReadFile(appsPath)
 	if err != nil {
 		Log("Failed to load apps for profile %s: %v", profileID, err)
@@ -188,9 +277,11 @@ func (s *Server) Start() error {
 			continue
 		}
 		s.port = port
+		s.cdpBrowser.SetServerPort(port)
 		log.Printf("LaunchTube API server running on port %d", port)
 
 		go http.Serve(ln, s.corsMiddleware(mux))
+		s.startRemote(mux)
 		return nil
 	}
 	return fmt.Errorf("failed to start server - all ports in use")
@@ -200,8 +291,22 @@ func (s *Server) GetPort() int {
 	return s.port
 }
 
+// localOnlyPaths get no CORS headers, so web pages can't call them; their
+// handlers also refuse requests that crossOrigin catches. Managed policy can
+// install extensions, and browser input would let any page drive the apps.
+var localOnlyPaths = map[string]bool{
+	"/api/1/browser/policy": true,
+	"/api/1/browser/key":    true,
+	"/api/1/browser/click":  true,
+}
+
 func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if localOnlyPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "*")
@@ -216,6 +321,38 @@ func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// crossOrigin reports whether r must be refused by the localOnlyPaths: it
+// comes from a web page other than the API's own, or its Host isn't this
+// server, as with a page that rebinds its own domain to 127.0.0.1. Browsers
+// send Origin with every PUT, and fetch metadata with most requests; local
+// tools like curl send neither.
+func (s *Server) crossOrigin(r *http.Request) bool {
+	if !s.ownHost(r.Host) {
+		return true
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		return origin != "http://"+r.Host
+	}
+	site := r.Header.Get("Sec-Fetch-Site")
+	return site != "" && site != "same-origin" && site != "none"
+}
+
+// ownHost reports whether host, a request's Host header, names this server:
+// 127.0.0.1 or localhost on the API port, or the phone remote's address
+func (s *Server) ownHost(host string) bool {
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return false
+	}
+	switch {
+	case port == strconv.Itoa(s.port):
+		return name == "127.0.0.1" || strings.EqualFold(name, "localhost")
+	case s.remotePort != 0 && port == strconv.Itoa(s.remotePort):
+		return name == s.remoteHost
+	}
+	return false
+}
+
 func (s *Server) registerRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/1/ping", s.handlePing)
 	mux.HandleFunc("/api/1/version", s.handleVersion)
@@ -226,10 +363,30 @@ func (s *Server) registerRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/1/kv/", s.handleKV)
 	mux.HandleFunc("/api/1/player/play", s.handlePlayerPlay)
 	mux.HandleFunc("/api/1/player/playlist", s.handlePlayerPlaylist)
+	mux.HandleFunc("/api/1/player/queue", s.handlePlayerQueue)
 	mux.HandleFunc("/api/1/player/status", s.handlePlayerStatus)
 	mux.HandleFunc("/api/1/player/stop", s.handlePlayerStop)
+	mux.HandleFunc("/api/1/player/pause", s.handlePlayerPause)
+	mux.HandleFunc("/api/1/player/seek", s.handlePlayerSeek)
+	mux.HandleFunc("/api/1/player/volume", s.handlePlayerVolume)
+	mux.HandleFunc("/api/1/player/next", s.handlePlayerNext)
+	mux.HandleFunc("/api/1/player/previous", s.handlePlayerPrevious)
+	mux.HandleFunc("/api/1/player/audio", s.handlePlayerAudioTrack)
+	mux.HandleFunc("/api/1/player/subtitle", s.handlePlayerSubtitleTrack)
+	mux.HandleFunc("/api/1/player/speed", s.handlePlayerSpeed)
+	mux.HandleFunc("/api/1/player/skip", s.handlePlayerSkip)
+	mux.HandleFunc("/api/1/history", s.handleHistory)
+	mux.HandleFunc("/api/1/callbacks", s.handleCallbacks)
+	mux.HandleFunc("/api/1/sleep", s.handleSleep)
+	mux.HandleFunc("/api/1/events", s.handleEvents)
 	mux.HandleFunc("/api/1/browser/close", s.handleBrowserClose)
 	mux.HandleFunc("/api/1/browser/status", s.handleBrowserStatus)
+	mux.HandleFunc("/api/1/browser/key", s.handleBrowserKey)
+	mux.HandleFunc("/api/1/browser/click", s.handleBrowserClick)
+	mux.HandleFunc("/api/1/browser/home", s.handleBrowserHome)
+	mux.HandleFunc("/api/1/browser/hide", s.handleBrowserHide)
+	mux.HandleFunc("/api/1/browser/policy", s.handleBrowserPolicy)
+	mux.HandleFunc("/api/1/kiosk", s.handleKiosk)
 	mux.HandleFunc("/api/1/browsers", s.handleBrowsersList)
 	mux.HandleFunc("/api/1/detect-extensions", s.handleDetectExtensions)
 	mux.HandleFunc("/api/1/userscript", s.handleUserscript)
@@ -244,6 +401,7 @@ func (s *Server) registerRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/1/services", s.handleServiceLibrary)
 	mux.HandleFunc("/api/1/shutdown", s.handleShutdown)
 	mux.HandleFunc("/youtube-loader", s.handleYouTubeLoader)
+	s.registerRemoteRoutes(mux)
 }
 
 func (s *Server) handleYouTubeLoader(w http.ResponseWriter, r *http.Request) {
@@ -447,7 +605,13 @@ func (s *Server) serveServiceScript(w http.ResponseWriter, serviceID, requestedV
 		return
 	}
 
-	versionedScript := fmt.Sprintf("window.LAUNCH_TUBE_VERSION = \"%s\";\n%s", version, string(content))
+	// Shared helpers (player events and the like) go ahead of the script
+	helpers, err := os.ReadFile(s.findFile("service-helpers.js"))
+	if err != nil {
+		Log("Failed to read service helpers: %v", err)
+	}
+
+	versionedScript := fmt.Sprintf("window.LAUNCH_TUBE_VERSION = \"%s\";\n%s\n%s", version, string(helpers), string(content))
 
 	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -596,14 +760,7 @@ func (s *Server) handlePlayerPlay(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req struct {
-		URL           string                 `json:"url"`
-		Title         string                 `json:"title"`
-		StartPosition float64                `json:"startPosition"`
-		OnComplete    map[string]interface{} `json:"onComplete"`
-		OnProgress    map[string]interface{} `json:"onProgress"`
-	}
-
+	var req PlayRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		Log("handlePlayerPlay: decode error: %v", err)
 		w.Header().Set("Content-Type", "application/json")
@@ -611,16 +768,38 @@ func (s *Server) handlePlayerPlay(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	Log("handlePlayerPlay: url=%s title=%s start=%.1f", req.URL, req.Title, req.StartPosition)
-
 	if req.URL == "" {
 		w.Header().Set("Content-Type", "application/json")
 		http.Error(w, `{"error":"url is required"}`, http.StatusBadRequest)
 		return
 	}
 
+	if req.ProfileID == "" {
+		req.ProfileID = s.activeProfile
+	}
+	if req.ProfileID != "" && !knownProfile(s.dataDir, req.ProfileID) {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error":"Unknown profile"}`, http.StatusBadRequest)
+		return
+	}
+
+	// Resume from our own history only when asked to; the saved position
+	// goes back either way so the caller can offer it
+	savedPosition := s.history.ResumePosition(req.ProfileID, req.ItemID, req.URL)
+	resumed := false
+	if req.StartPosition == nil && req.Resume && savedPosition > 0 {
+		req.StartPosition = &savedPosition
+		resumed = true
+	}
+	startPosition := 0.0
+	if req.StartPosition != nil {
+		startPosition = *req.StartPosition
+	}
+
+	Log("handlePlayerPlay: url=%s title=%s start=%.1f resumed=%v", req.URL, req.Title, startPosition, resumed)
+
 	Log("handlePlayerPlay: calling player.Play()")
-	err := s.player.Play(req.URL, req.Title, req.StartPosition, req.OnComplete, req.OnProgress)
+	err := s.player.Play(req)
 	if err != nil {
 		Log("handlePlayerPlay: player.Play() returned error: %v", err)
 		w.Header().Set("Content-Type", "application/json")
@@ -630,7 +809,18 @@ func (s *Server) handlePlayerPlay(w http.ResponseWriter, r *http.Request) {
 
 	Log("handlePlayerPlay: success, sending response")
 	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"status":"playing","position":%.1f}`, req.StartPosition)
+	fmt.Fprintf(w, `{"status":"playing","position":%.1f,"resumed":%v,"savedPosition":%.1f}`, startPosition, resumed, savedPosition)
+}
+
+// playlistRequest is the body of /api/1/player/playlist and /api/1/player/queue.
+// StartPosition and Resume apply to the first item, as for PlayRequest.
+type playlistRequest struct {
+	Items         []PlaylistItem `json:"items"`
+	StartPosition float64        `json:"startPosition"`
+	Resume        bool           `json:"resume,omitempty"`
+	ProfileID     string         `json:"profileId"`
+	Service       string         `json:"service"`
+	StreamOptions
 }
 
 func (s *Server) handlePlayerPlaylist(w http.ResponseWriter, r *http.Request) {
@@ -639,15 +829,7 @@ func (s *Server) handlePlayerPlaylist(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req struct {
-		Items []struct {
-			URL        string                 `json:"url"`
-			ItemID     string                 `json:"itemId"`
-			OnComplete map[string]interface{} `json:"onComplete"`
-		} `json:"items"`
-		StartPosition float64 `json:"startPosition"`
-	}
-
+	var req playlistRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		http.Error(w, `{"error":"Invalid request"}`, http.StatusBadRequest)
@@ -660,16 +842,17 @@ func (s *Server) handlePlayerPlaylist(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	items := make([]PlaylistItem, len(req.Items))
-	for i, item := range req.Items {
-		items[i] = PlaylistItem{
-			URL:        item.URL,
-			ItemID:     item.ItemID,
-			OnComplete: item.OnComplete,
-		}
+	if req.ProfileID == "" {
+		req.ProfileID = s.activeProfile
+	}
+	if req.ProfileID != "" && !knownProfile(s.dataDir, req.ProfileID) {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error":"Unknown profile"}`, http.StatusBadRequest)
+		return
 	}
 
-	err := s.player.PlayPlaylist(items, req.StartPosition)
+	savedPosition, resumed := s.resumePlaylist(&req)
+	err := s.player.PlayPlaylist(req.Items, req.StartPosition, req.ProfileID, req.Service, req.StreamOptions)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
@@ -677,7 +860,74 @@ func (s *Server) handlePlayerPlaylist(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"status":"playing","count":%d}`, len(items))
+	fmt.Fprintf(w, `{"status":"playing","count":%d,"resumed":%v,"savedPosition":%.1f}`, len(req.Items), resumed, savedPosition)
+}
+
+// resumePlaylist looks up the first item of a playlist in watch history,
+// starting it from there if the request asks to resume and gives no start
+// position. It returns the saved position and whether it was used.
+func (s *Server) resumePlaylist(req *playlistRequest) (float64, bool) {
+	savedPosition := s.history.ResumePosition(req.ProfileID, req.Items[0].ItemID, req.Items[0].URL)
+	if req.StartPosition != 0 || !req.Resume || savedPosition == 0 {
+		return savedPosition, false
+	}
+	req.StartPosition = savedPosition
+	return savedPosition, true
+}
+
+// handlePlayerQueue is the play queue. GET lists it with the index playing;
+// POST appends items to the running playlist, or starts playing them if
+// nothing is running.
+func (s *Server) handlePlayerQueue(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		items, index := s.player.Queue()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"items":         items,
+			"playlistIndex": index,
+		})
+
+	case "POST":
+		var req playlistRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error":"Invalid request"}`, http.StatusBadRequest)
+			return
+		}
+		if len(req.Items) == 0 {
+			http.Error(w, `{"error":"items array is required"}`, http.StatusBadRequest)
+			return
+		}
+
+		if s.player.State().Playing {
+			if err := s.player.Enqueue(req.Items); err != nil {
+				errJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
+				http.Error(w, string(errJSON), http.StatusConflict)
+				return
+			}
+			fmt.Fprintf(w, `{"status":"queued","count":%d}`, len(req.Items))
+			return
+		}
+
+		if req.ProfileID == "" {
+			req.ProfileID = s.activeProfile
+		}
+		if req.ProfileID != "" && !knownProfile(s.dataDir, req.ProfileID) {
+			http.Error(w, `{"error":"Unknown profile"}`, http.StatusBadRequest)
+			return
+		}
+		savedPosition, resumed := s.resumePlaylist(&req)
+		if err := s.player.PlayPlaylist(req.Items, req.StartPosition, req.ProfileID, req.Service, req.StreamOptions); err != nil {
+			errJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
+			http.Error(w, string(errJSON), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, `{"status":"playing","count":%d,"resumed":%v,"savedPosition":%.1f}`, len(req.Items), resumed, savedPosition)
+
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
 }
 
 func (s *Server) handlePlayerStatus(w http.ResponseWriter, r *http.Request) {
@@ -691,6 +941,263 @@ func (s *Server) handlePlayerStop(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, `{"status":"ok"}`)
 }
 
+// decodePlayerControl parses a POST body for a transport-control endpoint.
+// An empty body is allowed so that e.g. pause without arguments toggles.
+func decodePlayerControl(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "POST" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && err != io.EOF {
+		http.Error(w, `{"error":"Invalid request"}`, http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// writePlayerControlResult reports the outcome of a transport-control call
+// along with the current player status.
+func (s *Server) writePlayerControlResult(w http.ResponseWriter, err error) {
+	if err != nil {
+		errJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
+		http.Error(w, string(errJSON), http.StatusConflict)
+		return
+	}
+	s.sleep.NoteInput()
+	json.NewEncoder(w).Encode(s.player.GetStatus())
+}
+
+func (s *Server) handlePlayerPause(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Paused *bool `json:"paused"`
+	}
+	if !decodePlayerControl(w, r, &req) {
+		return
+	}
+
+	var err error
+	if req.Paused == nil {
+		err = s.player.TogglePause()
+	} else {
+		err = s.player.SetPaused(*req.Paused)
+	}
+	s.writePlayerControlResult(w, err)
+}
+
+func (s *Server) handlePlayerSeek(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Position *float64 `json:"position"`
+		Offset   *float64 `json:"offset"`
+	}
+	if !decodePlayerControl(w, r, &req) {
+		return
+	}
+
+	var err error
+	switch {
+	case req.Position != nil:
+		err = s.player.Seek(*req.Position, false)
+	case req.Offset != nil:
+		err = s.player.Seek(*req.Offset, true)
+	default:
+		http.Error(w, `{"error":"position or offset is required"}`, http.StatusBadRequest)
+		return
+	}
+	s.writePlayerControlResult(w, err)
+}
+
+func (s *Server) handlePlayerVolume(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Volume *float64 `json:"volume"`
+		Mute   *bool    `json:"mute"`
+	}
+	if !decodePlayerControl(w, r, &req) {
+		return
+	}
+
+	if req.Volume == nil && req.Mute == nil {
+		http.Error(w, `{"error":"volume or mute is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if req.Volume != nil {
+		err = s.player.SetVolume(*req.Volume)
+	}
+	if err == nil && req.Mute != nil {
+		err = s.player.SetMute(*req.Mute)
+	}
+	s.writePlayerControlResult(w, err)
+}
+
+func (s *Server) handlePlayerNext(w http.ResponseWriter, r *http.Request) {
+	var req struct{}
+	if !decodePlayerControl(w, r, &req) {
+		return
+	}
+	s.writePlayerControlResult(w, s.player.Next())
+}
+
+func (s *Server) handlePlayerPrevious(w http.ResponseWriter, r *http.Request) {
+	var req struct{}
+	if !decodePlayerControl(w, r, &req) {
+		return
+	}
+	s.writePlayerControlResult(w, s.player.Previous())
+}
+
+func (s *Server) handlePlayerAudioTrack(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Track interface{} `json:"track"`
+	}
+	if !decodePlayerControl(w, r, &req) {
+		return
+	}
+	if req.Track == nil {
+		http.Error(w, `{"error":"track is required"}`, http.StatusBadRequest)
+		return
+	}
+	s.writePlayerControlResult(w, s.player.SetAudioTrack(req.Track))
+}
+
+func (s *Server) handlePlayerSubtitleTrack(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Track interface{} `json:"track"`
+	}
+	if !decodePlayerControl(w, r, &req) {
+		return
+	}
+	if req.Track == nil {
+		http.Error(w, `{"error":"track is required"}`, http.StatusBadRequest)
+		return
+	}
+	s.writePlayerControlResult(w, s.player.SetSubtitleTrack(req.Track))
+}
+
+func (s *Server) handlePlayerSpeed(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Speed float64 `json:"speed"`
+	}
+	if !decodePlayerControl(w, r, &req) {
+		return
+	}
+	if req.Speed <= 0 {
+		http.Error(w, `{"error":"speed must be positive"}`, http.StatusBadRequest)
+		return
+	}
+	s.writePlayerControlResult(w, s.player.SetSpeed(req.Speed))
+}
+
+// handlePlayerSkip seeks past the intro, credits or other segment playing now
+func (s *Server) handlePlayerSkip(w http.ResponseWriter, r *http.Request) {
+	var req struct{}
+	if !decodePlayerControl(w, r, &req) {
+		return
+	}
+	s.writePlayerControlResult(w, s.player.SkipSegment())
+}
+
+// handleHistory exposes the local watch history.
+// GET lists a profile's history, or one entry when key (ItemID or URL) is
+// given; DELETE forgets one entry or the whole history.
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	profileID := r.URL.Query().Get("profile")
+	if profileID == "" {
+		profileID = s.activeProfile
+	}
+	if profileID == "" {
+		http.Error(w, `{"error":"profile is required"}`, http.StatusBadRequest)
+		return
+	}
+	if !knownProfile(s.dataDir, profileID) {
+		http.Error(w, `{"error":"Unknown profile"}`, http.StatusBadRequest)
+		return
+	}
+	key := r.URL.Query().Get("key")
+
+	switch r.Method {
+	case "GET":
+		if key != "" {
+			entry, ok := s.history.Get(profileID, key)
+			if !ok {
+				http.Error(w, `{"error":"Key not found"}`, http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(entry)
+		} else {
+			json.NewEncoder(w).Encode(s.history.List(profileID))
+		}
+
+	case "DELETE":
+		if key != "" {
+			s.history.Delete(profileID, key)
+		} else {
+			s.history.Clear(profileID)
+		}
+		fmt.Fprintf(w, `{"status":"ok"}`)
+
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// handleCallbacks is the diagnostics view of the player callback queue.
+// GET shows pending and recently finished callbacks, POST retries everything
+// pending now, DELETE discards the pending callbacks.
+func (s *Server) handleCallbacks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		json.NewEncoder(w).Encode(s.callbacks.Status())
+
+	case "POST":
+		s.callbacks.Retry()
+		fmt.Fprintf(w, `{"status":"ok"}`)
+
+	case "DELETE":
+		s.callbacks.Clear()
+		fmt.Fprintf(w, `{"status":"ok"}`)
+
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSleep manages the sleep timer.
+// GET shows it, POST sets it from a SleepRequest, DELETE cancels it.
+func (s *Server) handleSleep(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		json.NewEncoder(w).Encode(s.sleep.Status())
+
+	case "POST":
+		var req SleepRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error":"Invalid request"}`, http.StatusBadRequest)
+			return
+		}
+		if err := s.sleep.Set(req); err != nil {
+			errJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
+			http.Error(w, string(errJSON), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(s.sleep.Status())
+
+	case "DELETE":
+		s.sleep.Cancel()
+		fmt.Fprintf(w, `{"status":"ok"}`)
+
+	default:
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+	}
+}
+
 func (s *Server) handleBrowserClose(w http.ResponseWriter, r *http.Request) {
 	Log("API: /api/1/browser/close called")
 	s.CloseBrowser()
@@ -698,6 +1205,18 @@ func (s *Server) handleBrowserClose(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, `{"status":"ok"}`)
 }
 
+// handleBrowserHide returns to the launcher, keeping the browser in the
+// background when the profile keeps warm tabs
+func (s *Server) handleBrowserHide(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "POST" {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	s.ReturnToLauncher()
+	fmt.Fprintf(w, `{"status":"ok"}`)
+}
+
 func (s *Server) handleShutdown(w http.ResponseWriter, r *http.Request) {
 	Log("API: /api/1/shutdown called")
 	// Stop player and close browser
@@ -717,12 +1236,74 @@ func (s *Server) handleShutdown(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleBrowserStatus(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	browser := s.ActiveBrowser()
+	mode := browserModeExtension
+	if browser == Browser(s.cdpBrowser) {
+		mode = browserModeCDP
+	}
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"running": s.browserMgr.IsRunning(),
-		"pid":     s.browserMgr.GetPID(),
+		"running": browser.IsRunning(),
+		"pid":     browser.PID(),
+		"mode":    mode,
 	})
 }
 
+// handleBrowserKey presses a key in the tab on screen, provided its URL
+// contains url; an empty url matches any tab
+func (s *Server) handleBrowserKey(w http.ResponseWriter, r *http.Request) {
+	if s.crossOrigin(r) {
+		http.Error(w, `{"error":"Forbidden"}`, http.StatusForbidden)
+		return
+	}
+	var req struct {
+		URL   string `json:"url"`
+		Key   string `json:"key"`
+		Focus string `json:"focus"`
+	}
+	if !decodePlayerControl(w, r, &req) {
+		return
+	}
+	if req.Key == "" {
+		http.Error(w, `{"error":"key is required"}`, http.StatusBadRequest)
+		return
+	}
+	writeBrowserInputResult(w, s.ActiveBrowser().SendKeyToPage(req.URL, req.Key, req.Focus))
+}
+
+// handleBrowserClick clicks the element matching selector in the tab on
+// screen, provided its URL contains url; an empty url matches any tab
+func (s *Server) handleBrowserClick(w http.ResponseWriter, r *http.Request) {
+	if s.crossOrigin(r) {
+		http.Error(w, `{"error":"Forbidden"}`, http.StatusForbidden)
+		return
+	}
+	var req struct {
+		URL      string `json:"url"`
+		Selector string `json:"selector"`
+	}
+	if !decodePlayerControl(w, r, &req) {
+		return
+	}
+	if req.Selector == "" {
+		http.Error(w, `{"error":"selector is required"}`, http.StatusBadRequest)
+		return
+	}
+	writeBrowserInputResult(w, s.ActiveBrowser().ClickElement(req.URL, req.Selector))
+}
+
+func writeBrowserInputResult(w http.ResponseWriter, err error) {
+	if err != nil {
+		status := http.StatusConflict
+		if errors.Is(err, errCDPUnavailable) {
+			status = http.StatusServiceUnavailable
+		}
+		errJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
+		http.Error(w, string(errJSON), status)
+		return
+	}
+	fmt.Fprintf(w, `{"status":"ok"}`)
+}
+
 func (s *Server) handleBrowsersList(w http.ResponseWriter, r *http.Request) {
 	browsers := s.browserMgr.DetectBrowsers()
 	w.Header().Set("Content-Type", "application/json")
@@ -849,37 +1430,83 @@ func (s *Server) handleProfile(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// LaunchBrowser launches a browser with the given URL
-func (s *Server) LaunchBrowser(browserName, url, profileID string, focusAlert bool) error {
-	Log("Launching browser: %s url=%s profile=%s useCDP=%v focusAlert=%v", browserName, url, profileID, s.useCDP, focusAlert)
+// LaunchBrowser launches a browser on a website app
+func (s *Server) LaunchBrowser(browserName, profileID string, app AppConfig) error {
+	url, focusAlert, opts := app.URL, app.FocusAlert, app.Browser
+	mode := opts.mode(s.browserMode)
+	Log("Launching browser: %s url=%s profile=%s mode=%s focusAlert=%v", browserName, url, profileID, mode, focusAlert)
 	s.activeProfile = profileID
 
-	if s.useCDP {
-		// Initialize CDP browser if needed
-		if s.cdpBrowser == nil {
-			s.cdpBrowser = NewCDPBrowser(s.assetDir, s.dataDir, s.port)
-			if s.onBrowserExit != nil {
-				s.cdpBrowser.SetOnExit(s.onBrowserExit)
-			}
-			// Wire up script injection
-			s.cdpBrowser.SetGetScript(s.GetServiceScript)
-		}
-		return s.cdpBrowser.Launch(url, profileID)
+	browser := Browser(s.browserMgr)
+	if mode == browserModeCDP {
+		browser = s.cdpBrowser
+	}
+
+	// Only one browser at a time, even across modes
+	s.browserMu.Lock()
+	previous := s.browser
+	s.browser = browser
+	s.browserHome = url
+	s.browserApp = app
+	s.browserName = browserName
+	s.browserMu.Unlock()
+	if previous != browser && previous.IsRunning() {
+		previous.Close()
 	}
+	s.stopKiosk()
 
-	err := s.browserMgr.Launch(browserName, url, profileID)
+	err := browser.Launch(browserName, url, profileID, opts)
 	if err != nil {
 		return err
 	}
+	s.publishBrowserLaunched(browserName, url, profileID)
+
+	if policy := newKioskPolicy(app); policy != nil {
+		if mode == browserModeCDP {
+			Log("Kiosk lockdown needs the extension-based browser, not enforced")
+		} else {
+			guard := NewKioskGuard(policy, s.browserMgr.CDP())
+			s.browserMu.Lock()
+			s.kiosk = guard
+			s.browserMu.Unlock()
+			guard.Start()
+		}
+	}
 
 	// If focusAlert is enabled, use CDP to focus the page content
 	if focusAlert {
-		go s.browserMgr.SendFocusToPage()
+		go SendFocusToPage(browser)
 	}
 
 	return nil
 }
 
+// stopKiosk ends the lockdown of the previous app
+func (s *Server) stopKiosk() {
+	s.browserMu.Lock()
+	guard := s.kiosk
+	s.kiosk = nil
+	s.browserMu.Unlock()
+	if guard != nil {
+		guard.Stop()
+	}
+}
+
+// ActiveBrowser returns the browser the last app was launched in
+func (s *Server) ActiveBrowser() Browser {
+	s.browserMu.Lock()
+	defer s.browserMu.Unlock()
+	return s.browser
+}
+
+func (s *Server) publishBrowserLaunched(browserName, url, profileID string) {
+	s.events.Publish("browser.launched", map[string]string{
+		"browser":   browserName,
+		"url":       url,
+		"profileId": profileID,
+	})
+}
+
 // LaunchApp launches a native application
 func (s *Server) LaunchApp(commandLine, profileID string) error {
 	Log("Launching app: %s profile=%s", commandLine, profileID)
@@ -896,15 +1523,30 @@ func (s *Server) LaunchApp(commandLine, profileID string) error {
 	}
 
 	Log("Native app started with PID: %d", cmd.Process.Pid)
+	s.events.Publish("app.launched", map[string]string{
+		"commandLine": commandLine,
+		"profileId":   profileID,
+	})
 	return nil
 }
 
 // CloseBrowser closes the running browser
 func (s *Server) CloseBrowser() {
-	if s.useCDP && s.cdpBrowser != nil {
-		s.cdpBrowser.Close()
-	} else {
-		s.browserMgr.Close()
+	s.stopKiosk()
+	s.ActiveBrowser().Close()
+}
+
+// ReturnToLauncher takes the browser off screen. A warm browser keeps
+// running in the background with its tabs; any other is closed.
+func (s *Server) ReturnToLauncher() {
+	if s.ActiveBrowser() != Browser(s.browserMgr) || !s.browserMgr.Hide() {
+		s.CloseBrowser()
+		return
+	}
+	s.stopKiosk()
+	s.events.Publish("browser.hidden", nil)
+	if s.onBrowserHidden != nil {
+		s.onBrowserHidden()
 	}
 }
 
@@ -1131,13 +1773,14 @@ func (s *Server) writeImageResponse(w http.ResponseWriter, ext string, data []by
 
 // ServiceLibraryItem represents a streaming service template
 type ServiceLibraryItem struct {
-	Name       string   `json:"name"`
-	URL        string   `json:"url"`
-	MatchURLs  []string `json:"matchUrls,omitempty"`
-	Color      string   `json:"color"`
-	ColorValue int      `json:"colorValue"`
-	HasLogo    bool     `json:"hasLogo"`
-	FocusAlert bool     `json:"focusAlert,omitempty"`
+	Name       string          `json:"name"`
+	URL        string          `json:"url"`
+	MatchURLs  []string        `json:"matchUrls,omitempty"`
+	Color      string          `json:"color"`
+	ColorValue int             `json:"colorValue"`
+	HasLogo    bool            `json:"hasLogo"`
+	FocusAlert bool            `json:"focusAlert,omitempty"`
+	Browser    *BrowserOptions `json:"browser,omitempty"`
 }
 
 // handleServiceLibrary returns available streaming services
@@ -1152,11 +1795,12 @@ func (s *Server) handleServiceLibrary(w http.ResponseWriter, r *http.Request) {
 		}
 
 		var raw struct {
-			Name       string   `json:"name"`
-			URL        string   `json:"url"`
-			MatchURLs  []string `json:"matchUrls,omitempty"`
-			Color      string   `json:"color"`
-			FocusAlert bool     `json:"focusAlert,omitempty"`
+			Name       string          `json:"name"`
+			URL        string          `json:"url"`
+			MatchURLs  []string        `json:"matchUrls,omitempty"`
+			Color      string          `json:"color"`
+			FocusAlert bool            `json:"focusAlert,omitempty"`
+			Browser    *BrowserOptions `json:"browser,omitempty"`
 		}
 		if err := json.Unmarshal(data, &raw); err != nil {
 			continue
@@ -1168,6 +1812,7 @@ func (s *Server) handleServiceLibrary(w http.ResponseWriter, r *http.Request) {
 			MatchURLs:  raw.MatchURLs,
 			Color:      raw.Color,
 			FocusAlert: raw.FocusAlert,
+			Browser:    raw.Browser,
 		}
 
 		// Parse color
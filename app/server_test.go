@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHandlePlayerSpeedRejectsBadSpeed(t *testing.T) {
+	s := &Server{}
+	for _, body := range []string{`{}`, `{"speed":0}`, `{"speed":-1.5}`} {
+		w := httptest.NewRecorder()
+		s.handlePlayerSpeed(w, httptest.NewRequest("POST", "/api/1/player/speed", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want %d", body, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestPlayerControls(t *testing.T) {
+	p, backend := newTestPlayer(t, []PlaylistItem{{URL: "https://example.com/1.mkv"}})
+	s := &Server{player: p, sleep: &SleepTimer{}}
+
+	tests := []struct {
+		handler  http.HandlerFunc
+		body     string
+		wantCode int
+		want     []string
+	}{
+		{s.handlePlayerPause, ``, 200, []string{"toggle"}},
+		{s.handlePlayerPause, `{"paused":true}`, 200, []string{"pause true"}},
+		{s.handlePlayerPause, `{"paused":false}`, 200, []string{"pause false"}},
+		{s.handlePlayerPause, `{"paused":`, 400, nil},
+		{s.handlePlayerSeek, `{"position":600}`, 200, []string{"seek 600 false"}},
+		{s.handlePlayerSeek, `{"offset":-10}`, 200, []string{"seek -10 true"}},
+		{s.handlePlayerSeek, `{"position":0,"offset":30}`, 200, []string{"seek 0 false"}},
+		{s.handlePlayerSeek, `{}`, 400, nil},
+		{s.handlePlayerVolume, `{"volume":40}`, 200, []string{"volume 40"}},
+		{s.handlePlayerVolume, `{"mute":true}`, 200, []string{"mute true"}},
+		{s.handlePlayerVolume, `{"volume":70,"mute":false}`, 200, []string{"volume 70", "mute false"}},
+		{s.handlePlayerVolume, `{}`, 400, nil},
+		{s.handlePlayerSpeed, `{"speed":0.25}`, 200, []string{"speed 0.25"}},
+		{s.handlePlayerSpeed, `{"speed":1}`, 200, []string{"speed 1"}},
+		{s.handlePlayerSpeed, `{"speed":4}`, 200, []string{"speed 4"}},
+		{s.handlePlayerNext, ``, 409, nil}, // the fake can't skip
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		tt.handler(w, httptest.NewRequest("POST", "/api/1/player/control", strings.NewReader(tt.body)))
+		if w.Code != tt.wantCode {
+			t.Errorf("%s: got %d, want %d (%s)", tt.body, w.Code, tt.wantCode, w.Body)
+		}
+		if got := backend.Calls(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: sent %q, want %q", tt.body, got, tt.want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	s.handlePlayerPause(w, httptest.NewRequest("GET", "/api/1/player/pause", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET pause: got %d", w.Code)
+	}
+
+	// Nothing playing: the controls conflict with the player's state
+	p.cmd = nil
+	w = httptest.NewRecorder()
+	s.handlePlayerSeek(w, httptest.NewRequest("POST", "/api/1/player/seek", strings.NewReader(`{"offset":10}`)))
+	if w.Code != http.StatusConflict {
+		t.Errorf("seek with nothing playing: got %d, want %d", w.Code, http.StatusConflict)
+	}
+}
+
+func TestBrowserInputIsLocalOnly(t *testing.T) {
+	s := &Server{port: 8765}
+	for path, handler := range map[string]http.HandlerFunc{
+		"/api/1/browser/key":   s.handleBrowserKey,
+		"/api/1/browser/click": s.handleBrowserClick,
+	} {
+		h := s.corsMiddleware(handler)
+
+		// No CORS preflight answer for web pages
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("OPTIONS", path, nil)
+		req.Header.Set("Origin", "https://evil.example")
+		h.ServeHTTP(w, req)
+		if w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s: preflight allowed", path)
+		}
+
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", path, strings.NewReader(`{}`))
+		req.Header.Set("Origin", "https://evil.example")
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s from a web page: got %d", path, w.Code)
+		}
+
+		// Local tools get as far as checking the request
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", path, strings.NewReader(`{}`))
+		req.Host = "127.0.0.1:8765"
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s from curl: got %d, want %d", path, w.Code, http.StatusBadRequest)
+		}
+	}
+}
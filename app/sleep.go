@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	idlePromptText = "Are you still watching? Press play to continue."
+
+	// How long after stopping at the end of an item a new launch is taken
+	// for the service's autoplay and stopped too
+	sleepAutoplayHold = 30 * time.Second
+)
+
+// SleepRequest sets the sleep timer. Minutes and EndOfItem may be combined,
+// in which case whichever comes first wins. The player is stopped unless
+// StopPlayer is false; the browser is only closed when CloseBrowser is set.
+type SleepRequest struct {
+	Minutes      float64 `json:"minutes"`
+	EndOfItem    bool    `json:"endOfItem"`
+	StopPlayer   *bool   `json:"stopPlayer"`
+	CloseBrowser bool    `json:"closeBrowser"`
+}
+
+// SleepStatus describes the sleep timer for the API and events
+type SleepStatus struct {
+	Active       bool       `json:"active"`
+	Deadline     *time.Time `json:"deadline,omitempty"`
+	Remaining    float64    `json:"remaining,omitempty"` // seconds
+	EndOfItem    bool       `json:"endOfItem"`
+	StopPlayer   bool       `json:"stopPlayer"`
+	CloseBrowser bool       `json:"closeBrowser"`
+	IdleItems    int        `json:"idleItems"` // items played in a row without input
+}
+
+// SleepTimer stops the player and/or closes the browser after a delay or at
+// the end of the current item. It also applies the profile's idle rule:
+// after IdleItems items play back to back with nobody touching the controls,
+// playback is paused with a prompt. Both follow the player events on the
+// EventHub, which come from the backend's position polling.
+type SleepTimer struct {
+	mu           sync.Mutex
+	player       *Player
+	events       *EventHub
+	dataDir      string
+	closeBrowser func()
+
+	timer        *time.Timer
+	deadline     time.Time
+	endOfItem    bool
+	stopPlayer   bool
+	closeOnFire  bool
+	idleItems    int
+	idleLimit    int       // the playing profile's IdleItems, read at launch
+	lastEndedFor string    // reason of the last player.ended
+	holdUntil    time.Time // stop launches until then; see sleepAutoplayHold
+}
+
+func NewSleepTimer(player *Player, events *EventHub, dataDir string, closeBrowser func()) *SleepTimer {
+	t := &SleepTimer{
+		player:       player,
+		events:       events,
+		dataDir:      dataDir,
+		closeBrowser: closeBrowser,
+	}
+
+	sub, _ := events.Subscribe()
+	go func() {
+		for ev := range sub {
+			t.handleEvent(ev)
+		}
+	}()
+	return t
+}
+
+// Set arms the timer, replacing any earlier one
+func (t *SleepTimer) Set(req SleepRequest) error {
+	if req.Minutes <= 0 && !req.EndOfItem {
+		return fmt.Errorf("minutes or endOfItem is required")
+	}
+	stopPlayer := req.StopPlayer == nil || *req.StopPlayer
+	if !stopPlayer && !req.CloseBrowser {
+		return fmt.Errorf("nothing to do: stopPlayer and closeBrowser are both off")
+	}
+
+	t.mu.Lock()
+	t.cancel()
+	t.endOfItem = req.EndOfItem
+	t.stopPlayer = stopPlayer
+	t.closeOnFire = req.CloseBrowser
+	if req.Minutes > 0 {
+		d := time.Duration(req.Minutes * float64(time.Minute))
+		t.deadline = time.Now().Add(d)
+		t.timer = time.AfterFunc(d, func() { t.fire("timer") })
+	}
+	status := t.status()
+	t.mu.Unlock()
+
+	Log("SleepTimer: set minutes=%.1f endOfItem=%v stopPlayer=%v closeBrowser=%v", req.Minutes, req.EndOfItem, stopPlayer, req.CloseBrowser)
+	t.events.Publish("sleep.changed", status)
+	return nil
+}
+
+// Cancel disarms the timer
+func (t *SleepTimer) Cancel() {
+	t.mu.Lock()
+	t.cancel()
+	status := t.status()
+	t.mu.Unlock()
+
+	Log("SleepTimer: cancelled")
+	t.events.Publish("sleep.changed", status)
+}
+
+// cancel clears the timer state. Must be called with t.mu held.
+func (t *SleepTimer) cancel() {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	t.deadline = time.Time{}
+	t.endOfItem = false
+}
+
+func (t *SleepTimer) active() bool {
+	return t.timer != nil || t.endOfItem
+}
+
+// Status returns the timer state
+func (t *SleepTimer) Status() SleepStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status()
+}
+
+// status must be called with t.mu held
+func (t *SleepTimer) status() SleepStatus {
+	status := SleepStatus{
+		Active:       t.active(),
+		EndOfItem:    t.endOfItem,
+		StopPlayer:   t.stopPlayer,
+		CloseBrowser: t.closeOnFire,
+		IdleItems:    t.idleItems,
+	}
+	if t.timer != nil {
+		deadline := t.deadline
+		status.Deadline = &deadline
+		status.Remaining = time.Until(deadline).Seconds()
+	}
+	return status
+}
+
+// fire runs the timer's actions once
+func (t *SleepTimer) fire(cause string) {
+	t.mu.Lock()
+	if !t.active() {
+		t.mu.Unlock()
+		return
+	}
+	stopPlayer, closeBrowser := t.stopPlayer, t.closeOnFire
+	t.cancel()
+	if stopPlayer && cause == "end-of-item" {
+		t.holdUntil = time.Now().Add(sleepAutoplayHold)
+	}
+	t.mu.Unlock()
+
+	Log("SleepTimer: fired by %s (stopPlayer=%v closeBrowser=%v)", cause, stopPlayer, closeBrowser)
+	t.events.Publish("sleep.fired", map[string]interface{}{"cause": cause})
+
+	if stopPlayer {
+		t.player.Stop()
+	}
+	if closeBrowser && t.closeBrowser != nil {
+		t.closeBrowser()
+	}
+}
+
+// NoteInput records that someone used the player controls
+func (t *SleepTimer) NoteInput() {
+	t.mu.Lock()
+	t.idleItems = 0
+	t.mu.Unlock()
+}
+
+// handleEvent advances the end-of-item timer and the idle count
+func (t *SleepTimer) handleEvent(ev Event) {
+	switch ev.Type {
+	case "player.item-changed":
+		t.fireAtEndOfItem()
+		t.countIdleItem()
+
+	case "player.ended":
+		reason := ""
+		if data, ok := ev.Data.(map[string]interface{}); ok {
+			reason, _ = data["reason"].(string)
+		}
+		t.mu.Lock()
+		t.lastEndedFor = reason
+		t.mu.Unlock()
+		// A replaced item was cut short by somebody starting another
+		if reason != "replaced" {
+			t.fireAtEndOfItem()
+		}
+
+	case "player.started":
+		// A launch straight after an item played to the end is autoplay;
+		// anything else was somebody picking something
+		limit := LoadPlayerSettings(t.dataDir, t.player.State().ProfileID).IdleItems
+		t.mu.Lock()
+		t.idleLimit = limit
+		autoplay := t.lastEndedFor == "ended"
+		held := time.Now().Before(t.holdUntil)
+		t.holdUntil = time.Time{}
+		if !autoplay {
+			t.idleItems = 0
+		}
+		t.mu.Unlock()
+		if held && autoplay {
+			Log("SleepTimer: stopping autoplay after the sleep timer")
+			t.player.Stop()
+			return
+		}
+		if autoplay {
+			t.countIdleItem()
+		}
+
+	case "player.paused", "player.resumed":
+		t.NoteInput()
+	}
+}
+
+func (t *SleepTimer) fireAtEndOfItem() {
+	t.mu.Lock()
+	endOfItem := t.endOfItem
+	t.mu.Unlock()
+	if endOfItem {
+		t.fire("end-of-item")
+	}
+}
+
+// countIdleItem counts an item that started without input and pauses with a
+// prompt once the profile's limit is reached
+func (t *SleepTimer) countIdleItem() {
+	state := t.player.State()
+
+	t.mu.Lock()
+	t.idleItems++
+	count := t.idleItems
+	prompt := t.idleLimit > 0 && count >= t.idleLimit && state.Playing
+	if prompt {
+		t.idleItems = 0
+	}
+	t.mu.Unlock()
+
+	if !prompt {
+		return
+	}
+
+	Log("SleepTimer: %d items without input, pausing", count)
+	if err := t.player.SetPaused(true); err != nil {
+		Log("SleepTimer: pause failed: %v", err)
+	}
+	t.player.ShowText(idlePromptText, time.Minute)
+	t.events.Publish("sleep.idle", map[string]interface{}{
+		"items":   count,
+		"message": idlePromptText,
+	})
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+// newTestSleepTimer returns a SleepTimer for p that is fed events by the
+// test rather than the EventHub, and a count of browser closes
+func newTestSleepTimer(p *Player) (*SleepTimer, *int) {
+	closes := 0
+	return &SleepTimer{
+		player:       p,
+		events:       p.events,
+		dataDir:      p.dataDir,
+		closeBrowser: func() { closes++ },
+	}, &closes
+}
+
+// playTestProcess makes a fresh process the running player, stopping when
+// told to quit
+func playTestProcess(t *testing.T, p *Player, fake *fakeBackend) {
+	cmd := exec.Command("sleep", "30")
+	p.mu.Lock()
+	p.backend = &quittingBackend{fakeBackend: fake, cmd: cmd, position: -1}
+	p.playing = true
+	p.stopReason = ""
+	runTestProcess(t, p, cmd)
+	p.mu.Unlock()
+	t.Cleanup(func() { cmd.Process.Kill() })
+}
+
+func TestSleepAtEndOfItem(t *testing.T) {
+	p, fake := newTestPlayer(t, []PlaylistItem{{URL: "https://example.com/1.mkv"}, {URL: "https://example.com/2.mkv"}})
+	playTestProcess(t, p, fake)
+	timer, closes := newTestSleepTimer(p)
+
+	if err := timer.Set(SleepRequest{EndOfItem: true, CloseBrowser: true}); err != nil {
+		t.Fatal(err)
+	}
+	if status := timer.Status(); !status.Active || !status.EndOfItem || !status.StopPlayer {
+		t.Errorf("armed: %+v", status)
+	}
+
+	// The player moving to the next item is the end of the first
+	timer.handleEvent(Event{Type: "player.item-changed"})
+	if p.State().Playing {
+		t.Error("player still playing")
+	}
+	if *closes != 1 {
+		t.Errorf("browser closed %d times", *closes)
+	}
+	if timer.Status().Active {
+		t.Error("timer still armed after firing")
+	}
+}
+
+func TestSleepHoldsAutoplay(t *testing.T) {
+	p, fake := newTestPlayer(t, []PlaylistItem{{URL: "https://example.com/1.mkv"}})
+	playTestProcess(t, p, fake)
+	timer, _ := newTestSleepTimer(p)
+	timer.Set(SleepRequest{EndOfItem: true})
+
+	// A replaced item didn't end by itself
+	timer.handleEvent(Event{Type: "player.ended", Data: map[string]interface{}{"reason": "replaced"}})
+	if !p.State().Playing || !timer.Status().Active {
+		t.Fatal("a replaced item fired the timer")
+	}
+
+	timer.handleEvent(Event{Type: "player.ended", Data: map[string]interface{}{"reason": "ended"}})
+	if p.State().Playing {
+		t.Fatal("player still playing at the end of the item")
+	}
+
+	// The service's autoplay of the next episode is stopped, once
+	playTestProcess(t, p, fake)
+	timer.handleEvent(Event{Type: "player.started"})
+	if p.State().Playing {
+		t.Error("autoplay after the sleep timer kept playing")
+	}
+	playTestProcess(t, p, fake)
+	timer.handleEvent(Event{Type: "player.started"})
+	if !p.State().Playing {
+		t.Error("a later launch was stopped")
+	}
+}
+
+func TestSleepIdleItems(t *testing.T) {
+	p, fake := newTestPlayer(t, []PlaylistItem{{URL: "https://example.com/1.mkv"}})
+	writeTestProfile(t, p.dataDir, "alice")
+	p.profileID = "alice"
+	if err := SavePlayerSettings(p.dataDir, "alice", PlayerSettings{IdleItems: 3}); err != nil {
+		t.Fatal(err)
+	}
+	timer, _ := newTestSleepTimer(p)
+	events, unsubscribe := p.events.Subscribe()
+	defer unsubscribe()
+
+	// Somebody picked something, then two items followed without input
+	timer.handleEvent(Event{Type: "player.started"})
+	timer.handleEvent(Event{Type: "player.item-changed"})
+	timer.handleEvent(Event{Type: "player.item-changed"})
+	if got := timer.Status().IdleItems; got != 2 {
+		t.Errorf("idle items %d, want 2", got)
+	}
+	if calls := fake.Calls(); calls != nil {
+		t.Errorf("paused early: %q", calls)
+	}
+
+	// Pausing is input
+	timer.handleEvent(Event{Type: "player.paused"})
+	if got := timer.Status().IdleItems; got != 0 {
+		t.Errorf("idle items after input %d", got)
+	}
+
+	// The service autoplaying the next item counts too
+	timer.handleEvent(Event{Type: "player.item-changed"})
+	timer.handleEvent(Event{Type: "player.ended", Data: map[string]interface{}{"reason": "ended"}})
+	timer.handleEvent(Event{Type: "player.started"})
+	timer.handleEvent(Event{Type: "player.item-changed"})
+	want := []string{"pause true", "text " + idlePromptText}
+	if calls := fake.Calls(); !reflect.DeepEqual(calls, want) {
+		t.Errorf("sent %q, want %q", calls, want)
+	}
+	if got := timer.Status().IdleItems; got != 0 {
+		t.Errorf("idle items after the prompt %d", got)
+	}
+
+	var idle bool
+	for len(events) > 0 {
+		if ev := <-events; ev.Type == "sleep.idle" {
+			idle = ev.Data.(map[string]interface{})["items"] == 3
+		}
+	}
+	if !idle {
+		t.Error("no sleep.idle for 3 items")
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// The watchdog looks after the page of the browser on screen. It listens
+// for Inspector.targetCrashed ("Aw, Snap") on the app's tab and pings the
+// page with a trivial Runtime.evaluate; a renderer that leaves several
+// pings in a row unanswered is hung. DevTools has no event for a hung
+// renderer (Chrome's "Page unresponsive" dialog isn't reported to clients),
+// and a hung renderer can't answer Runtime.evaluate, so the ping is how it
+// is noticed. Either way the Server is told, and it reloads, restarts or
+// closes the browser as the app's OnHang says.
+const (
+	watchdogInterval = 10 * time.Second
+	watchdogMisses   = 3 // unanswered pings in a row before the page counts as hung
+)
+
+// BrowserIncident is a crashed or hung page found by the watchdog
+type BrowserIncident struct {
+	Kind      string // "crashed" or "unresponsive"
+	URL       string
+	ProfileID string
+	TargetID  string
+	client    *CDPClient // the session's DevTools, whichever browser is on screen by now
+}
+
+// pageWatchdog watches one browser session while it is on screen
+type pageWatchdog struct {
+	bm   *BrowserManager
+	sess *browserSession
+	stop chan struct{}
+}
+
+// SetOnHang sets the function told about crashed and hung pages. It runs
+// on its own goroutine, so it may relaunch or close the browser.
+func (bm *BrowserManager) SetOnHang(fn func(BrowserIncident)) {
+	bm.mu.Lock()
+	bm.onHang = fn
+	bm.mu.Unlock()
+}
+
+// watch starts the watchdog on sess, replacing the one on the previous
+// session. Call it with the BrowserManager locked.
+func (bm *BrowserManager) watch(sess *browserSession) {
+	bm.unwatch(nil)
+	if !sess.browser.spec.CDP {
+		return
+	}
+	w := &pageWatchdog{bm: bm, sess: sess, stop: make(chan struct{})}
+	bm.watchdog = w
+	go w.run()
+}
+
+// unwatch stops the watchdog if it watches sess, or whichever session it
+// watches when sess is nil. Call it with the BrowserManager locked.
+func (bm *BrowserManager) unwatch(sess *browserSession) {
+	if bm.watchdog == nil || (sess != nil && bm.watchdog.sess != sess) {
+		return
+	}
+	close(bm.watchdog.stop)
+	bm.watchdog = nil
+}
+
+// ReloadPage reloads the tab an incident happened in, bypassing the cache
+func (bm *BrowserManager) ReloadPage(incident BrowserIncident) error {
+	if incident.client == nil {
+		return errCDPUnavailable
+	}
+	_, err := incident.client.Call(CDPTarget{ID: incident.TargetID}, "Page.reload", map[string]interface{}{"ignoreCache": true})
+	return err
+}
+
+// CloseQuietly closes the browser on screen without calling the exit
+// function, waiting for it to go so that it can be started again
+func (bm *BrowserManager) CloseQuietly() {
+	bm.mu.Lock()
+	sess := bm.active
+	bm.mu.Unlock()
+	if sess != nil {
+		bm.stopSession(sess, true)
+	}
+}
+
+func (w *pageWatchdog) run() {
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+
+	crashed := make(chan CDPTarget, 1)
+	lost := make(chan string, 1)
+	var watching string
+	var pageStop chan struct{}
+	defer func() {
+		if pageStop != nil {
+			close(pageStop)
+		}
+	}()
+
+	misses := 0
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-w.sess.exited:
+			return
+		case target := <-crashed:
+			misses = 0
+			w.report("crashed", target)
+			continue
+		case id := <-lost:
+			if id == watching {
+				watching = ""
+			}
+			continue
+		case <-ticker.C:
+		}
+
+		c, target, ok := w.page()
+		if !ok {
+			misses = 0
+			continue
+		}
+
+		if target.ID != watching {
+			if pageStop != nil {
+				close(pageStop)
+			}
+			pageStop = make(chan struct{})
+			watching = target.ID
+			go w.watchCrash(c, target, pageStop, crashed, lost)
+		}
+
+		if _, err := c.Evaluate(target, "1"); err != nil {
+			misses++
+			Log("Watchdog: %s didn't answer (%d/%d): %v", target.URL, misses, watchdogMisses, err)
+			if misses >= watchdogMisses {
+				misses = 0
+				w.report("unresponsive", target)
+			}
+		} else {
+			misses = 0
+		}
+	}
+}
+
+// page finds the app's tab, if the session is on screen and its DevTools
+// port is known
+func (w *pageWatchdog) page() (*CDPClient, CDPTarget, bool) {
+	c, target, err := w.bm.currentPage(w.sess)
+	return c, target, err == nil
+}
+
+// watchCrash listens on the tab for Inspector.targetCrashed until stop is
+// closed, reporting the tab on lost if the connection goes away first
+func (w *pageWatchdog) watchCrash(c *CDPClient, target CDPTarget, stop chan struct{}, crashed chan<- CDPTarget, lost chan<- string) {
+	enable := map[string]map[string]interface{}{"Inspector.enable": {}}
+	err := c.WatchPage(target, enable, stop, func(method string, _ json.RawMessage) {
+		if method == "Inspector.targetCrashed" {
+			select {
+			case crashed <- target:
+			default:
+			}
+		}
+	})
+	if err != nil {
+		select {
+		case lost <- target.ID:
+		default:
+		}
+	}
+}
+
+func (w *pageWatchdog) report(kind string, target CDPTarget) {
+	Log("Watchdog: page %s %s", target.URL, kind)
+
+	w.bm.mu.Lock()
+	onHang := w.bm.onHang
+	c := w.sess.client()
+	w.bm.mu.Unlock()
+	if onHang == nil {
+		return
+	}
+	go onHang(BrowserIncident{
+		Kind:      kind,
+		URL:       target.URL,
+		ProfileID: w.sess.profileID,
+		TargetID:  target.ID,
+		client:    c,
+	})
+}
+
+// onBrowserHang carries out the running app's OnHang action
+func (s *Server) onBrowserHang(incident BrowserIncident) {
+	s.browserMu.Lock()
+	app, browserName := s.browserApp, s.browserName
+	s.browserMu.Unlock()
+
+	action := app.Browser.onHang()
+	Log("Browser watchdog: %s %s, action: %s", incident.URL, incident.Kind, action)
+	s.events.Publish("browser.incident", map[string]string{
+		"kind":      incident.Kind,
+		"url":       incident.URL,
+		"profileId": incident.ProfileID,
+		"action":    action,
+	})
+
+	switch action {
+	case hangActionNone:
+	case hangActionLauncher:
+		s.CloseBrowser()
+	case hangActionRestart:
+		s.restartBrowser(browserName, incident.ProfileID, app)
+	default:
+		err := s.browserMgr.ReloadPage(incident)
+		if err == nil {
+			return
+		}
+		Log("Browser watchdog: reload failed (%v), restarting the browser", err)
+		s.restartBrowser(browserName, incident.ProfileID, app)
+	}
+}
+
+// restartBrowser starts a fresh browser for app, going back to the
+// launcher if that fails
+func (s *Server) restartBrowser(browserName, profileID string, app AppConfig) {
+	s.browserMgr.CloseQuietly()
+	if err := s.LaunchBrowser(browserName, profileID, app); err != nil {
+		Log("Browser watchdog: restart failed: %v", err)
+		if s.onBrowserExit != nil {
+			s.onBrowserExit()
+		}
+	}
+}
@@ -19,7 +19,7 @@ func (s *Server) handleYouTubeFullscreen(w http.ResponseWriter, r *http.Request)
 
 	// Try to fullscreen via JS - find the button and click it
 	Log("YouTube fullscreen: attempting via JS...")
-	err := s.browserMgr.EvalJS("youtube.com", `(function() {
+	result, err := s.ActiveBrowser().Evaluate("youtube.com", `(function() {
 		var info = {};
 		info.url = location.href;
 		info.player = !!document.querySelector('#movie_player');
@@ -53,7 +53,7 @@ func (s *Server) handleYouTubeFullscreen(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	Log("YouTube fullscreen succeeded")
+	Log("YouTube fullscreen succeeded: %v", result)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
 	})
@@ -149,6 +149,11 @@
         window.launchTubeCloseTab = function() {
             fetch(`http://localhost:${port}/api/1/browser/close`, { method: 'POST' }).catch(() => {});
         };
+        // Back to the launcher, leaving the app open if the profile keeps
+        // warm tabs
+        window.launchTubeReturnToLauncher = function() {
+            fetch(`http://localhost:${port}/api/1/browser/hide`, { method: 'POST' }).catch(() => {});
+        };
         window.launchTubeLog = function(message, level) {
             fetch(`http://localhost:${port}/api/1/log`, {
                 method: 'POST',
@@ -158,6 +163,70 @@
         };
     }
 
+    // Kiosk lockdown: keep links and popups on the app's own sites. LaunchTube
+    // closes anything that slips through; this just keeps it in the same tab.
+    async function setupKiosk(port) {
+        if (window !== window.top) return;
+
+        let policy;
+        try {
+            const response = await fetch(`http://localhost:${port}/api/1/kiosk`);
+            policy = await response.json();
+        } catch (e) {
+            return;
+        }
+        if (!policy.enabled) return;
+
+        function allowed(url) {
+            try {
+                const u = new URL(url, location.href);
+                if (u.protocol !== 'http:' && u.protocol !== 'https:') return false;
+                const host = u.hostname.toLowerCase();
+                return policy.domains.some(d => host === d || host.endsWith('.' + d));
+            } catch (e) {
+                return false;
+            }
+        }
+
+        function openHere(url) {
+            if (allowed(url)) {
+                location.href = new URL(url, location.href).href;
+            } else {
+                serverLog(`Kiosk: blocked ${url}`);
+            }
+        }
+
+        window.open = function(url) {
+            if (url) openHere(String(url));
+            return null;
+        };
+
+        document.addEventListener('click', (e) => {
+            const link = e.target.closest && e.target.closest('a[href]');
+            if (!link) return;
+            const target = (link.getAttribute('target') || '').toLowerCase();
+            if (target && target !== '_self' && target !== '_top' && target !== '_parent') {
+                e.preventDefault();
+                e.stopImmediatePropagation();
+                openHere(link.href);
+            } else if (!allowed(link.href) && !link.href.startsWith('javascript:')) {
+                e.preventDefault();
+                e.stopImmediatePropagation();
+                serverLog(`Kiosk: blocked ${link.href}`);
+            }
+        }, true);
+
+        // The remote's and keyboards' Home key goes back to the app
+        window.addEventListener('keydown', (e) => {
+            if (e.key === 'BrowserHome') {
+                e.preventDefault();
+                location.href = policy.home;
+            }
+        }, true);
+
+        serverLog(`Kiosk: keeping links on ${policy.domains.join(', ')}`);
+    }
+
     // Main
     async function main() {
         console.log('Launch Tube: Loader starting on', location.hostname);
@@ -176,6 +245,7 @@
         window.postMessage({ type: 'launchtube-loader-ready', port: port, version: 1 }, '*');
 
         loadScript(port);
+        setupKiosk(port);
     }
 
     main();
@@ -0,0 +1,58 @@
+// LaunchTube service helpers - served ahead of every service script
+(function() {
+    'use strict';
+
+    if (window.launchTubeWatchPlayer) return;
+
+    function formatTime(seconds) {
+        const mins = Math.floor(seconds / 60);
+        const secs = Math.floor(seconds % 60);
+        return `${mins}:${secs.toString().padStart(2, '0')}`;
+    }
+
+    // Follow the external player over the launcher's event stream. onStatus
+    // gets a line of progress text; onStop is called once playback stops or
+    // the launcher goes away. Returns a function that stops watching.
+    window.launchTubeWatchPlayer = function(onStatus, onStop) {
+        let events = null;
+        let stopped = false;
+
+        const stop = () => {
+            stopped = true;
+            clearTimeout(timer);
+            if (events) {
+                events.close();
+                events = null;
+            }
+        };
+
+        // Give the player time to start, since the first event is a
+        // player.status snapshot; changes follow as they happen
+        const timer = setTimeout(() => {
+            if (stopped) return;
+            events = new EventSource(`http://localhost:${window.LAUNCH_TUBE_PORT}/api/1/events?types=player`);
+            events.onmessage = (e) => {
+                const event = JSON.parse(e.data);
+                const status = event.data || {};
+
+                if (event.type === 'player.ended' || (event.type === 'player.status' && !status.playing)) {
+                    stop();
+                    onStop();
+                } else if (status.position !== undefined && status.duration !== undefined && status.duration > 0) {
+                    onStatus(`${formatTime(status.position)} / ${formatTime(status.duration)}`);
+                } else if (status.position !== undefined) {
+                    onStatus(`Playing... ${formatTime(status.position)}`);
+                }
+            };
+            events.onerror = () => {
+                // Lost the launcher, and with it the player
+                if (events && events.readyState !== EventSource.OPEN) {
+                    stop();
+                    onStop();
+                }
+            };
+        }, 2000);
+
+        return stop;
+    };
+})();
@@ -79,7 +79,7 @@
     // Modal state
     let modalElement = null;
     let statusElement = null;
-    let pollInterval = null;
+    let stopWatchingPlayer = null;
 
     let dialogObserver = null;
 
@@ -157,7 +157,10 @@
         statusElement = modalElement.querySelector('.modal-status');
 
         document.addEventListener('keydown', handleModalKeydown, true);
-        startStatusPolling();
+        stopWatchingPlayer = window.launchTubeWatchPlayer(updateModalStatus, () => {
+            console.log('Launch Tube: Player stopped, hiding modal');
+            hideModal(false);
+        });
     }
 
     function updateModalStatus(message) {
@@ -167,9 +170,9 @@
     }
 
     function hideModal(stopPlayer = true) {
-        if (pollInterval) {
-            clearInterval(pollInterval);
-            pollInterval = null;
+        if (stopWatchingPlayer) {
+            stopWatchingPlayer();
+            stopWatchingPlayer = null;
         }
         if (dialogObserver) {
             dialogObserver.disconnect();
@@ -356,47 +359,6 @@
             });
     }
 
-    function startStatusPolling() {
-        // Wait a bit before first poll to give mpv time to start
-        setTimeout(() => {
-            pollInterval = setInterval(async () => {
-                try {
-                    const response = await fetch(`${LAUNCH_TUBE_URL}/api/1/player/status`);
-                    const status = await response.json();
-                    console.log('Launch Tube: Poll status:', status);
-
-                if (!status.playing) {
-                    console.log('Launch Tube: Player stopped, hiding modal');
-                    hideModal(false);
-                } else {
-                    if (status.position !== undefined && status.duration !== undefined && status.duration > 0) {
-                        const posMin = Math.floor(status.position / 60);
-                        const posSec = Math.floor(status.position % 60);
-                        const durMin = Math.floor(status.duration / 60);
-                        const durSec = Math.floor(status.duration % 60);
-                        updateModalStatus(`${posMin}:${posSec.toString().padStart(2, '0')} / ${durMin}:${durSec.toString().padStart(2, '0')}`);
-                    } else if (status.position !== undefined) {
-                        const mins = Math.floor(status.position / 60);
-                        const secs = Math.floor(status.position % 60);
-                        updateModalStatus(`Playing... ${mins}:${secs.toString().padStart(2, '0')}`);
-                    }
-                }
-            } catch (err) {
-                hideModal(false);
-            }
-        }, 1000);
-        }, 2000); // Initial delay before first poll
-    }
-
-    // Get Emby auth info from ApiClient
-    function getServerInfo() {
-        const serverUrl = window.location.origin;
-        const userId = window.ApiClient?.getCurrentUserId?.() || '';
-        const token = window.ApiClient?.accessToken?.() || '';
-        serverLog(`getServerInfo: serverUrl=${serverUrl}, userId=${userId}, hasToken=${!!token}`);
-        return { serverUrl, userId, token };
-    }
-
     // Get item details from Emby API
     async function getItemDetails(itemId) {
         const { serverUrl, userId, token } = getServerInfo();
@@ -462,6 +424,33 @@
         };
     }
 
+    // Build intro/credits segments from the item's chapter markers
+    function buildSegments(item) {
+        const chapters = item.Chapters || [];
+        const marker = type => chapters.find(chapter => chapter.MarkerType === type);
+        const segments = [];
+
+        const introStart = marker('IntroStart');
+        const introEnd = marker('IntroEnd');
+        if (introStart && introEnd && introEnd.StartPositionTicks > introStart.StartPositionTicks) {
+            segments.push({
+                label: 'intro',
+                start: introStart.StartPositionTicks / 10000000,
+                end: introEnd.StartPositionTicks / 10000000,
+            });
+        }
+
+        const creditsStart = marker('CreditsStart');
+        if (creditsStart && item.RunTimeTicks > creditsStart.StartPositionTicks) {
+            segments.push({
+                label: 'credits',
+                start: creditsStart.StartPositionTicks / 10000000,
+                end: item.RunTimeTicks / 10000000,
+            });
+        }
+        return segments;
+    }
+
     // Build onProgress callback for periodic progress updates
     function buildOnProgress(itemId, mediaSourceId, playSessionId) {
         const { serverUrl, token } = getServerInfo();
@@ -495,7 +484,7 @@
         url += `&Recursive=true`;
         url += `&SortBy=SortName`;
         url += `&SortOrder=Ascending`;
-        url += `&Fields=Path,MediaSources`;
+        url += `&Fields=Path,MediaSources,Chapters`;
 
         const response = await fetch(url);
         if (!response.ok) throw new Error(`API error: ${response.status}`);
@@ -516,6 +505,7 @@
                 return {
                     url: buildStreamUrl(item.Id, item.MediaSources?.[0]?.Id, playSessionId),
                     itemId: item.Id,
+                    segments: buildSegments(item),
                     onComplete: buildOnComplete(item.Id, item.MediaSources?.[0]?.Id, playSessionId),
                     playSessionId: playSessionId,
                 };
@@ -576,6 +566,7 @@
                 const startPosition = startPositionTicks / 10000000;
                 const onComplete = buildOnComplete(itemId, mediaSourceId, playSessionId);
                 const onProgress = buildOnProgress(itemId, mediaSourceId, playSessionId);
+                const segments = buildSegments(item);
 
                 // Report playback start to Emby to create the session
                 await reportPlaybackStart(itemId, mediaSourceId, playSessionId);
@@ -585,7 +576,7 @@
                 const response = await fetch(`${LAUNCH_TUBE_URL}/api/1/player/play`, {
                     method: 'POST',
                     headers: { 'Content-Type': 'application/json' },
-                    body: JSON.stringify({ url: streamUrl, title, startPosition, onComplete, onProgress }),
+                    body: JSON.stringify({ url: streamUrl, title, startPosition, segments, onComplete, onProgress }),
                 });
 
                 if (!response.ok) throw new Error(`Player API error: ${response.status}`);
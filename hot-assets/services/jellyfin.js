@@ -79,7 +79,7 @@
     // Modal state
     let modalElement = null;
     let statusElement = null;
-    let pollInterval = null;
+    let stopWatchingPlayer = null;
     let dialogObserver = null;
 
     // Navigation state (used by escape handler and nav code)
@@ -159,7 +159,10 @@
         statusElement = modalElement.querySelector('.modal-status');
 
         document.addEventListener('keydown', handleModalKeydown, true);
-        startStatusPolling();
+        stopWatchingPlayer = window.launchTubeWatchPlayer(updateModalStatus, () => {
+            console.log('Launch Tube: Player stopped, hiding modal');
+            hideModal(false);
+        });
     }
 
     function updateModalStatus(message) {
@@ -169,9 +172,9 @@
     }
 
     function hideModal(stopPlayer = true) {
-        if (pollInterval) {
-            clearInterval(pollInterval);
-            pollInterval = null;
+        if (stopWatchingPlayer) {
+            stopWatchingPlayer();
+            stopWatchingPlayer = null;
         }
         if (dialogObserver) {
             dialogObserver.disconnect();
@@ -383,46 +386,6 @@
             });
     }
 
-    function startStatusPolling() {
-        // Wait a bit before first poll to give mpv time to start
-        setTimeout(() => {
-            pollInterval = setInterval(async () => {
-                try {
-                    const response = await fetch(`${LAUNCH_TUBE_URL}/api/1/player/status`);
-                    const status = await response.json();
-                    console.log('Launch Tube: Poll status:', status);
-
-                if (!status.playing) {
-                    console.log('Launch Tube: Player stopped, hiding modal');
-                    hideModal(false);
-                } else {
-                    if (status.position !== undefined && status.duration !== undefined && status.duration > 0) {
-                        const posMin = Math.floor(status.position / 60);
-                        const posSec = Math.floor(status.position % 60);
-                        const durMin = Math.floor(status.duration / 60);
-                        const durSec = Math.floor(status.duration % 60);
-                        updateModalStatus(`${posMin}:${posSec.toString().padStart(2, '0')} / ${durMin}:${durSec.toString().padStart(2, '0')}`);
-                    } else if (status.position !== undefined) {
-                        const mins = Math.floor(status.position / 60);
-                        const secs = Math.floor(status.position % 60);
-                        updateModalStatus(`Playing... ${mins}:${secs.toString().padStart(2, '0')}`);
-                    }
-                }
-            } catch (err) {
-                hideModal(false);
-            }
-        }, 1000);
-        }, 2000); // Initial delay before first poll
-    }
-
-    // Get Jellyfin auth info from ApiClient
-    function getServerInfo() {
-        const serverUrl = window.location.origin;
-        const userId = window.ApiClient?.getCurrentUserId?.() || '';
-        const token = window.ApiClient?.accessToken?.() || '';
-        return { serverUrl, userId, token };
-    }
-
     // Get item details from Jellyfin API
     async function getItemDetails(itemId) {
         const { serverUrl, userId, token } = getServerInfo();
@@ -440,6 +403,43 @@
         return `${serverUrl}/Videos/${itemId}/stream?static=true&api_key=${encodeURIComponent(token)}`;
     }
 
+    // Build URLs for the item's external subtitle files (e.g. SRTs next to the video)
+    function buildSubtitleUrls(item) {
+        const { serverUrl, token } = getServerInfo();
+        const source = item.MediaSources?.[0];
+        if (!source) return [];
+        return (source.MediaStreams || [])
+            .filter(stream => stream.Type === 'Subtitle' && stream.IsExternal && stream.IsTextSubtitleStream)
+            .map(stream => {
+                const format = !stream.Codec || stream.Codec === 'subrip' ? 'srt' : stream.Codec;
+                return `${serverUrl}/Videos/${item.Id}/${source.Id}/Subtitles/${stream.Index}/Stream.${format}?api_key=${encodeURIComponent(token)}`;
+            });
+    }
+
+    // Jellyfin segment types and the labels the player shows for them
+    const SEGMENT_LABELS = { Intro: 'intro', Outro: 'credits', Recap: 'recap', Preview: 'preview', Commercial: 'commercial' };
+
+    // Fetch the item's intro/credits segments (Jellyfin 10.10+). Older servers
+    // don't have the endpoint, which just means nothing to skip.
+    async function getMediaSegments(itemId) {
+        const { serverUrl, token } = getServerInfo();
+        try {
+            const response = await fetch(`${serverUrl}/MediaSegments/${itemId}?api_key=${encodeURIComponent(token)}`);
+            if (!response.ok) return [];
+            const data = await response.json();
+            return (data.Items || [])
+                .filter(segment => SEGMENT_LABELS[segment.Type])
+                .map(segment => ({
+                    label: SEGMENT_LABELS[segment.Type],
+                    start: segment.StartTicks / 10000000,
+                    end: segment.EndTicks / 10000000,
+                }));
+        } catch (e) {
+            console.log('Launch Tube: No media segments for', itemId, e);
+            return [];
+        }
+    }
+
     // Build onComplete callback for an item
     function buildOnComplete(itemId, mediaSourceId) {
         const { serverUrl, token } = getServerInfo();
@@ -457,6 +457,60 @@
         };
     }
 
+    // Build stream URL for a music track
+    function buildAudioUrl(itemId) {
+        const { serverUrl, token } = getServerInfo();
+        return `${serverUrl}/Audio/${itemId}/stream?static=true&api_key=${encodeURIComponent(token)}`;
+    }
+
+    // Album art for a track, falling back to the album's
+    function buildArtworkUrl(item) {
+        const { serverUrl, token } = getServerInfo();
+        const imageId = item.ImageTags?.Primary ? item.Id : item.AlbumId;
+        if (!imageId) return '';
+        return `${serverUrl}/Items/${imageId}/Images/Primary?maxHeight=600&api_key=${encodeURIComponent(token)}`;
+    }
+
+    // Fetch an album's tracks in disc/track order
+    async function getAlbumTracks(albumId) {
+        const { serverUrl, userId, token } = getServerInfo();
+        if (!userId || !token) throw new Error('Not authenticated');
+
+        let url = `${serverUrl}/Users/${userId}/Items?api_key=${encodeURIComponent(token)}`;
+        url += `&ParentId=${encodeURIComponent(albumId)}`;
+        url += `&IncludeItemTypes=Audio`;
+        url += `&Recursive=true`;
+        url += `&SortBy=ParentIndexNumber,IndexNumber,SortName`;
+
+        const response = await fetch(url);
+        if (!response.ok) throw new Error(`API error: ${response.status}`);
+        const data = await response.json();
+        return data.Items || [];
+    }
+
+    // Play music tracks without a video window; the launcher shows them
+    async function playAudio(tracks, startPositionTicks = 0) {
+        if (!tracks || tracks.length === 0) return false;
+
+        const items = tracks.map(track => ({
+            url: buildAudioUrl(track.Id),
+            itemId: track.Id,
+            title: [track.Name, track.AlbumArtist].filter(Boolean).join(' — '),
+            poster: buildArtworkUrl(track),
+            onComplete: buildOnComplete(track.Id, track.Id),
+        }));
+
+        const response = await fetch(`${LAUNCH_TUBE_URL}/api/1/player/playlist`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ items, startPosition: startPositionTicks / 10000000, audio: true }),
+        });
+        if (!response.ok) throw new Error(`Player API error: ${response.status}`);
+        console.log('Launch Tube: Playing', items.length, 'tracks');
+        hideModal(false);
+        return true;
+    }
+
     // Video types we should play externally
     const VIDEO_TYPES = ['Movie', 'Episode', 'MusicVideo', 'Video', 'Trailer'];
     // Container types that expand into playlists
@@ -488,9 +542,13 @@
         showModal(`Loading playlist (${items.length} items)...`);
 
         try {
-            const playlistItems = items.map(item => ({
+            const segments = await Promise.all(items.map(item => getMediaSegments(item.Id)));
+            const playlistItems = items.map((item, index) => ({
                 url: buildStreamUrl(item.Id),
                 itemId: item.Id,
+                title: item.Name,
+                subtitles: buildSubtitleUrls(item),
+                segments: segments[index],
                 onComplete: buildOnComplete(item.Id, item.MediaSources?.[0]?.Id),
             }));
 
@@ -524,6 +582,14 @@
             const item = await getItemDetails(itemId);
             console.log('Launch Tube: Item type:', item.Type, 'Name:', item.Name);
 
+            // Music - a track or a whole album, played audio-only
+            if (item.Type === 'Audio') {
+                return await playAudio([item], startPositionTicks);
+            }
+            if (item.Type === 'MusicAlbum') {
+                return await playAudio(await getAlbumTracks(itemId));
+            }
+
             // Container types - expand to playlist
             if (CONTAINER_TYPES.includes(item.Type)) {
                 const episodes = await getChildEpisodes(itemId);
@@ -541,13 +607,15 @@
                 const title = item.Name || 'Jellyfin Video';
                 const startPosition = startPositionTicks / 10000000;
                 const onComplete = buildOnComplete(itemId, item.MediaSources?.[0]?.Id);
+                const subtitles = buildSubtitleUrls(item);
+                const segments = await getMediaSegments(itemId);
 
                 console.log('Launch Tube: Playing single item:', { streamUrl, title, startPosition });
 
                 const response = await fetch(`${LAUNCH_TUBE_URL}/api/1/player/play`, {
                     method: 'POST',
                     headers: { 'Content-Type': 'application/json' },
-                    body: JSON.stringify({ url: streamUrl, title, startPosition, onComplete }),
+                    body: JSON.stringify({ url: streamUrl, title, startPosition, itemId, subtitles, segments, onComplete }),
                 });
 
                 if (!response.ok) throw new Error(`Player API error: ${response.status}`);
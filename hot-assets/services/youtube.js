@@ -7,7 +7,7 @@
     let confirmationElement = null;
     let modalElement = null;
     let statusElement = null;
-    let pollInterval = null;
+    let stopWatchingPlayer = null;
     let selectedElement = null;
     let ignoreMouseUntil = 0;
 
@@ -87,7 +87,10 @@
         statusElement = modalElement.querySelector('.modal-status');
 
         document.addEventListener('keydown', handleModalKeydown, true);
-        startStatusPolling();
+        stopWatchingPlayer = window.launchTubeWatchPlayer(updateModalStatus, () => {
+            serverLog('Player stopped, hiding modal');
+            hideModal(false);
+        });
     }
 
     function updateModalStatus(message) {
@@ -97,9 +100,9 @@
     }
 
     function hideModal(stopPlayer = true) {
-        if (pollInterval) {
-            clearInterval(pollInterval);
-            pollInterval = null;
+        if (stopWatchingPlayer) {
+            stopWatchingPlayer();
+            stopWatchingPlayer = null;
         }
         document.removeEventListener('keydown', handleModalKeydown, true);
         if (modalElement) {
@@ -125,50 +128,6 @@
         }
     }
 
-    function startStatusPolling() {
-        setTimeout(() => {
-            pollInterval = setInterval(async () => {
-                try {
-                    const response = await fetch(`${LAUNCH_TUBE_URL}/api/1/player/status`);
-                    const status = await response.json();
-
-                    if (!status.playing) {
-                        serverLog('Player stopped, hiding modal');
-                        hideModal(false);
-                    } else {
-                        if (status.position !== undefined && status.duration !== undefined && status.duration > 0) {
-                            const posMin = Math.floor(status.position / 60);
-                            const posSec = Math.floor(status.position % 60);
-                            const durMin = Math.floor(status.duration / 60);
-                            const durSec = Math.floor(status.duration % 60);
-                            updateModalStatus(`${posMin}:${posSec.toString().padStart(2, '0')} / ${durMin}:${durSec.toString().padStart(2, '0')}`);
-                        } else if (status.position !== undefined) {
-                            const mins = Math.floor(status.position / 60);
-                            const secs = Math.floor(status.position % 60);
-                            updateModalStatus(`Playing... ${mins}:${secs.toString().padStart(2, '0')}`);
-                        }
-                    }
-                } catch (err) {
-                    hideModal(false);
-                }
-            }, 1000);
-        }, 2000);
-    }
-
-    // Extract video URL from a video card element
-    function extractVideoUrl(element) {
-        // Look for the thumbnail link or video title link
-        const link = element.querySelector('a#thumbnail, a#video-title-link, a[href*="/watch"]');
-        if (link && link.href) {
-            return link.href;
-        }
-        // Check if element itself is a link
-        if (element.href && element.href.includes('/watch')) {
-            return element.href;
-        }
-        return null;
-    }
-
     // Extract video title from a video card element
     function extractVideoTitle(element) {
         const titleEl = element.querySelector('#video-title, #title, yt-formatted-string#video-title');